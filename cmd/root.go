@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/gookit/event"
 	"github.com/gotrackery/gotrackery/cfg"
+	"github.com/gotrackery/gotrackery/internal/outbox"
 	"github.com/gotrackery/gotrackery/internal/protocol/egts"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -35,16 +38,26 @@ data transfer protocols and convert it into a universal stream of messages, to w
 you can create a subscriber for further processing of this data, such as saving it to
 the database or transferring it to the message queue.
 
- One running instance of the server processes one type of protocol on a specified port.
- To process multiple protocols, you need to run multiple server instances with different
-protocols, which are specified as a command.
+ Server commands (tcp, udp, http) process one type of protocol on a specified port.
+ To process multiple protocols in one process, list them in listeners config section
+and run serve command.
 
 Supported commands (protocols):
+- serve
 - tcp
+- udp
+- http (OsmAnd, Traccar Client)
 - replay
 
 Supported Subscribers:
 - example postgres database
+- kafka
+- mqtt
+- nats (JetStream)
+- webhook
+- redis (streams and last known positions)
+- archive (NDJSON or CSV files)
+- clickhouse
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("%s (c) Copyright 2023 %s\n", binary, viper.GetString("author")) //nolint:forbidigo
@@ -74,7 +87,7 @@ func init() {
 	rootCmd.PersistentFlags().StringP("address", "a", ":5001",
 		"server address with port: :5001")
 	rootCmd.PersistentFlags().StringP("proto", "p", egts.Proto,
-		"device protocol to use: egts")
+		"device protocol to use: egts, auto to detect it")
 	rootCmd.PersistentFlags().IntP("timeouts", "t", 10,
 		"network timeouts in seconds: -t 10")
 
@@ -101,3 +114,35 @@ func initConfig() {
 	}
 	cfg.InitFile(binary, cfgFile)
 }
+
+// closeSubscribers closes subscribers implementing io.Closer after events are delivered.
+func closeSubscribers(subs []event.Subscriber) {
+	for _, sub := range subs {
+		c, ok := sub.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			logger.Error().Err(err).Str("subscriber", fmt.Sprintf("%s", sub)).Msg("close subscriber")
+		}
+	}
+}
+
+// retainOutbox removes cursors of the outbox of subscribers which are not registered anymore.
+func retainOutbox(ob *outbox.Outbox, names []string) {
+	if ob == nil {
+		return
+	}
+	for _, name := range ob.Retain(names...) {
+		logger.Warn().Str("subscriber", name).Msg("outbox cursor of not registered subscriber is removed")
+	}
+}
+
+// closeOutbox closes events outbox after servers are stopped.
+func closeOutbox(ob *outbox.Outbox) {
+	if err := ob.Close(); err != nil {
+		logger.Error().Err(err).Msg("close events outbox")
+		return
+	}
+	logger.Info().Object("outbox", ob.Stats()).Msg("events outbox closed")
+}
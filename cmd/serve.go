@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gotrackery/gotrackery/cfg"
+	"github.com/gotrackery/gotrackery/internal"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/gotrackery/internal/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve command runs all listeners from config.",
+	Long: `Run all listeners of listeners config section in one process.
+ Listeners share the subscribers and are shut down together, when any of them stops
+ or the process is interrupted. Active tcp sessions are drained and pending deliveries of events
+ are waited for within serve.shutdown-timeout seconds (30 by default).
+
+Config example:
+ listeners:
+   - proto: egts
+     address: :5001
+   - proto: wialonips
+     address: :5002
+     network: udp
+   - proto: osmand
+     address: :5055
+
+Example:
+ gotr serve --config ./configs/.gotr.yaml`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		_ = viper.BindPFlag("serve.timeouts", rootCmd.PersistentFlags().Lookup("timeouts"))
+
+		viper.SetDefault("serve.timeouts", 10)
+		viper.SetDefault("serve.shutdown-timeout", 30)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cfg.Load()
+		if err != nil {
+			return fmt.Errorf("loading config in serve command: %w", err)
+		}
+
+		if len(c.Listeners) == 0 {
+			return errors.New("validate listeners config: no listeners")
+		}
+		for _, l := range c.Listeners {
+			err = l.Validate()
+			if err != nil {
+				return fmt.Errorf("validate listener %s config: %w", l, err)
+			}
+		}
+
+		err = c.Consumers.Validate()
+		if err != nil {
+			return fmt.Errorf("validate consumers config: %w", err)
+		}
+
+		logger = internal.NewLogger(c.Log.ZerologLevel(), c.Log.Console, c.Log.NoBlock)
+		for _, l := range c.Listeners {
+			logger.Info().Object("listener", l).Msg("listener config")
+		}
+		logger.Info().Object("consumers", c.Consumers).Msg("consumers config")
+
+		subs, err := c.Consumers.Subscribers()
+		if err != nil {
+			return fmt.Errorf("get events consumers-subscribers: %w", err)
+		}
+		defer closeSubscribers(subs)
+
+		ob, err := c.Consumers.Outbox.Open(logger)
+		if err != nil {
+			return fmt.Errorf("open events outbox: %w", err)
+		}
+		if ob != nil {
+			defer closeOutbox(ob)
+		}
+
+		d := ev.NewDispatcher(logger, time.Duration(viper.GetInt("serve.timeouts"))*time.Second,
+			c.Consumers.DispatcherOptions(ob)...)
+		for _, sub := range subs {
+			d.RegisterEventSubscriber(sub)
+		}
+		retainOutbox(ob, d.SubscribersNames())
+
+		shutdownTimeout := time.Duration(viper.GetInt("serve.shutdown-timeout")) * time.Second
+		group := server.NewGroup(logger)
+		for _, l := range c.Listeners {
+			srv, err := l.Server(logger, d, shutdownTimeout)
+			if err != nil {
+				return fmt.Errorf("create listener %s: %w", l, err)
+			}
+			group.Add(l.String(), srv)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = group.Run(ctx)
+
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		logger.Info().Object("deliveries", d.Shutdown(sctx)).Msg("listeners stopped")
+		if err != nil {
+			return fmt.Errorf("serve listeners: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,596 @@
+// Package archive provides the events subscriber writing positions to rotating files.
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+)
+
+var (
+	_ event.Listener   = (*Archive)(nil)
+	_ event.Subscriber = (*Archive)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "archive"
+
+const (
+	dateLayout    = "2006-01-02"
+	segmentLayout = "20060102T150405.000000000"
+	gzipExt       = ".gz"
+	tmpExt        = ".tmp"
+	unknown       = "unknown"
+
+	defaultMaxSize      = 64 << 20
+	defaultMaxAge       = time.Hour
+	defaultSyncInterval = time.Second
+	// tick is the period of checking segments for rotation and sync.
+	tick = time.Second
+)
+
+// ErrClosed is returned when the position is handled by the closed archive.
+var ErrClosed = errors.New("archive closed")
+
+// Format is the format of archive files.
+type Format string
+
+const (
+	// FormatNDJSON is newline-delimited JSON of encoding.Message.
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV is CSV with header of Columns.
+	FormatCSV Format = "csv"
+)
+
+// Valid reports whether the format is known.
+func (f Format) Valid() bool {
+	return f == FormatNDJSON || f == FormatCSV
+}
+
+// Columns are the columns of CSV files.
+var Columns = []string{"device", "protocol", "time", "valid", "lat", "lon", "alt", "speed", "course", "cellular", "attributes"}
+
+// SyncPolicy defines when written positions are synced to the disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways syncs every position before it is reported as delivered.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval syncs positions periodically.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNone leaves syncing to the operating system.
+	SyncNone SyncPolicy = "none"
+)
+
+// Valid reports whether the policy is known.
+func (p SyncPolicy) Valid() bool {
+	return p == SyncAlways || p == SyncInterval || p == SyncNone
+}
+
+// Option is a functional option for the archive.
+type Option func(*Archive)
+
+// WithFormat sets the format of files. Default is NDJSON.
+func WithFormat(f Format) Option {
+	return func(a *Archive) {
+		if f.Valid() {
+			a.format = f
+		}
+	}
+}
+
+// WithMaxSize sets the size of the segment in bytes to rotate it. Default is 64MB.
+func WithMaxSize(n int64) Option {
+	return func(a *Archive) {
+		if n > 0 {
+			a.maxSize = n
+		}
+	}
+}
+
+// WithMaxAge sets the time since the segment is opened to rotate it. Default is 1h.
+func WithMaxAge(d time.Duration) Option {
+	return func(a *Archive) {
+		if d > 0 {
+			a.maxAge = d
+		}
+	}
+}
+
+// WithCompress sets whether rotated segments are compressed by gzip. Default is true.
+func WithCompress(compress bool) Option {
+	return func(a *Archive) {
+		a.compress = compress
+	}
+}
+
+// WithSync sets the sync policy, interval is the period of SyncInterval policy.
+// Default is SyncInterval every 1s.
+func WithSync(p SyncPolicy, interval time.Duration) Option {
+	return func(a *Archive) {
+		if p.Valid() {
+			a.sync = p
+		}
+		if interval > 0 {
+			a.syncInterval = interval
+		}
+	}
+}
+
+// WithRetention sets the number of days the archive is kept, older date directories are removed.
+// Default is 0, the archive is kept forever.
+func WithRetention(days int) Option {
+	return func(a *Archive) {
+		if days > 0 {
+			a.retention = days
+		}
+	}
+}
+
+// segment is the file positions of the protocol are appended to.
+type segment struct {
+	f      *os.File
+	date   string
+	size   int64
+	opened time.Time
+	dirty  bool
+}
+
+// Archive writes positions to files partitioned by date and protocol: <dir>/<date>/<protocol>/<segment>.
+// Date is UTC date of writing, the segment is rotated when it reaches max size or max age or the date
+// is changed. Rotated segments are compressed, segments left by the crash are compressed on start.
+type Archive struct {
+	dir string
+
+	format       Format
+	maxSize      int64
+	maxAge       time.Duration
+	compress     bool
+	sync         SyncPolicy
+	syncInterval time.Duration
+	retention    int
+	now          func() time.Time
+
+	mu       sync.Mutex
+	segments map[string]*segment
+	closed   bool
+	synced   time.Time
+	cleaned  string
+
+	done    chan struct{}
+	stopped chan struct{}
+	wg      sync.WaitGroup
+	errs    chan error
+}
+
+// NewArchive creates a new archive in the directory.
+func NewArchive(dir string, opts ...Option) (*Archive, error) {
+	if dir == "" {
+		return nil, errors.New("no dir")
+	}
+	a := &Archive{
+		dir:          dir,
+		format:       FormatNDJSON,
+		maxSize:      defaultMaxSize,
+		maxAge:       defaultMaxAge,
+		compress:     true,
+		sync:         SyncInterval,
+		syncInterval: defaultSyncInterval,
+		now:          time.Now,
+		segments:     make(map[string]*segment),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		errs:         make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive dir: %w", err)
+	}
+	if err := a.cleanup(); err != nil {
+		return nil, err
+	}
+	if a.compress {
+		if err := a.recover(); err != nil {
+			return nil, err
+		}
+	}
+	go a.run()
+	return a, nil
+}
+
+func (a *Archive) String() string {
+	return Name
+}
+
+func (a *Archive) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionReceived, Name): a,
+	}
+}
+
+// Handle appends the position to the segment of its protocol.
+func (a *Archive) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	pos := eve.Position()
+	if pos == nil {
+		return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
+	}
+	line, err := a.line(*pos)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	protocol := partition(pos.Protocol)
+	seg, err := a.segment(protocol)
+	if err != nil {
+		return err
+	}
+	n, err := seg.f.Write(line)
+	seg.size += int64(n)
+	seg.dirty = true
+	if err == nil && a.sync == SyncAlways {
+		err = seg.f.Sync()
+		seg.dirty = false
+	}
+	if err != nil {
+		// the next position is written to the new segment.
+		_ = a.rotate(protocol)
+		return fmt.Errorf("write position: %w", err)
+	}
+	return nil
+}
+
+// line returns the position in the archive format.
+func (a *Archive) line(pos common.Position) ([]byte, error) {
+	msg := encoding.NewMessage(pos)
+	if a.format == FormatNDJSON {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("marshal position: %w", err)
+		}
+		return append(b, '\n'), nil
+	}
+
+	record := []string{
+		msg.Device,
+		msg.Protocol,
+		msg.Time.Format(time.RFC3339Nano),
+		strconv.FormatBool(msg.Valid),
+		strconv.FormatFloat(msg.Lat, 'f', -1, 64),
+		strconv.FormatFloat(msg.Lon, 'f', -1, 64),
+		strconv.FormatFloat(msg.Alt, 'f', -1, 64),
+		"",
+		"",
+		"",
+		"",
+	}
+	if msg.Speed.Valid {
+		record[7] = strconv.FormatFloat(msg.Speed.Float64, 'f', -1, 64)
+	}
+	if msg.Course.Valid {
+		record[8] = strconv.FormatFloat(msg.Course.Float64, 'f', -1, 64)
+	}
+	if msg.Cellular != nil {
+		b, err := json.Marshal(msg.Cellular)
+		if err != nil {
+			return nil, fmt.Errorf("marshal cellular: %w", err)
+		}
+		record[9] = string(b)
+	}
+	if len(msg.Attributes) > 0 {
+		b, err := json.Marshal(msg.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("marshal attributes: %w", err)
+		}
+		record[10] = string(b)
+	}
+	return csvLine(record)
+}
+
+func csvLine(record []string) ([]byte, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(record); err != nil {
+		return nil, fmt.Errorf("write csv: %w", err)
+	}
+	w.Flush()
+	return []byte(b.String()), nil
+}
+
+// segment returns the open segment of the protocol, the expired segment is rotated.
+func (a *Archive) segment(protocol string) (*segment, error) {
+	now := a.now().UTC()
+	if seg, ok := a.segments[protocol]; ok {
+		if !a.expired(seg, now) {
+			return seg, nil
+		}
+		if err := a.rotate(protocol); err != nil {
+			return nil, err
+		}
+	}
+
+	date := now.Format(dateLayout)
+	dir := filepath.Join(a.dir, date, protocol)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create segment dir: %w", err)
+	}
+	f, err := create(filepath.Join(dir, now.Format(segmentLayout)), "."+string(a.format))
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{f: f, date: date, opened: now}
+	if a.format == FormatCSV {
+		header, _ := csvLine(Columns)
+		n, err := f.Write(header)
+		seg.size = int64(n)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("write csv header: %w", err)
+		}
+	}
+	a.segments[protocol] = seg
+	return seg, nil
+}
+
+// create creates the new segment file, the sequence number is added to the name
+// if the segment or its compressed copy exists.
+func create(name, ext string) (*os.File, error) {
+	for seq := 0; ; seq++ {
+		path := name + ext
+		if seq > 0 {
+			path = fmt.Sprintf("%s-%d%s", name, seq, ext)
+		}
+		if _, err := os.Stat(path + gzipExt); err == nil {
+			continue
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create segment: %w", err)
+		}
+		return f, nil
+	}
+}
+
+func (a *Archive) expired(seg *segment, now time.Time) bool {
+	return seg.size >= a.maxSize || now.Sub(seg.opened) >= a.maxAge || now.Format(dateLayout) != seg.date
+}
+
+// rotate closes the segment of the protocol and compresses it in background.
+func (a *Archive) rotate(protocol string) error {
+	seg := a.segments[protocol]
+	delete(a.segments, protocol)
+	err := seg.f.Sync()
+	if cerr := seg.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+	if a.compress {
+		a.wg.Add(1)
+		go func(path string) {
+			defer a.wg.Done()
+			a.report(compress(path))
+		}(seg.f.Name())
+	}
+	return nil
+}
+
+// run syncs and rotates expired segments, it removes the archive out of retention.
+func (a *Archive) run() {
+	defer close(a.stopped)
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			a.report(a.check())
+			a.report(a.cleanup())
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *Archive) check() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	now := a.now().UTC()
+	syncing := a.sync == SyncInterval && now.Sub(a.synced) >= a.syncInterval
+	if syncing {
+		a.synced = now
+	}
+	for protocol, seg := range a.segments {
+		switch {
+		case a.expired(seg, now):
+			err = errors.Join(err, a.rotate(protocol))
+		case syncing && seg.dirty:
+			if serr := seg.f.Sync(); serr != nil {
+				err = errors.Join(err, fmt.Errorf("sync segment: %w", serr))
+			}
+			seg.dirty = false
+		}
+	}
+	return err
+}
+
+// cleanup removes date directories out of retention once a day.
+func (a *Archive) cleanup() error {
+	if a.retention == 0 {
+		return nil
+	}
+	today := a.now().UTC().Format(dateLayout)
+	if a.cleaned == today {
+		return nil
+	}
+	a.cleaned = today
+	oldest := a.now().UTC().AddDate(0, 0, -a.retention).Format(dateLayout)
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return fmt.Errorf("read archive dir: %w", err)
+	}
+	for _, e := range entries {
+		if _, perr := time.Parse(dateLayout, e.Name()); !e.IsDir() || perr != nil || e.Name() >= oldest {
+			continue
+		}
+		if rerr := os.RemoveAll(filepath.Join(a.dir, e.Name())); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("remove archive out of retention: %w", rerr))
+		}
+	}
+	return err
+}
+
+// recover compresses segments left uncompressed, temporary files of interrupted compression are removed.
+func (a *Archive) recover() error {
+	var left []string
+	err := filepath.WalkDir(a.dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			return nil
+		case strings.HasSuffix(path, gzipExt+tmpExt):
+			return os.Remove(path)
+		case strings.HasSuffix(path, "."+string(FormatNDJSON)), strings.HasSuffix(path, "."+string(FormatCSV)):
+			left = append(left, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("recover archive: %w", err)
+	}
+	for _, path := range left {
+		a.wg.Add(1)
+		go func(path string) {
+			defer a.wg.Done()
+			a.report(compress(path))
+		}(path)
+	}
+	return nil
+}
+
+// report keeps the first background error to return it on close.
+func (a *Archive) report(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case a.errs <- err:
+	default:
+	}
+}
+
+// compress replaces the file by its gzip.
+func compress(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer src.Close()
+	tmp := path + gzipExt + tmpExt
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create compressed segment: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	if _, err = io.Copy(zw, src); err != nil {
+		return fmt.Errorf("compress segment: %w", err)
+	}
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("compress segment: %w", err)
+	}
+	if err = dst.Sync(); err != nil {
+		return fmt.Errorf("sync compressed segment: %w", err)
+	}
+	if err = dst.Close(); err != nil {
+		return fmt.Errorf("close compressed segment: %w", err)
+	}
+	if err = os.Rename(tmp, path+gzipExt); err != nil {
+		return fmt.Errorf("rename compressed segment: %w", err)
+	}
+	if err = os.Remove(path); err != nil {
+		return fmt.Errorf("remove compressed segment: %w", err)
+	}
+	return nil
+}
+
+// partition returns the directory name of the protocol.
+func partition(protocol string) string {
+	p := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, strings.TrimLeft(protocol, "."))
+	if p == "" {
+		return unknown
+	}
+	return p
+}
+
+// Close rotates open segments and waits for their compression.
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	var err error
+	for protocol := range a.segments {
+		err = errors.Join(err, a.rotate(protocol))
+	}
+	a.mu.Unlock()
+
+	close(a.done)
+	<-a.stopped
+	a.wg.Wait()
+	select {
+	case e := <-a.errs:
+		err = errors.Join(err, e)
+	default:
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+var start = time.Date(2023, 4, 1, 23, 59, 0, 0, time.UTC)
+
+// clock is the time of the archive moved by the test.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newArchive(t *testing.T, dir string, opts ...Option) (*Archive, *clock) {
+	t.Helper()
+	c := &clock{t: start}
+	a, err := NewArchive(dir, append(opts, func(a *Archive) { a.now = c.now })...)
+	require.NoError(t, err)
+	return a, c
+}
+
+func positionEvent(protocol, device string, lon float64) *ev.GenericEvent {
+	pos := common.Position{Protocol: protocol, DeviceID: device, DeviceTime: start, Speed: null.FloatFrom(42.5)}
+	pos.X = lon
+	e := new(ev.GenericEvent)
+	e.SetPosition(pos)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, Name))
+	return e
+}
+
+// files returns relative paths of archive files.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	sort.Strings(paths)
+	return paths
+}
+
+// lines returns lines of the compressed segment.
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var ls []string
+	s := bufio.NewScanner(zr)
+	for s.Scan() {
+		ls = append(ls, s.Text())
+	}
+	require.NoError(t, s.Err())
+	return ls
+}
+
+func TestArchive_NDJSON(t *testing.T) {
+	dir := t.TempDir()
+	a, c := newArchive(t, dir)
+	require.NoError(t, a.Handle(positionEvent("egts", "1", 1)))
+	require.NoError(t, a.Handle(positionEvent("egts", "2", 2)))
+	require.NoError(t, a.Handle(positionEvent("", "3", 3)))
+	// the segment is rotated on the next date.
+	c.add(time.Minute)
+	require.NoError(t, a.Handle(positionEvent("egts", "1", 4)))
+	require.NoError(t, a.Close())
+
+	paths := files(t, dir)
+	require.Len(t, paths, 3)
+	assert.Regexp(t, `^2023-04-01/egts/20230401T235900\.000000000\.ndjson\.gz$`, paths[0])
+	assert.Regexp(t, `^2023-04-01/unknown/.+\.ndjson\.gz$`, paths[1])
+	assert.Regexp(t, `^2023-04-02/egts/20230402T000000\.000000000\.ndjson\.gz$`, paths[2])
+
+	ls := lines(t, filepath.Join(dir, paths[0]))
+	require.Len(t, ls, 2)
+	var msg encoding.Message
+	require.NoError(t, json.Unmarshal([]byte(ls[1]), &msg))
+	assert.Equal(t, "2", msg.Device)
+	assert.Equal(t, 2.0, msg.Lon)
+	assert.Equal(t, start, msg.Time)
+
+	assert.ErrorIs(t, a.Handle(positionEvent("egts", "1", 5)), ErrClosed)
+}
+
+func TestArchive_CSV(t *testing.T) {
+	dir := t.TempDir()
+	a, _ := newArchive(t, dir, WithFormat(FormatCSV), WithCompress(false), WithSync(SyncAlways, 0))
+	require.NoError(t, a.Handle(positionEvent("egts", "1", 37.6177)))
+	require.NoError(t, a.Close())
+
+	paths := files(t, dir)
+	require.Len(t, paths, 1)
+	assert.Regexp(t, `^2023-04-01/egts/.+\.csv$`, paths[0])
+	f, err := os.Open(filepath.Join(dir, paths[0]))
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		Columns,
+		{"1", "egts", "2023-04-01T23:59:00Z", "false", "0", "37.6177", "0", "42.5", "", "", ""},
+	}, records)
+}
+
+func TestArchive_Rotate(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		dir := t.TempDir()
+		a, _ := newArchive(t, dir, WithMaxSize(1))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, a.Handle(positionEvent("egts", "1", float64(i))))
+		}
+		require.NoError(t, a.Close())
+		// the clock is not moved, so names of segments get the sequence number.
+		assert.Equal(t, []string{
+			"2023-04-01/egts/20230401T235900.000000000-1.ndjson.gz",
+			"2023-04-01/egts/20230401T235900.000000000-2.ndjson.gz",
+			"2023-04-01/egts/20230401T235900.000000000.ndjson.gz",
+		}, files(t, dir))
+	})
+	t.Run("age", func(t *testing.T) {
+		dir := t.TempDir()
+		a, c := newArchive(t, dir, WithMaxAge(time.Second), WithCompress(false))
+		defer a.Close()
+		require.NoError(t, a.Handle(positionEvent("egts", "1", 1)))
+		c.add(time.Second)
+		// the expired segment is closed in background.
+		require.Eventually(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return len(a.segments) == 0
+		}, 3*tick, 10*time.Millisecond)
+		assert.Len(t, files(t, dir), 1)
+	})
+}
+
+func TestArchive_Recover(t *testing.T) {
+	dir := t.TempDir()
+	seg := filepath.Join(dir, "2023-04-01", "egts")
+	require.NoError(t, os.MkdirAll(seg, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(seg, "1.ndjson"), []byte("{}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(seg, "2.ndjson.gz.tmp"), []byte("broken"), 0o644))
+
+	a, _ := newArchive(t, dir)
+	require.NoError(t, a.Close())
+	assert.Equal(t, []string{"2023-04-01/egts/1.ndjson.gz"}, files(t, dir))
+	assert.Equal(t, []string{"{}"}, lines(t, filepath.Join(seg, "1.ndjson.gz")))
+}
+
+func TestArchive_Retention(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"2023-03-24", "2023-03-25", "2023-04-01", "other"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0o755))
+	}
+	a, _ := newArchive(t, dir, WithRetention(7))
+	require.NoError(t, a.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"2023-03-25", "2023-04-01", "other"}, names)
+}
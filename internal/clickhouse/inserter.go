@@ -0,0 +1,348 @@
+// Package clickhouse provides the events subscriber inserting batches of positions to ClickHouse.
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gookit/event"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+)
+
+var (
+	_ event.Listener   = (*Inserter)(nil)
+	_ event.Subscriber = (*Inserter)(nil)
+	_ ev.Batcher       = (*Inserter)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "clickhouse"
+
+const (
+	// DefaultTable is the table of positions created by migrations.
+	DefaultTable = "positions"
+
+	defaultBatchSize     = 10000
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 30 * time.Second
+)
+
+// ErrClosed is returned when the position is handled by the closed inserter.
+var ErrClosed = errors.New("inserter closed")
+
+// Columns are the columns of the table in the order of Row values.
+var Columns = []string{
+	"device", "protocol", "fix_time", "server_time", "valid", "latitude", "longitude", "altitude",
+	"speed", "course", "mcc", "mnc", "lac", "cell_id",
+	"odometer", "sats", "hdop", "vdop", "pdop", "navsys", "move", "dinput", "doutput",
+	"attributes",
+}
+
+// Row is the position flattened to the table columns. Known attributes are typed columns,
+// the rest of attributes are strings of attributes map.
+type Row struct {
+	Device     string
+	Protocol   string
+	FixTime    time.Time
+	ServerTime time.Time
+	Valid      bool
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      *float64
+	Course     *float64
+	MCC        *int64
+	MNC        *int64
+	LAC        *int64
+	CellID     *int64
+	Odometer   *float64
+	Sats       *int64
+	HDOP       *float64
+	VDOP       *float64
+	PDOP       *float64
+	NavSys     *int64
+	Move       *int64
+	DigInput   *int64
+	DigOutput  *int64
+	Attributes map[string]string
+}
+
+// NewRow flattens the position received at the server time.
+func NewRow(pos common.Position, serverTime time.Time) Row {
+	r := Row{
+		Device:     pos.DeviceID,
+		Protocol:   pos.Protocol,
+		FixTime:    pos.DeviceTime,
+		ServerTime: serverTime,
+		Valid:      pos.Valid,
+		Latitude:   pos.Y,
+		Longitude:  pos.X,
+		Altitude:   pos.Z,
+		Speed:      pos.Speed.Ptr(),
+		Course:     pos.Course.Ptr(),
+		Attributes: make(map[string]string),
+	}
+	if c := pos.Cellular; c != nil {
+		r.MCC, r.MNC, r.LAC, r.CellID = &c.MCC, &c.MNC, &c.LAC, &c.CellID
+	}
+	floats := map[string]**float64{
+		common.Odometer: &r.Odometer,
+		common.HDOP:     &r.HDOP,
+		common.VDOP:     &r.VDOP,
+		common.PDOP:     &r.PDOP,
+	}
+	ints := map[string]**int64{
+		common.Satellites: &r.Sats,
+		common.NavSystem:  &r.NavSys,
+		common.Move:       &r.Move,
+		common.DigInput:   &r.DigInput,
+		common.DigOutput:  &r.DigOutput,
+	}
+	for k, v := range pos.Attributes {
+		if col, ok := floats[k]; ok {
+			if f, ok := toFloat(v); ok {
+				*col = &f
+				continue
+			}
+		}
+		if col, ok := ints[k]; ok {
+			if i, ok := toInt(v); ok {
+				*col = &i
+				continue
+			}
+		}
+		r.Attributes[k] = toString(v)
+	}
+	return r
+}
+
+// Values returns values of the row in the order of Columns.
+func (r Row) Values() []any {
+	return []any{
+		r.Device, r.Protocol, r.FixTime, r.ServerTime, r.Valid, r.Latitude, r.Longitude, r.Altitude,
+		r.Speed, r.Course, r.MCC, r.MNC, r.LAC, r.CellID,
+		r.Odometer, r.Sats, r.HDOP, r.VDOP, r.PDOP, r.NavSys, r.Move, r.DigInput, r.DigOutput,
+		r.Attributes,
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// toInt converts integer kinds, unsigned values out of int64 range are not converted.
+// Whole float64 values are converted too, since integers of positions replayed from JSON are decoded as float64.
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), true
+		}
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint:
+		if uint64(n) <= math.MaxInt64 {
+			return int64(n), true
+		}
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Conn is the connection to ClickHouse, it is implemented by driver.Conn.
+type Conn interface {
+	PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error)
+	Close() error
+}
+
+// Option is a functional option for the inserter.
+type Option func(*Inserter)
+
+// WithTable sets the table of positions. Default is DefaultTable.
+func WithTable(table string) Option {
+	return func(i *Inserter) {
+		if table != "" {
+			i.table = table
+		}
+	}
+}
+
+// WithBatch sets max number of positions in the batch and the time the dispatcher waits for more positions
+// after the first one. Default is 10000 positions and 1s.
+func WithBatch(size int, interval time.Duration) Option {
+	return func(i *Inserter) {
+		if size > 0 {
+			i.batchSize = size
+		}
+		if interval > 0 {
+			i.flushInterval = interval
+		}
+	}
+}
+
+// WithTimeout sets the timeout of the batch insert. Default is 30s.
+func WithTimeout(to time.Duration) Option {
+	return func(i *Inserter) {
+		if to > 0 {
+			i.timeout = to
+		}
+	}
+}
+
+// Inserter inserts positions to the table by native batches. Positions are batched by the dispatcher,
+// the batch is reported as delivered when it is sent, failed insert is returned to the dispatcher
+// to retry the batch.
+type Inserter struct {
+	conn Conn
+
+	table         string
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	now           func() time.Time
+
+	// mu is held for reading by inserts, so the connection is closed after them.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewInserter creates a new inserter of the connection.
+func NewInserter(conn Conn, opts ...Option) (*Inserter, error) {
+	if conn == nil {
+		return nil, errors.New("no connection")
+	}
+	i := &Inserter{
+		conn:          conn,
+		table:         DefaultTable,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		timeout:       defaultTimeout,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+func (i *Inserter) String() string {
+	return Name
+}
+
+func (i *Inserter) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionsReceived, Name): i,
+	}
+}
+
+// Batch implements ev.Batcher.
+func (i *Inserter) Batch() (int, time.Duration) {
+	return i.batchSize, i.flushInterval
+}
+
+// Handle inserts the batch of positions.
+func (i *Inserter) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionsReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	poss := eve.Positions()
+	if len(poss) == 0 {
+		return fmt.Errorf("%w: positions not specified", ev.ErrPermanent)
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.closed {
+		return ErrClosed
+	}
+
+	serverTime := i.now().UTC()
+	rows := make([]Row, len(poss))
+	for n, pos := range poss {
+		rows[n] = NewRow(pos, serverTime)
+	}
+	return i.insert(rows)
+}
+
+func (i *Inserter) insert(rows []Row) error {
+	ctx, cancel := context.WithTimeout(context.Background(), i.timeout)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (%s)", i.table, strings.Join(Columns, ", "))
+	b, err := i.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+	for _, r := range rows {
+		if err = b.Append(r.Values()...); err != nil {
+			_ = b.Abort()
+			return fmt.Errorf("append position: %w", err)
+		}
+	}
+	if err = b.Send(); err != nil {
+		return fmt.Errorf("insert %d positions to %s: %w", len(rows), i.table, err)
+	}
+	return nil
+}
+
+// Close waits for the insert in progress and closes the connection, batches are not handled after it.
+func (i *Inserter) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return nil
+	}
+	i.closed = true
+	if err := i.conn.Close(); err != nil {
+		return fmt.Errorf("close clickhouse connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+// batch records appended rows, the rest of driver.Batch is not used by the inserter.
+type batch struct {
+	driver.Batch
+	conn *conn
+	rows [][]any
+}
+
+func (b *batch) Append(v ...any) error {
+	b.rows = append(b.rows, v)
+	return nil
+}
+
+func (b *batch) Abort() error {
+	return nil
+}
+
+func (b *batch) Send() error {
+	if b.conn.gate != nil {
+		<-b.conn.gate
+	}
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	if b.conn.err != nil {
+		return b.conn.err
+	}
+	if b.conn.closed {
+		return errors.New("connection closed")
+	}
+	b.conn.batches = append(b.conn.batches, b.rows)
+	return nil
+}
+
+// conn records sent batches, sending fails with err or waits for the gate if it is set.
+type conn struct {
+	mu      sync.Mutex
+	queries []string
+	batches [][][]any
+	err     error
+	gate    chan struct{}
+	closed  bool
+}
+
+func (c *conn) PrepareBatch(_ context.Context, query string, _ ...driver.PrepareBatchOption) (driver.Batch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, query)
+	return &batch{conn: c}, nil
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *conn) sent() [][][]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batches
+}
+
+func batchEvent(devices ...string) *ev.GenericEvent {
+	poss := make([]common.Position, 0, len(devices))
+	for _, dev := range devices {
+		poss = append(poss, common.Position{Protocol: "egts", DeviceID: dev})
+	}
+	e := new(ev.GenericEvent)
+	e.SetPositions(poss)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionsReceived, Name))
+	return e
+}
+
+func TestInserter_Batch(t *testing.T) {
+	c := new(conn)
+	ins, err := NewInserter(c, WithTable("fleet.positions"))
+	require.NoError(t, err)
+	defer ins.Close()
+
+	require.NoError(t, ins.Handle(batchEvent("1", "2", "3")))
+
+	batches := c.sent()
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 3)
+	devices := make([]any, 0, 3)
+	for _, row := range batches[0] {
+		require.Len(t, row, len(Columns))
+		devices = append(devices, row[0])
+	}
+	assert.Equal(t, []any{"1", "2", "3"}, devices)
+	assert.Equal(t, "INSERT INTO fleet.positions (device, protocol, fix_time, server_time, valid, latitude, longitude, "+
+		"altitude, speed, course, mcc, mnc, lac, cell_id, odometer, sats, hdop, vdop, pdop, navsys, move, dinput, doutput, "+
+		"attributes)", c.queries[0])
+}
+
+func TestInserter_Dispatcher(t *testing.T) {
+	c := new(conn)
+	ins, err := NewInserter(c, WithBatch(1000, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer ins.Close()
+
+	l := zerolog.Nop()
+	d := ev.NewDispatcher(l, time.Minute)
+	d.RegisterEventSubscriber(ins)
+	poss := make([]common.Position, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		poss = append(poss, common.Position{Protocol: "egts", DeviceID: strconv.Itoa(i % 300)})
+	}
+	d.DispatchPositions(&l, poss)
+	assert.Equal(t, ev.Stats{Delivered: 3000}, d.Shutdown(context.Background()))
+
+	// batches are not limited by the number of dispatcher workers.
+	batches := c.sent()
+	assert.LessOrEqual(t, len(batches), 10)
+	n := 0
+	for _, b := range batches {
+		assert.LessOrEqual(t, len(b), 1000)
+		n += len(b)
+	}
+	assert.Equal(t, 3000, n)
+}
+
+func TestInserter_Error(t *testing.T) {
+	c := &conn{err: errors.New("connection refused")}
+	ins, err := NewInserter(c)
+	require.NoError(t, err)
+	defer ins.Close()
+
+	assert.ErrorContains(t, ins.Handle(batchEvent("1")), "connection refused")
+}
+
+func TestInserter_Close(t *testing.T) {
+	ins, err := NewInserter(new(conn))
+	require.NoError(t, err)
+	require.NoError(t, ins.Close())
+	assert.ErrorIs(t, ins.Handle(batchEvent("1")), ErrClosed)
+
+	// the connection is closed after the insert in progress.
+	c := &conn{gate: make(chan struct{})}
+	ins, err = NewInserter(c)
+	require.NoError(t, err)
+	inserted := make(chan error, 1)
+	go func() {
+		inserted <- ins.Handle(batchEvent("1"))
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.queries) == 1
+	}, time.Second, time.Millisecond)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- ins.Close()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(c.gate)
+	require.NoError(t, <-inserted)
+	require.NoError(t, <-closed)
+	assert.Len(t, c.sent(), 1)
+}
+
+func TestNewRow_Ints(t *testing.T) {
+	// integer attributes of any kind are typed columns.
+	for _, v := range []any{int8(3), int16(3), int32(3), int64(3), int(3), uint8(3), uint16(3), uint32(3), uint64(3), uint(3)} {
+		r := NewRow(common.Position{Attributes: common.Attributes{common.DigInput: v, common.Odometer: v}}, time.Now())
+		if assert.NotNil(t, r.DigInput, "%T", v) {
+			assert.Equal(t, int64(3), *r.DigInput, "%T", v)
+		}
+		if assert.NotNil(t, r.Odometer, "%T", v) {
+			assert.Equal(t, 3.0, *r.Odometer, "%T", v)
+		}
+		assert.Empty(t, r.Attributes, "%T", v)
+	}
+	r := NewRow(common.Position{Attributes: common.Attributes{common.DigInput: uint64(math.MaxUint64)}}, time.Now())
+	assert.Nil(t, r.DigInput)
+	assert.Equal(t, "18446744073709551615", r.Attributes[common.DigInput])
+
+	// fractional value is not an integer.
+	r = NewRow(common.Position{Attributes: common.Attributes{common.Satellites: 7.5}}, time.Now())
+	assert.Nil(t, r.Sats)
+	assert.Equal(t, "7.5", r.Attributes[common.Satellites])
+}
+
+func TestNewRow_Replayed(t *testing.T) {
+	// positions replayed from the outbox or the spill file are decoded from JSON.
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	pos := common.Position{
+		DeviceID:   "867",
+		DeviceTime: at,
+		Attributes: common.Attributes{
+			common.Satellites: int64(7),
+			common.NavSystem:  int64(3),
+			common.Move:       int64(1),
+			common.DigInput:   int64(5),
+			common.DigOutput:  int64(2),
+			"io_239":          int64(1),
+		},
+	}
+	b, err := json.Marshal(pos)
+	require.NoError(t, err)
+	var replayed common.Position
+	require.NoError(t, json.Unmarshal(b, &replayed))
+
+	live := NewRow(pos, at)
+	assert.Equal(t, int64(7), *live.Sats)
+	assert.Equal(t, live, NewRow(replayed, at))
+}
+
+func TestNewRow(t *testing.T) {
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	pos := common.Position{
+		Protocol:   "teltonika",
+		DeviceID:   "867",
+		DeviceTime: at,
+		Speed:      null.FloatFrom(42.5),
+		Cellular:   &common.Cellular{CellID: 1, LAC: 2, MCC: 250, MNC: 1},
+		Attributes: common.Attributes{
+			common.Odometer:   int64(1200),
+			common.Satellites: int64(7),
+			common.HDOP:       0.9,
+			common.Move:       "yes",
+			"event":           "ignition",
+			"io_239":          int64(1),
+		},
+	}
+	pos.Valid = true
+	pos.X, pos.Y = 37.6177, 55.7558
+
+	r := NewRow(pos, at.Add(time.Second))
+	f := func(v float64) *float64 { return &v }
+	i := func(v int64) *int64 { return &v }
+	assert.Equal(t, Row{
+		Device:     "867",
+		Protocol:   "teltonika",
+		FixTime:    at,
+		ServerTime: at.Add(time.Second),
+		Valid:      true,
+		Latitude:   55.7558,
+		Longitude:  37.6177,
+		Speed:      f(42.5),
+		MCC:        i(250),
+		MNC:        i(1),
+		LAC:        i(2),
+		CellID:     i(1),
+		Odometer:   f(1200),
+		Sats:       i(7),
+		HDOP:       f(0.9),
+		// the value of the unexpected type is kept in attributes.
+		Attributes: map[string]string{common.Move: "yes", "event": "ignition", "io_239": "1"},
+	}, r)
+}
+
+// TestMigration checks the table has columns of the inserter in the same order.
+func TestMigration(t *testing.T) {
+	ddl, err := os.ReadFile("migrations/00000001_create_positions.up.sql")
+	require.NoError(t, err)
+	var cols []string
+	for _, m := range regexp.MustCompile(`(?m)^\s{4}(\w+)\s`).FindAllStringSubmatch(string(ddl), -1) {
+		cols = append(cols, m[1])
+	}
+	assert.Equal(t, Columns, cols)
+	assert.True(t, strings.Contains(string(ddl), "order by (device, fix_time)"))
+}
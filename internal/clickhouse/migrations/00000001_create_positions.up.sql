@@ -0,0 +1,30 @@
+create table if not exists positions
+(
+    device      String,
+    protocol    LowCardinality(String),
+    fix_time    DateTime64(3, 'UTC'),
+    server_time DateTime64(3, 'UTC'),
+    valid       Bool,
+    latitude    Float64,
+    longitude   Float64,
+    altitude    Float64,
+    speed       Nullable(Float64),
+    course      Nullable(Float64),
+    mcc         Nullable(Int64),
+    mnc         Nullable(Int64),
+    lac         Nullable(Int64),
+    cell_id     Nullable(Int64),
+    odometer    Nullable(Float64),
+    sats        Nullable(Int64),
+    hdop        Nullable(Float64),
+    vdop        Nullable(Float64),
+    pdop        Nullable(Float64),
+    navsys      Nullable(Int64),
+    move        Nullable(Int64),
+    dinput      Nullable(Int64),
+    doutput     Nullable(Int64),
+    attributes  Map(LowCardinality(String), String)
+)
+engine = MergeTree
+partition by toYYYYMM(fix_time)
+order by (device, fix_time);
@@ -0,0 +1,80 @@
+// Package encoding provides the wire formats of positions published by subscribers to external systems.
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"gopkg.in/guregu/null.v4"
+)
+
+// JSONName is the name of JSON encoding.
+const JSONName = "json"
+
+// Encoder encodes positions for the wire.
+type Encoder interface {
+	// Encode returns the wire representation of the position.
+	Encode(pos common.Position) ([]byte, error)
+	// ContentType returns MIME type of encoded positions.
+	ContentType() string
+}
+
+// Lookup returns the encoder by name, JSON encoder is returned for empty name.
+func Lookup(name string) (Encoder, error) {
+	switch name {
+	case "", JSONName:
+		return JSON{}, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+// Message is the position on the wire.
+type Message struct {
+	Device     string            `json:"device"`
+	Protocol   string            `json:"protocol"`
+	Time       time.Time         `json:"time"`
+	Valid      bool              `json:"valid"`
+	Lat        float64           `json:"lat"`
+	Lon        float64           `json:"lon"`
+	Alt        float64           `json:"alt"`
+	Speed      null.Float        `json:"speed"`
+	Course     null.Float        `json:"course"`
+	Cellular   *common.Cellular  `json:"cellular,omitempty"`
+	Attributes common.Attributes `json:"attributes,omitempty"`
+}
+
+// NewMessage creates the wire message of the position.
+func NewMessage(pos common.Position) Message {
+	return Message{
+		Device:     pos.DeviceID,
+		Protocol:   pos.Protocol,
+		Time:       pos.DeviceTime,
+		Valid:      pos.Valid,
+		Lat:        pos.Y,
+		Lon:        pos.X,
+		Alt:        pos.Z,
+		Speed:      pos.Speed,
+		Course:     pos.Course,
+		Cellular:   pos.Cellular,
+		Attributes: pos.Attributes,
+	}
+}
+
+// JSON encodes positions as JSON Message.
+type JSON struct{}
+
+// Encode implements Encoder.
+func (JSON) Encode(pos common.Position) ([]byte, error) {
+	b, err := json.Marshal(NewMessage(pos))
+	if err != nil {
+		return nil, fmt.Errorf("marshal position: %w", err)
+	}
+	return b, nil
+}
+
+// ContentType implements Encoder.
+func (JSON) ContentType() string {
+	return "application/json"
+}
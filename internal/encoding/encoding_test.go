@@ -0,0 +1,43 @@
+package encoding
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestJSON_Encode(t *testing.T) {
+	pos := common.Position{
+		DeviceID:   "866795037163746",
+		Protocol:   "wialonips",
+		DeviceTime: time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC),
+		Speed:      null.FloatFrom(42.5),
+		Attributes: common.Attributes{common.Satellites: 7},
+	}
+	pos.Valid = true
+	pos.X, pos.Y, pos.Z = 37.6177, 55.7558, 150
+
+	enc, err := Lookup("")
+	require.NoError(t, err)
+	b, err := enc.Encode(pos)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"device": "866795037163746",
+		"protocol": "wialonips",
+		"time": "2023-04-01T10:30:00Z",
+		"valid": true,
+		"lat": 55.7558,
+		"lon": 37.6177,
+		"alt": 150,
+		"speed": 42.5,
+		"course": null,
+		"attributes": {"sats": 7}
+	}`, string(b))
+
+	_, err = Lookup("xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+)
+
+// AckMode is the condition of the position to be committed, so the device can be acknowledged.
+type AckMode string
+
+const (
+	// AckNone acknowledges the device before delivery.
+	AckNone AckMode = "none"
+	// AckAll waits for all subscribers to handle the position.
+	AckAll AckMode = "all"
+	// AckQuorum waits for the quorum of subscribers to handle the position.
+	AckQuorum AckMode = "quorum"
+	// AckDurable waits for the position to be written to the outbox and synced to disk.
+	AckDurable AckMode = "durable"
+)
+
+// Valid reports whether the mode is known.
+func (m AckMode) Valid() bool {
+	switch m {
+	case AckNone, AckAll, AckQuorum, AckDurable:
+		return true
+	}
+	return false
+}
+
+var (
+	// ErrNotCommitted is returned when too many subscribers failed to handle the position.
+	ErrNotCommitted = errors.New("position is not committed")
+	// ErrNoOutbox is returned in durable mode without the outbox.
+	ErrNoOutbox = errors.New("no outbox")
+	// ErrPermanent is wrapped by errors of subscribers the position is never handled with,
+	// e.g. rejected by the consumer. Such positions are not retried until the timeout, positions kept
+	// in the outbox are moved to its dead letter file after max attempts.
+	ErrPermanent = errors.New("permanent error")
+
+	errDropped = errors.New("dropped by overflow policy")
+	errSpilled = errors.New("spilled by overflow policy")
+)
+
+// WithAck sets the mode of committing positions by Commit, quorum is used in AckQuorum mode only.
+// Default is AckNone.
+func WithAck(mode AckMode, quorum int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if mode.Valid() {
+			d.ackMode = mode
+		}
+		d.quorum = quorum
+	}
+}
+
+// commit tracks the results of delivering the position to subscribers.
+type commit struct {
+	need  int
+	allow int
+	// off is the offset of the position in the outbox in AckDurable mode.
+	off uint64
+
+	mu        sync.Mutex
+	succeeded int
+	failed    int
+	err       error
+	done      chan struct{}
+}
+
+// newCommit creates the commit resolved by need successful deliveries out of total.
+func newCommit(need, total int) *commit {
+	c := &commit{need: need, allow: total - need, done: make(chan struct{})}
+	if need <= 0 {
+		c.resolve(nil)
+	}
+	return c
+}
+
+// report counts the result of the delivery, it is safe to call on nil commit.
+func (c *commit) report(err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.succeeded++
+		if c.succeeded == c.need {
+			c.resolve(nil)
+		}
+		return
+	}
+	c.failed++
+	if c.failed == c.allow+1 {
+		c.resolve(fmt.Errorf("%w: %w", ErrNotCommitted, err))
+	}
+}
+
+func (c *commit) resolve(err error) {
+	select {
+	case <-c.done:
+	default:
+		c.err = err
+		close(c.done)
+	}
+}
+
+func (c *commit) wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrNotCommitted, ctx.Err())
+	}
+}
+
+// Committing reports whether Commit waits for positions to be committed.
+func (d *Dispatcher) Committing() bool {
+	return d.ackMode != AckNone
+}
+
+// Commit dispatches positions and waits until all of them are committed according to the ack mode
+// or the context is done. It is DispatchPositions in AckNone mode.
+// Positions not committed are still delivered, so the device retransmitting them may cause duplicates.
+func (d *Dispatcher) Commit(ctx context.Context, l *zerolog.Logger, poss []common.Position) error {
+	if !d.Committing() {
+		d.DispatchPositions(l, poss)
+		return nil
+	}
+
+	commits := make([]*commit, 0, len(poss))
+	for _, pos := range poss {
+		commits = append(commits, d.dispatch(l, pos, d.ackMode))
+	}
+	if d.ackMode == AckDurable {
+		d.sync(commits)
+	}
+	for _, c := range commits {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync commits appended positions when the outbox is synced to disk, so they survive the power failure.
+// Syncs of concurrent commits are grouped by the outbox.
+func (d *Dispatcher) sync(commits []*commit) {
+	var off uint64
+	for _, c := range commits {
+		off = max(off, c.off)
+	}
+	if off == 0 {
+		return
+	}
+	err := d.outbox.Sync(off)
+	for _, c := range commits {
+		if c.off != 0 {
+			c.report(err)
+		}
+	}
+}
+
+// need returns the number of subscribers the position shall be delivered to.
+func (d *Dispatcher) need(mode AckMode, subscribers int) int {
+	switch mode {
+	case AckAll:
+		return subscribers
+	case AckQuorum:
+		return min(d.quorum, subscribers)
+	}
+	return 0
+}
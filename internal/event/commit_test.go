@@ -0,0 +1,66 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/outbox"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher_Commit(t *testing.T) {
+	l := zerolog.Nop()
+	ob, err := outbox.Open(l, t.TempDir())
+	require.NoError(t, err)
+	defer ob.Close()
+
+	tests := []struct {
+		name    string
+		opts    []DispatcherOption
+		wantErr error
+	}{
+		{name: "none", opts: []DispatcherOption{WithAck(AckNone, 0)}},
+		{name: "all", opts: []DispatcherOption{WithAck(AckAll, 0)}, wantErr: ErrNotCommitted},
+		{name: "quorum", opts: []DispatcherOption{WithAck(AckQuorum, 1)}},
+		{name: "quorum of all", opts: []DispatcherOption{WithAck(AckQuorum, 2)}, wantErr: ErrNotCommitted},
+		{name: "durable", opts: []DispatcherOption{WithAck(AckDurable, 0), WithOutbox(ob)}},
+		{name: "durable without outbox", opts: []DispatcherOption{WithAck(AckDurable, 0)}, wantErr: ErrNoOutbox},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// db fails until the dispatcher timeout.
+			d := NewDispatcher(l, 50*time.Millisecond, tt.opts...)
+			d.RegisterEventSubscriber(&subscriber{name: "mqtt"})
+			d.RegisterEventSubscriber(&subscriber{name: "db", err: errors.New("fake")})
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			// failed positions are retried from the outbox until shutdown.
+			defer d.Shutdown(ctx)
+
+			err := d.Commit(ctx, &l, positions(1, 2))
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		sub := &subscriber{gate: make(chan struct{})}
+		d := NewDispatcher(l, time.Minute, WithAck(AckAll, 0))
+		d.RegisterEventSubscriber(sub)
+		defer d.Shutdown(context.Background())
+		defer close(sub.gate)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := d.Commit(ctx, &l, positions(1, 1))
+		assert.ErrorIs(t, err, ErrNotCommitted)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
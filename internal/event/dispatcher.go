@@ -0,0 +1,640 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/outbox"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+)
+
+const (
+	eventManagerName = "events manager"
+)
+
+const (
+	defaultQueueSize   = 1000
+	defaultWorkers     = 4
+	defaultMaxAttempts = 3
+	// permanentDelay is the delay of the next attempt of the position failed with permanent error.
+	permanentDelay = time.Second
+)
+
+// Stats are the counters of the dispatcher deliveries.
+type Stats struct {
+	// Delivered is the number of events handled by subscribers.
+	Delivered int64
+	// Failed is the number of events not handled by subscribers until timeout or shutdown.
+	Failed int64
+	// Pending is the number of events queued, spilled included, or being delivered.
+	Pending int64
+	// Dropped is the number of events dropped by drop-oldest overflow policy.
+	Dropped int64
+	// Spilled is the number of events in spill files.
+	Spilled int64
+	// Unacked is the number of events kept in the outbox until they are delivered.
+	Unacked int64
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (s Stats) MarshalZerologObject(e *zerolog.Event) {
+	e.Int64("delivered", s.Delivered)
+	e.Int64("failed", s.Failed)
+	e.Int64("pending", s.Pending)
+	e.Int64("dropped", s.Dropped)
+	e.Int64("spilled", s.Spilled)
+	e.Int64("unacked", s.Unacked)
+}
+
+// DispatcherOption is a functional option for the dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithQueueSize sets the number of positions queued in memory for every subscriber. Default is 1000.
+func WithQueueSize(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.queueSize = n
+		}
+	}
+}
+
+// WithWorkers sets the number of concurrent deliveries for every subscriber, positions of a device are
+// delivered one at a time anyway. Default is 4.
+func WithWorkers(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.workers = n
+		}
+	}
+}
+
+// WithOverflow sets the policy of the full subscriber queue, spill policy needs the spill directory.
+// Default is OverflowBlock.
+func WithOverflow(o Overflow) DispatcherOption {
+	return func(d *Dispatcher) {
+		if o.Valid() {
+			d.overflow = o
+		}
+	}
+}
+
+// WithSpillDir sets the directory of spill files named after subscribers.
+func WithSpillDir(dir string) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.spillDir = dir
+	}
+}
+
+// WithOutbox sets the outbox every position is appended to before delivery.
+// Positions are retried until they are delivered or the dispatcher is shut down,
+// positions not delivered are replayed from the outbox after restart.
+// The outbox is not closed by the dispatcher.
+func WithOutbox(o *outbox.Outbox) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.outbox = o
+	}
+}
+
+// WithMaxAttempts sets the number of attempts to deliver the position kept in the outbox which fails
+// with ErrPermanent, then the position is moved to the dead letter file of the outbox and acked,
+// so it holds up neither positions of the device nor compaction of the outbox. Default is 3.
+func WithMaxAttempts(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.maxAttempts = n
+		}
+	}
+}
+
+// Batcher is implemented by subscribers handling positions by batches, e.g. bulk inserts.
+// Positions of the batcher listening to PositionsReceived event are collected up to size
+// or for the interval since the first one and fired by one event. The batch is committed,
+// acked in the outbox and retried as a whole, positions of a device keep their order within it.
+type Batcher interface {
+	Batch() (size int, interval time.Duration)
+}
+
+// Dispatcher fans out events to the registered subscribers.
+// Every subscriber gets its own copy of the event named "<event>.<subscriber>".
+// Positions are delivered from the bounded queue of the subscriber by the pool of workers,
+// so a slow subscriber holds up neither other subscribers nor memory.
+// Positions of the same device are delivered to the subscriber one by one in the order they are dispatched,
+// retries included, positions of different devices are delivered concurrently.
+type Dispatcher struct {
+	logger    zerolog.Logger
+	timeout   time.Duration
+	evManager *event.Manager
+	// ctx is the parent of delivery contexts, it is canceled when shutdown is timed out.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queueSize   int
+	workers     int
+	overflow    Overflow
+	spillDir    string
+	outbox      *outbox.Outbox
+	maxAttempts int
+	ackMode     AckMode
+	quorum      int
+
+	mu        sync.Mutex
+	queues    map[string]*queue
+	closed    atomic.Bool
+	running   sync.WaitGroup
+	delivered atomic.Int64
+	failed    atomic.Int64
+	inflight  atomic.Int64
+}
+
+// NewDispatcher creates a new events dispatcher.
+// Timeout limits the time of retrying to deliver an event to the subscriber.
+func NewDispatcher(l zerolog.Logger, timeout time.Duration, opts ...DispatcherOption) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		logger:      l,
+		timeout:     timeout,
+		evManager:   event.NewManager(eventManagerName),
+		ctx:         ctx,
+		cancel:      cancel,
+		queueSize:   defaultQueueSize,
+		workers:     defaultWorkers,
+		overflow:    OverflowBlock,
+		maxAttempts: defaultMaxAttempts,
+		ackMode:     AckNone,
+		queues:      make(map[string]*queue),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// RegisterEventSubscriber registers the subscriber for the events and starts workers of its queue.
+func (d *Dispatcher) RegisterEventSubscriber(sub event.Subscriber) {
+	d.logger.Debug().Str("consumer-listener", fmt.Sprintf("%s", sub)).Msg("register events subscriber")
+	d.evManager.AddSubscriber(sub)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, name := range d.SubscribersNames() {
+		if _, ok := d.queues[name]; ok {
+			continue
+		}
+		q := newQueue(d.logger, name, d.queueSize, d.overflow, d.openSpill(name))
+		if b, ok := sub.(Batcher); ok && d.evManager.HasListeners(fmt.Sprintf("%s.%s", PositionsReceived, name)) {
+			q.batchSize, q.batchWait = b.Batch()
+			q.batchSize = max(q.batchSize, 1)
+		}
+		if d.outbox != nil {
+			q.drop = func(it item) {
+				d.drop(q.name, it)
+			}
+			acked, head := d.outbox.Subscribe(name), d.outbox.Head()
+			if head > acked {
+				q.replay = true
+				d.running.Add(1)
+				go d.replay(q, head)
+			}
+		}
+		d.queues[name] = q
+		d.running.Add(d.workers)
+		for i := 0; i < d.workers; i++ {
+			go d.work(q)
+		}
+	}
+}
+
+// replay queues positions of the outbox not acked by the subscriber up to the head at the start,
+// positions dispatched meanwhile are delivered after them.
+func (d *Dispatcher) replay(q *queue, head uint64) {
+	defer d.running.Done()
+	l := d.logger.With().Str("subscriber", q.name).Logger()
+	l.Info().Uint64("to", head).Msg("replay outbox")
+	err := d.outbox.Replay(q.name, head, func(off uint64, pos common.Position) error {
+		return q.pushReplayed(item{l: &l, off: off, pos: pos})
+	})
+	if errors.Is(err, ErrQueueClosed) {
+		l.Warn().Err(err).Msg("replay outbox stopped, positions left are replayed after restart")
+		return
+	}
+	if err != nil {
+		l.Error().Err(err).Msg("replay outbox failed, positions left are replayed after restart out of order")
+	}
+	q.endReplay()
+}
+
+func (d *Dispatcher) ack(name string, it item) {
+	if d.outbox != nil && it.off != 0 {
+		d.outbox.Ack(name, it.off)
+	}
+}
+
+// drop moves the position dropped by drop-oldest policy to the dead letter file and acks it,
+// so the cursor of the subscriber is not held up by the gap. The position is acked even if it is
+// not moved, since it is dropped anyway.
+func (d *Dispatcher) drop(name string, it item) {
+	if it.off == 0 {
+		return
+	}
+	d.deadLetter(name, []item{it}, errDropped)
+	d.ack(name, it)
+}
+
+// openSpill opens the spill file of the subscriber, queue falls back to block policy on failure.
+// Spilled positions are replayed from the outbox if any, so they are cleared.
+func (d *Dispatcher) openSpill(name string) *spill {
+	if d.overflow != OverflowSpill {
+		return nil
+	}
+	l := d.logger.With().Str("subscriber", name).Logger()
+	if err := os.MkdirAll(d.spillDir, 0o755); err != nil {
+		l.Error().Err(err).Msg("create spill directory, queue falls back to block policy")
+		return nil
+	}
+	sp, err := openSpill(filepath.Join(d.spillDir, name+".spill"))
+	if err != nil {
+		l.Error().Err(err).Msg("open spill file, queue falls back to block policy")
+		return nil
+	}
+	if d.outbox != nil {
+		if err = sp.clear(); err != nil {
+			l.Error().Err(err).Msg("clear spill file")
+		}
+	}
+	if sp.len() > 0 {
+		l.Info().Int("positions", sp.len()).Msg("replay spilled positions")
+	}
+	return sp
+}
+
+// SubscribersNames returns the names of the registered subscribers.
+func (d *Dispatcher) SubscribersNames() []string {
+	events := d.evManager.ListenedNames()
+	set := make(map[string]struct{}, len(events))
+	for n := range events {
+		names := strings.Split(n, ".")
+		name := names[len(names)-1]
+		if _, ok := set[name]; !ok {
+			set[name] = struct{}{}
+		}
+	}
+	listeners := make([]string, 0)
+	for n := range set {
+		listeners = append(listeners, n)
+	}
+	return listeners
+}
+
+func (d *Dispatcher) queuesList() []*queue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	qs := make([]*queue, 0, len(d.queues))
+	for _, q := range d.queues {
+		qs = append(qs, q)
+	}
+	return qs
+}
+
+// DispatchPositions queues PositionReceived event for every position to every subscriber.
+// Delivery is asynchronous and is retried until the dispatcher timeout or shutdown with the outbox.
+// Full queue blocks the call, drops the oldest position or spills to disk according to the overflow policy.
+// Positions dispatched after shutdown are dropped.
+func (d *Dispatcher) DispatchPositions(l *zerolog.Logger, poss []common.Position) {
+	for _, pos := range poss {
+		d.dispatch(l, pos, AckNone)
+	}
+}
+
+// dispatch appends the position to the outbox and queues it to every subscriber.
+// It returns the commit of the position according to the mode, it is nil in AckNone mode.
+func (d *Dispatcher) dispatch(l *zerolog.Logger, pos common.Position, mode AckMode) (c *commit) {
+	qs := d.queuesList()
+	it := item{l: l, pos: pos}
+	switch mode {
+	case AckAll, AckQuorum:
+		c = newCommit(d.need(mode, len(qs)), len(qs))
+		it.commit = c
+	case AckDurable:
+		c = newCommit(1, 1)
+	}
+
+	var err error
+	switch {
+	case d.closed.Load():
+		err = ErrQueueClosed
+	case d.outbox == nil:
+		err = ErrNoOutbox
+	default:
+		if it.off, err = d.outbox.Append(pos); err != nil {
+			l.Error().Err(err).Object("position", pos).Msg("append position to outbox")
+		}
+	}
+	if mode == AckDurable {
+		// appended position is committed by Commit when the outbox is synced.
+		c.off = it.off
+		if err != nil {
+			c.report(err)
+		}
+	}
+
+	for _, q := range qs {
+		if err = q.push(it); err != nil {
+			d.failed.Add(1)
+			it.commit.report(err)
+			l.Warn().Err(err).Str("subscriber", q.name).Object("position", pos).Msg("position dropped")
+		}
+	}
+	return c
+}
+
+// dispatchEvent queues the item of the event other than position to subscribers listening to it.
+func (d *Dispatcher) dispatchEvent(it item) {
+	for _, q := range d.queuesList() {
+		if !d.evManager.HasListeners(fmt.Sprintf("%s.%s", it.event, q.name)) {
+			continue
+		}
+		if err := q.push(it); err != nil {
+			d.failed.Add(1)
+			it.l.Warn().Err(err).Str("subscriber", q.name).Str("event", string(it.event)).Msg("event dropped")
+		}
+	}
+}
+
+// work delivers positions of the queue until it is closed and empty or the shutdown is timed out.
+// Positions kept in the outbox are retried until delivered, they are left in the outbox on shutdown.
+// Positions failing with ErrPermanent are moved to the dead letter file after max attempts.
+// Other positions of the spilling queue interrupted by the shutdown are returned to the queue to persist them.
+func (d *Dispatcher) work(q *queue) {
+	defer d.running.Done()
+	for d.ctx.Err() == nil {
+		its, ok := q.collect()
+		if !ok {
+			return
+		}
+		d.inflight.Add(int64(len(its)))
+		first := d.deliver(q, its)
+		for i := range its {
+			its[i].commit.report(first)
+			its[i].commit = nil
+		}
+		err, kept := first, make([]item, 0, len(its))
+		for _, it := range its {
+			if it.off != 0 {
+				kept = append(kept, it)
+			}
+		}
+		dead := false
+		for attempts := 1; err != nil && len(kept) > 0 && d.ctx.Err() == nil; {
+			if errors.Is(err, ErrPermanent) {
+				if attempts >= d.maxAttempts {
+					if dead = d.deadLetter(q.name, kept, err); dead {
+						break
+					}
+				}
+				attempts++
+				d.sleep(permanentDelay)
+			}
+			kept[0].l.Warn().Err(err).Uint64("offset", kept[0].off).Int("positions", len(kept)).
+				Msg("position is kept in outbox, retry delivery")
+			err = d.deliver(q, kept)
+		}
+		d.inflight.Add(-int64(len(its)))
+		var front []item
+		for _, it := range its {
+			switch {
+			case first == nil || it.off != 0 && err == nil:
+				d.delivered.Add(1)
+				d.ack(q.name, it)
+			case it.off != 0 && dead:
+				d.failed.Add(1)
+				d.ack(q.name, it)
+			case it.off != 0:
+				// position is replayed from the outbox after restart.
+			case d.ctx.Err() != nil && q.spill != nil:
+				front = append(front, it)
+			default:
+				d.failed.Add(1)
+			}
+		}
+		for i := len(front) - 1; i >= 0; i-- {
+			q.pushFront(front[i])
+		}
+		q.release(its...)
+	}
+}
+
+// deadLetter moves positions failed permanently to the dead letter file of the outbox.
+func (d *Dispatcher) deadLetter(name string, its []item, cause error) bool {
+	for _, it := range its {
+		if err := d.outbox.DeadLetter(name, it.off, it.pos, cause); err != nil {
+			it.l.Error().Err(err).Uint64("offset", it.off).Msg("move position to dead letter file")
+			return false
+		}
+		it.l.Error().Err(cause).Str("subscriber", name).Uint64("offset", it.off).Object("position", it.pos).
+			Msg("position is moved to dead letter file")
+	}
+	return true
+}
+
+// sleep waits for the delay or the shutdown timeout.
+func (d *Dispatcher) sleep(delay time.Duration) {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-d.ctx.Done():
+	}
+}
+
+// deliver fires the event of the item or PositionsReceived event of positions to the batching subscriber.
+func (d *Dispatcher) deliver(q *queue, its []item) error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+	it := its[0]
+	e := new(GenericEvent)
+	switch {
+	case it.session != nil:
+		e.SetSession(*it.session)
+	case it.frameErr != nil:
+		e.SetFrameError(*it.frameErr)
+	case q.batchSize > 0:
+		poss := make([]common.Position, len(its))
+		for i := range its {
+			poss[i] = its[i].pos
+		}
+		e.SetPositions(poss)
+		e.SetName(fmt.Sprintf("%s.%s", PositionsReceived, q.name))
+		ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+		defer cancel()
+		return d.Fire(ctx, &q.logger, e)
+	default:
+		e.SetPosition(it.pos)
+	}
+	e.SetName(fmt.Sprintf("%s.%s", it.name(), q.name))
+
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+	return d.Fire(ctx, it.l, e)
+}
+
+// DispatchClose fires CloseConnection event to every subscriber and waits for its delivery.
+func (d *Dispatcher) DispatchClose(l *zerolog.Logger) {
+	for _, name := range d.SubscribersNames() {
+		e := new(GenericEvent)
+		e.SetName(fmt.Sprintf("%s.%s", CloseConnection, name))
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		_ = d.Fire(ctx, l, e)
+		cancel()
+	}
+}
+
+// Shutdown stops accepting new events and waits for queued deliveries until the context is done,
+// deliveries still pending are canceled then and persisted to spill files if the queue spills
+// or left in the outbox.
+// Finally, CloseConnection event is fired.
+func (d *Dispatcher) Shutdown(ctx context.Context) Stats {
+	if !d.closed.CompareAndSwap(false, true) {
+		return d.Stats()
+	}
+	qs := d.queuesList()
+	for _, q := range qs {
+		q.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.logger.Warn().Int64("pending", d.Stats().Pending).Msg("pending deliveries are canceled")
+		d.cancel()
+		<-done
+	}
+	for _, q := range qs {
+		d.failed.Add(int64(q.flush(d.outbox != nil)))
+	}
+	d.DispatchClose(&d.logger)
+	return d.Stats()
+}
+
+// Stats returns the counters of deliveries.
+func (d *Dispatcher) Stats() Stats {
+	s := Stats{Delivered: d.delivered.Load(), Failed: d.failed.Load(), Pending: d.inflight.Load()}
+	for _, qs := range d.Queues() {
+		s.Pending += int64(qs.Depth)
+		s.Dropped += qs.Dropped
+		s.Spilled += int64(qs.Spilled)
+		s.Unacked += int64(qs.Unacked)
+	}
+	return s
+}
+
+// Queues returns the metrics of the subscribers queues by subscriber name.
+func (d *Dispatcher) Queues() map[string]QueueStats {
+	qs := d.queuesList()
+	m := make(map[string]QueueStats, len(qs))
+	for _, q := range qs {
+		s := q.stats()
+		if d.outbox != nil {
+			s.Unacked = d.outbox.Unacked(q.name)
+		}
+		m[q.name] = s
+	}
+	return m
+}
+
+// Fire delivers the event to the subscribers, failed delivery is retried with exponential backoff
+// until the context is done. The error of the context is returned if the event is not delivered,
+// ErrPermanent failure is returned at once.
+func (d *Dispatcher) Fire(ctx context.Context, l *zerolog.Logger, event event.Event) error {
+	reply := make(chan Reply)
+	retrying := d.retryFire(ctx, d.evManager.FireEvent, reply)
+
+	// reply is closed by the retrying goroutine, so it is read out until the retrying is finished.
+	go func() {
+		defer close(reply)
+		err := retrying(event)
+		if err != nil {
+			l.Err(err).Msg("retrying to fire event")
+		}
+	}()
+
+	var err error
+	for r := range reply {
+		if r.Error == nil {
+			l.Info().Msg(r.Message)
+		} else {
+			l.Err(r.Error).Msg(r.Message)
+		}
+		err = r.Error
+	}
+	return err
+}
+
+type fireraiser func(event event.Event) error
+
+func (d *Dispatcher) retryFire(ctx context.Context, fireraiser fireraiser, reply chan Reply) fireraiser {
+	return func(evnt event.Event) error {
+		for try := 1; ; try++ {
+			err := fireraiser(evnt)
+			if err == nil {
+				reply <- Reply{
+					Message: fmt.Sprintf(`successful handle "%s" event`, evnt.Name()),
+				}
+				return nil
+			}
+			if errors.Is(err, ErrPermanent) {
+				reply <- Reply{
+					Error:   err,
+					Message: fmt.Sprintf(`event "%s" failed permanently`, evnt.Name()),
+				}
+				return err
+			}
+
+			/*
+				info: in this place, by creating a new event through the fireraiser, you can call the event of some notifier to notify about an error
+
+				go func(){
+					for _, name := range d.SubscribersNames() {
+						e := new(GenericEvent)
+						e.SetName(fmt.Sprintf("%s.%s", NotifyError, name))
+						e.SetData(event.M{"message": fmt.Sprintf(`event "%s" failed attempt #[%d]`, evnt.Name(), try)})
+						if err := fireraiser(e); err != nil {
+							l.Err(err).Msg("notify error")
+						}
+					}
+
+				}() */
+
+			delay := time.Second << uint(try)
+			timer := time.NewTimer(delay)
+			reply <- Reply{
+				Error:   err,
+				Message: fmt.Sprintf(`event "%s" failed attempt #[%d] | retrying after: [%s]`, evnt.Name(), try, delay),
+			}
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				reply <- Reply{
+					Error:   ctx.Err(),
+					Message: fmt.Sprintf(`retrying event "%s" stopped via context`, evnt.Name()),
+				}
+				return ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/outbox"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriber handles events after delay or the gate is open, failing ones with err
+// (the first failures ones if it is set) or every failEvery attempt. Name of the subscriber is test by default.
+type subscriber struct {
+	name      string
+	delay     time.Duration
+	gate      chan struct{}
+	err       error
+	failures  int
+	failEvery int
+
+	mu        sync.Mutex
+	tries     int
+	attempts  int
+	events    map[string]int
+	positions []common.Position
+}
+
+func (s *subscriber) id() string {
+	if s.name == "" {
+		return "test"
+	}
+	return s.name
+}
+
+func (s *subscriber) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", PositionReceived, s.id()): s,
+		fmt.Sprintf("%s.%s", CloseConnection, s.id()):  s,
+	}
+}
+
+func (s *subscriber) Handle(e event.Event) error {
+	if e.Name() != fmt.Sprintf("%s.%s", CloseConnection, s.id()) {
+		time.Sleep(s.delay)
+		if s.gate != nil {
+			<-s.gate
+		}
+		if s.err != nil && s.fails() {
+			return s.err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failEvery > 0 && s.attempts%s.failEvery == 0 {
+		return errors.New("fake")
+	}
+	if s.events == nil {
+		s.events = make(map[string]int)
+	}
+	s.events[e.Name()]++
+	if pos := e.(*GenericEvent).Position(); pos != nil {
+		s.positions = append(s.positions, *pos)
+	}
+	return nil
+}
+
+// fails reports whether the attempt fails with err.
+func (s *subscriber) fails() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tries++
+	return s.failures == 0 || s.tries <= s.failures
+}
+
+// received returns devices of handled positions.
+func (s *subscriber) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := make([]string, 0, len(s.positions))
+	for _, pos := range s.positions {
+		devices = append(devices, pos.DeviceID)
+	}
+	return devices
+}
+
+// tracks returns sequence numbers of handled positions by device.
+func (s *subscriber) tracks() map[string][]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string][]int)
+	for _, pos := range s.positions {
+		m[pos.DeviceID] = append(m[pos.DeviceID], int(pos.X))
+	}
+	return m
+}
+
+func (s *subscriber) count(name Name) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events[fmt.Sprintf("%s.%s", name, s.id())]
+}
+
+func TestDispatcher_Shutdown(t *testing.T) {
+	l := zerolog.Nop()
+	poss := []common.Position{{DeviceID: "1"}, {DeviceID: "2"}}
+
+	t.Run("waits for pending", func(t *testing.T) {
+		sub := &subscriber{delay: 100 * time.Millisecond}
+		d := NewDispatcher(l, time.Minute)
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, poss)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.Equal(t, Stats{Delivered: 2}, d.Shutdown(ctx))
+		assert.Equal(t, 2, sub.count(PositionReceived))
+		assert.Equal(t, 1, sub.count(CloseConnection))
+	})
+
+	t.Run("cancels pending on timeout", func(t *testing.T) {
+		sub := &subscriber{err: errors.New("fake")}
+		d := NewDispatcher(l, time.Minute)
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, poss)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.Equal(t, Stats{Failed: 2}, d.Shutdown(ctx))
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 1, sub.count(CloseConnection))
+	})
+
+	t.Run("drops after shutdown", func(t *testing.T) {
+		sub := new(subscriber)
+		d := NewDispatcher(l, time.Minute)
+		d.RegisterEventSubscriber(sub)
+		d.Shutdown(context.Background())
+		d.DispatchPositions(&l, poss)
+
+		assert.Equal(t, Stats{Failed: 2}, d.Stats())
+		assert.Equal(t, 0, sub.count(PositionReceived))
+	})
+}
+
+func TestDispatcher_Timeout(t *testing.T) {
+	// Timeout of the subscriber request is retried like other failures, it doesn't stop the delivery.
+	l := zerolog.Nop()
+	timeout := fmt.Errorf("post: %w", context.DeadlineExceeded)
+
+	t.Run("retried", func(t *testing.T) {
+		sub := &subscriber{err: timeout, failures: 1}
+		d := NewDispatcher(l, time.Minute)
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, []common.Position{{DeviceID: "1"}})
+
+		require.Eventually(t, func() bool { return sub.count(PositionReceived) == 1 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, Stats{Delivered: 1}, d.Shutdown(context.Background()))
+	})
+
+	t.Run("failed after delivery timeout", func(t *testing.T) {
+		sub := &subscriber{err: timeout}
+		d := NewDispatcher(l, 50*time.Millisecond)
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, []common.Position{{DeviceID: "1"}})
+
+		require.Eventually(t, func() bool { return d.Stats().Failed == 1 }, time.Second, 10*time.Millisecond)
+		// retrying stopped by the delivery timeout shall not send to the finished delivery.
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, Stats{Failed: 1}, d.Shutdown(context.Background()))
+	})
+}
+
+func TestDispatcher_Outbox(t *testing.T) {
+	l := zerolog.Nop()
+	ob, err := outbox.Open(l, t.TempDir())
+	require.NoError(t, err)
+	defer ob.Close()
+
+	// subscriber is down, positions are kept in the outbox.
+	d := NewDispatcher(l, time.Minute, WithOutbox(ob))
+	d.RegisterEventSubscriber(&subscriber{err: errors.New("fake")})
+	d.DispatchPositions(&l, positions(1, 3))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, Stats{Unacked: 3}, d.Shutdown(ctx))
+
+	// subscriber is up again, kept positions are replayed.
+	sub := new(subscriber)
+	d = NewDispatcher(l, time.Minute, WithWorkers(1), WithOutbox(ob))
+	d.RegisterEventSubscriber(sub)
+	require.Eventually(t, func() bool { return len(sub.received()) == 3 }, time.Second, time.Millisecond)
+	d.DispatchPositions(&l, positions(4, 4))
+	assert.Equal(t, Stats{Delivered: 4}, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, sub.received())
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	l := zerolog.Nop()
+	dir := t.TempDir()
+	ob, err := outbox.Open(l, dir)
+	require.NoError(t, err)
+	defer ob.Close()
+
+	// positions rejected by the subscriber hold up neither the device nor the outbox.
+	sub := &subscriber{err: fmt.Errorf("%w: rejected", ErrPermanent)}
+	d := NewDispatcher(l, time.Minute, WithOutbox(ob), WithMaxAttempts(1))
+	d.RegisterEventSubscriber(sub)
+	d.DispatchPositions(&l, positions(1, 2))
+	assert.Equal(t, Stats{Failed: 2}, d.Shutdown(context.Background()))
+	assert.Zero(t, ob.Unacked("test"))
+
+	b, err := os.ReadFile(filepath.Join(dir, "deadletter", "test.ndjson"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	var rec struct {
+		Offset   uint64
+		Error    string
+		Position common.Position
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, "permanent error: rejected", rec.Error)
+	assert.Contains(t, []string{"1", "2"}, rec.Position.DeviceID)
+}
+
+// batcher handles batches of positions, failing every failEvery batch.
+type batcher struct {
+	size      int
+	interval  time.Duration
+	failEvery int
+
+	mu      sync.Mutex
+	calls   int
+	batches [][]common.Position
+}
+
+func (b *batcher) Batch() (int, time.Duration) {
+	return b.size, b.interval
+}
+
+func (b *batcher) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", PositionsReceived, "batcher"): b}
+}
+
+func (b *batcher) Handle(e event.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	if b.failEvery > 0 && b.calls%b.failEvery == 0 {
+		return errors.New("fake")
+	}
+	b.batches = append(b.batches, e.(*GenericEvent).Positions())
+	return nil
+}
+
+// tracks returns sequence numbers of handled positions by device.
+func (b *batcher) tracks() map[string][]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := make(map[string][]int)
+	for _, batch := range b.batches {
+		for _, pos := range batch {
+			m[pos.DeviceID] = append(m[pos.DeviceID], int(pos.X))
+		}
+	}
+	return m
+}
+
+func TestDispatcher_Batch(t *testing.T) {
+	l := zerolog.Nop()
+	devices := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+
+	t.Run("collects", func(t *testing.T) {
+		b := &batcher{size: 100, interval: 50 * time.Millisecond}
+		d := NewDispatcher(l, time.Minute)
+		d.RegisterEventSubscriber(b)
+		d.DispatchPositions(&l, track(devices, 50))
+		assert.Equal(t, Stats{Delivered: 400}, d.Shutdown(context.Background()))
+		// batches are not limited by the number of workers.
+		assert.LessOrEqual(t, len(b.batches), 8)
+		for _, batch := range b.batches {
+			assert.LessOrEqual(t, len(batch), 100)
+		}
+		for _, dev := range devices {
+			assert.Equal(t, sequence(50), b.tracks()[dev], "device %s", dev)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		ob, err := outbox.Open(l, t.TempDir())
+		require.NoError(t, err)
+		defer ob.Close()
+
+		b := &batcher{size: 7, interval: time.Millisecond, failEvery: 3}
+		d := NewDispatcher(l, 10*time.Millisecond, WithOutbox(ob))
+		d.RegisterEventSubscriber(b)
+		d.DispatchPositions(&l, track(devices[:4], 10))
+		assert.Equal(t, Stats{Delivered: 40}, d.Shutdown(context.Background()))
+		for _, dev := range devices[:4] {
+			assert.Equal(t, sequence(10), b.tracks()[dev], "device %s", dev)
+		}
+	})
+}
+
+// track returns positions of devices numbered from 1 to n in turn, X of the position is its sequence number.
+func track(devices []string, n int) []common.Position {
+	poss := make([]common.Position, 0, len(devices)*n)
+	for i := 1; i <= n; i++ {
+		for _, dev := range devices {
+			pos := common.Position{DeviceID: dev}
+			pos.X = float64(i)
+			poss = append(poss, pos)
+		}
+	}
+	return poss
+}
+
+// sequence returns numbers from 1 to n.
+func sequence(n int) []int {
+	seq := make([]int, 0, n)
+	for i := 1; i <= n; i++ {
+		seq = append(seq, i)
+	}
+	return seq
+}
+
+func TestDispatcher_Order(t *testing.T) {
+	l := zerolog.Nop()
+	devices := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+
+	t.Run("concurrent devices", func(t *testing.T) {
+		sub := &subscriber{delay: 100 * time.Microsecond}
+		d := NewDispatcher(l, time.Minute, WithWorkers(4))
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, track(devices, 50))
+		assert.Equal(t, Stats{Delivered: 400}, d.Shutdown(context.Background()))
+		for _, dev := range devices {
+			assert.Equal(t, sequence(50), sub.tracks()[dev], "device %s", dev)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		ob, err := outbox.Open(l, t.TempDir())
+		require.NoError(t, err)
+		defer ob.Close()
+
+		sub := &subscriber{failEvery: 3}
+		d := NewDispatcher(l, 10*time.Millisecond, WithWorkers(4), WithOutbox(ob))
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, track(devices[:4], 10))
+		assert.Equal(t, Stats{Delivered: 40}, d.Shutdown(context.Background()))
+		for _, dev := range devices[:4] {
+			assert.Equal(t, sequence(10), sub.tracks()[dev], "device %s", dev)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		ob, err := outbox.Open(l, t.TempDir())
+		require.NoError(t, err)
+		defer ob.Close()
+
+		// subscriber is down, positions are kept in the outbox.
+		d := NewDispatcher(l, time.Minute, WithOutbox(ob))
+		d.RegisterEventSubscriber(&subscriber{err: errors.New("fake")})
+		poss := track(devices[:1], 5)
+		d.DispatchPositions(&l, poss[:3])
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		d.Shutdown(ctx)
+
+		// positions dispatched while replaying are delivered after replayed ones.
+		sub := &subscriber{delay: time.Millisecond}
+		d = NewDispatcher(l, time.Minute, WithWorkers(4), WithOutbox(ob))
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, poss[3:])
+		require.Eventually(t, func() bool { return len(sub.received()) == 5 }, time.Second, time.Millisecond)
+		assert.Equal(t, Stats{Delivered: 5}, d.Shutdown(context.Background()))
+		assert.Equal(t, sequence(5), sub.tracks()["1"])
+	})
+}
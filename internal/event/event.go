@@ -35,6 +35,45 @@ func (e *GenericEvent) SetPosition(pos common.Position) {
 	e.SetData(event.M{"position": pos})
 }
 
+// Positions returns the batch of PositionsReceived event.
+func (e GenericEvent) Positions() []common.Position {
+	poss, _ := e.Data()["positions"].([]common.Position)
+	return poss
+}
+
+// SetPositions adds the batch of positions to an event.
+func (e *GenericEvent) SetPositions(poss []common.Position) {
+	e.SetData(event.M{"positions": poss})
+}
+
+// Session returns the session of lifecycle events.
+func (e GenericEvent) Session() *SessionInfo {
+	s, ok := e.Data()["session"].(SessionInfo)
+	if !ok {
+		return nil
+	}
+	return &s
+}
+
+// SetSession adds session data to an event.
+func (e *GenericEvent) SetSession(s SessionInfo) {
+	e.SetData(event.M{"session": s})
+}
+
+// FrameError returns the offending data of ProtocolError event.
+func (e GenericEvent) FrameError() *FrameError {
+	fe, ok := e.Data()["error"].(FrameError)
+	if !ok {
+		return nil
+	}
+	return &fe
+}
+
+// SetFrameError adds the offending data to an event.
+func (e *GenericEvent) SetFrameError(fe FrameError) {
+	e.SetData(event.M{"error": fe})
+}
+
 type Reply struct {
 	Error   error
 	Message string
@@ -45,5 +84,15 @@ type Name string
 const (
 	PositionReceived Name = "position.received"
 	CloseConnection  Name = "close.connection"
+	// PositionsReceived is fired with the batch of positions to subscribers implementing Batcher.
+	PositionsReceived Name = "positions.received"
+	// SessionConnected is fired when the device connects.
+	SessionConnected Name = "session.connected"
+	// SessionAuthenticated is fired when the device of the session is identified.
+	SessionAuthenticated Name = "session.authenticated"
+	// SessionDisconnected is fired when the session is closed.
+	SessionDisconnected Name = "session.disconnected"
+	// ProtocolError is fired when the protocol fails to handle the data.
+	ProtocolError Name = "protocol.error"
 	// NotifyError     Name = "notify.error"
 )
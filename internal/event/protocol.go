@@ -0,0 +1,50 @@
+package event
+
+import (
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+)
+
+// maxFrameErrorBytes limits the bytes kept by the protocol error event.
+const maxFrameErrorBytes = 4 << 10
+
+// FrameError describes the data the protocol failed to handle.
+type FrameError struct {
+	Session string `json:"session"`
+	Remote  string `json:"remote"`
+	// Protocol is empty if the protocol is not detected.
+	Protocol string `json:"protocol,omitempty"`
+	// Device is empty until the device is identified.
+	Device string `json:"device,omitempty"`
+	// Bytes is the hex of the offending bytes, they are cut to 4KB and Truncated is set then.
+	Bytes     string `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error"`
+}
+
+// NewFrameError creates the description of the offending bytes failed with err.
+func NewFrameError(data []byte, err error) FrameError {
+	fe := FrameError{Truncated: len(data) > maxFrameErrorBytes}
+	fe.Bytes = hex.EncodeToString(data[:min(len(data), maxFrameErrorBytes)])
+	if err != nil {
+		fe.Error = err.Error()
+	}
+	return fe
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (e FrameError) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("session", e.Session).
+		Str("remote", e.Remote).
+		Str("proto", e.Protocol).
+		Str("device", e.Device).
+		Str("bytes", e.Bytes).
+		Bool("truncated", e.Truncated).
+		Str("error", e.Error)
+}
+
+// DispatchProtocolError queues ProtocolError event to subscribers listening to it.
+func (d *Dispatcher) DispatchProtocolError(l *zerolog.Logger, fe FrameError) {
+	d.dispatchEvent(item{l: l, event: ProtocolError, frameErr: &fe})
+}
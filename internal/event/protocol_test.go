@@ -0,0 +1,21 @@
+package event
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFrameError(t *testing.T) {
+	err := errors.New("fake")
+
+	fe := NewFrameError([]byte{0x01, 0xAB}, err)
+	assert.Equal(t, FrameError{Bytes: "01ab", Error: "fake"}, fe)
+
+	fe = NewFrameError(bytes.Repeat([]byte{0xFF}, maxFrameErrorBytes+1), err)
+	assert.True(t, fe.Truncated)
+	assert.Equal(t, strings.Repeat("ff", maxFrameErrorBytes), fe.Bytes)
+}
@@ -0,0 +1,417 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+)
+
+// Overflow is the policy of the subscriber queue when it is full.
+type Overflow string
+
+const (
+	// OverflowBlock blocks dispatching until the queue has room, so reading of device data is paused.
+	OverflowBlock Overflow = "block"
+	// OverflowDropOldest drops the oldest queued position in favor of the new one.
+	// Dropped positions kept in the outbox are moved to its dead letter file and acked.
+	OverflowDropOldest Overflow = "drop-oldest"
+	// OverflowSpill writes positions to the spill file on disk until the queue is drained.
+	OverflowSpill Overflow = "spill"
+)
+
+// Valid reports whether the policy is known.
+func (o Overflow) Valid() bool {
+	switch o {
+	case OverflowBlock, OverflowDropOldest, OverflowSpill:
+		return true
+	}
+	return false
+}
+
+// ErrQueueClosed is returned when the position is dispatched to the shut down queue.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// QueueStats are the metrics of the subscriber queue.
+type QueueStats struct {
+	// Depth is the number of queued positions including spilled ones.
+	Depth int
+	// Spilled is the number of positions in the spill file.
+	Spilled int
+	// Dropped is the number of positions dropped by drop-oldest policy.
+	Dropped int64
+	// Unacked is the number of positions kept in the outbox until they are delivered.
+	Unacked uint64
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (s QueueStats) MarshalZerologObject(e *zerolog.Event) {
+	e.Int("depth", s.Depth)
+	e.Int("spilled", s.Spilled)
+	e.Int64("dropped", s.Dropped)
+	e.Uint64("unacked", s.Unacked)
+}
+
+// item is the queued position with the logger of the session dispatched it
+// and the offset of the position in the outbox, it is zero without outbox.
+// Item of other events has the event name and the session or the frame error instead of the position.
+type item struct {
+	l        *zerolog.Logger
+	off      uint64
+	pos      common.Position
+	commit   *commit
+	event    Name
+	session  *SessionInfo
+	frameErr *FrameError
+}
+
+// name returns the name of the event of the item.
+func (it item) name() Name {
+	if it.event == "" {
+		return PositionReceived
+	}
+	return it.event
+}
+
+// key returns the key items are ordered by: the device or the session not identified yet.
+func (it item) key() string {
+	switch {
+	case it.session != nil:
+		return sessionKey(it.session.Device, it.session.ID)
+	case it.frameErr != nil:
+		return sessionKey(it.frameErr.Device, it.frameErr.Session)
+	}
+	return it.pos.DeviceID
+}
+
+func sessionKey(device, session string) string {
+	if device != "" {
+		return device
+	}
+	return "session " + session
+}
+
+// queue is the bounded FIFO of positions for one subscriber.
+// Once positions are spilled, new ones go to the spill file too until it is read out to keep the order.
+// Positions of the device are popped one by one or in order within one batch: the next one is held until
+// the previous one is released, so concurrent workers keep the order of every device while positions of other devices are delivered in parallel.
+// Positions replayed from the outbox are popped ahead of the queued ones until the replay is finished.
+type queue struct {
+	name     string
+	size     int
+	overflow Overflow
+	logger   zerolog.Logger
+	spill    *spill
+	// drop is called for the position dropped by drop-oldest policy out of the queue lock.
+	drop func(item)
+	// batchSize and batchWait are set for the batching subscriber.
+	batchSize int
+	batchWait time.Duration
+	// collecting lets one worker collect the batch at a time, so batches are not split between workers.
+	collecting sync.Mutex
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []item
+	backlog  []item
+	busy     map[string]struct{}
+	// replay holds queued positions until positions replayed from the outbox are popped.
+	replay  bool
+	closed  bool
+	full    bool
+	dropped int64
+}
+
+// newQueue creates the queue, spill policy falls back to block one without spill file.
+func newQueue(l zerolog.Logger, name string, size int, overflow Overflow, sp *spill) *queue {
+	if overflow == OverflowSpill && sp == nil {
+		overflow = OverflowBlock
+	}
+	q := &queue{
+		name:     name,
+		size:     size,
+		overflow: overflow,
+		logger:   l.With().Str("subscriber", name).Logger(),
+		spill:    sp,
+		items:    make([]item, 0, size),
+		busy:     make(map[string]struct{}),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends the position to the queue applying overflow policy if the queue is full.
+func (q *queue) push(it item) error {
+	dropped, err := q.enqueue(it)
+	if dropped != nil && q.drop != nil {
+		q.drop(*dropped)
+	}
+	return err
+}
+
+// enqueue appends the position to the queue and returns the position dropped by drop-oldest policy.
+func (q *queue) enqueue(it item) (*item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.overflow == OverflowBlock {
+		for len(q.items) >= q.size && !q.closed {
+			q.warnFull()
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	var dropped *item
+	switch {
+	case q.spill != nil && (q.spill.len() > 0 || len(q.items) >= q.size):
+		q.warnFull()
+		if err := q.spill.write(it); err != nil {
+			return nil, fmt.Errorf("spill: %w", err)
+		}
+		it.commit.report(errSpilled)
+	case len(q.items) >= q.size:
+		q.warnFull()
+		old := q.items[0]
+		old.commit.report(errDropped)
+		dropped = &old
+		q.items = q.items[1:]
+		q.dropped++
+		q.items = append(q.items, it)
+	default:
+		q.items = append(q.items, it)
+	}
+	q.notEmpty.Signal()
+	return dropped, nil
+}
+
+// pushFront returns the position to the head of the queue regardless of its size.
+func (q *queue) pushFront(it item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append([]item{it}, q.items...)
+}
+
+// pushReplayed appends the position replayed from the outbox, it waits while the backlog is full.
+func (q *queue) pushReplayed(it item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.backlog) >= q.size && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.backlog = append(q.backlog, it)
+	q.notEmpty.Broadcast()
+	return nil
+}
+
+// endReplay releases queued positions, it is not called if the replay is interrupted by shutdown.
+func (q *queue) endReplay() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.replay = false
+	q.notEmpty.Broadcast()
+}
+
+// pop waits for the next position of the device not being delivered, it returns false when the queue
+// is closed and empty. The position popped shall be released after its delivery.
+func (q *queue) pop() (item, bool) {
+	its, ok := q.popBatch(1, 0)
+	if !ok {
+		return item{}, false
+	}
+	return its[0], true
+}
+
+// collect pops the next batch of positions of the batching subscriber or the next item of others.
+func (q *queue) collect() ([]item, bool) {
+	if q.batchSize <= 0 {
+		return q.popBatch(1, 0)
+	}
+	q.collecting.Lock()
+	defer q.collecting.Unlock()
+	return q.popBatch(q.batchSize, q.batchWait)
+}
+
+// popBatch waits for the next position like pop and collects up to size positions for the wait
+// since the first one. Positions of the device are collected in order, other events are popped alone.
+// Positions popped shall be released after their delivery.
+func (q *queue) popBatch(size int, wait time.Duration) ([]item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var (
+		batch   []item
+		own     = make(map[string]struct{})
+		expired bool
+		timer   *time.Timer
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		// events other than positions are not batched.
+		for len(batch) < size && (len(batch) == 0 || batch[0].event == "") {
+			it, ok := q.next(own, len(batch) > 0)
+			if !ok {
+				break
+			}
+			batch = append(batch, it)
+		}
+		switch {
+		case len(batch) == size || len(batch) > 0 && (batch[0].event != "" || wait <= 0 || expired || q.closed):
+			return batch, true
+		// queued positions held by the replay interrupted are left in the outbox.
+		case q.closed && len(q.backlog) == 0 && (q.replay || len(q.items) == 0 && q.spill.len() == 0):
+			return nil, false
+		case len(batch) > 0 && timer == nil:
+			timer = time.AfterFunc(wait, func() {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				expired = true
+				q.notEmpty.Broadcast()
+			})
+		}
+		q.notEmpty.Wait()
+	}
+}
+
+// next takes the next item of the device not being delivered, devices of own items are taken by the batch.
+// Only positions are taken if positions only is set.
+func (q *queue) next(own map[string]struct{}, positionsOnly bool) (item, bool) {
+	for {
+		if it, ok := q.take(&q.backlog, own, positionsOnly); ok {
+			return it, true
+		}
+		if q.replay {
+			return item{}, false
+		}
+		if it, ok := q.take(&q.items, own, positionsOnly); ok {
+			if q.full && len(q.items) < q.size/2 {
+				q.full = false
+			}
+			return it, true
+		}
+		// spilled positions are newer than queued ones, so they are read behind them.
+		if q.spill.len() == 0 || len(q.items) >= q.size {
+			return item{}, false
+		}
+		it, err := q.spill.read()
+		if err != nil {
+			q.logger.Error().Err(err).Msg("read spilled position")
+			continue
+		}
+		it.l = &q.logger
+		q.items = append(q.items, it)
+	}
+}
+
+// take removes the first item of the device not being delivered from items and marks the device busy.
+// Devices of own items are not busy for the caller, positions of the device behind the skipped item are
+// skipped too to keep the order.
+func (q *queue) take(items *[]item, own map[string]struct{}, positionsOnly bool) (item, bool) {
+	skipped := make(map[string]struct{})
+	for i, it := range *items {
+		key := it.key()
+		if _, ok := skipped[key]; ok {
+			continue
+		}
+		_, busy := q.busy[key]
+		_, mine := own[key]
+		if busy && !mine || positionsOnly && it.event != "" {
+			skipped[key] = struct{}{}
+			continue
+		}
+		if i == 0 {
+			*items = (*items)[1:]
+		} else {
+			*items = append((*items)[:i], (*items)[i+1:]...)
+		}
+		q.busy[key] = struct{}{}
+		own[key] = struct{}{}
+		q.notFull.Broadcast()
+		return it, true
+	}
+	return item{}, false
+}
+
+// release lets the next positions of devices be popped.
+func (q *queue) release(its ...item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, it := range its {
+		delete(q.busy, it.key())
+	}
+	q.notEmpty.Broadcast()
+}
+
+// warnFull logs the queue became full once until it is half drained.
+func (q *queue) warnFull() {
+	if q.full {
+		return
+	}
+	q.full = true
+	q.logger.Warn().Int("size", q.size).Str("overflow", string(q.overflow)).Msg("subscriber queue is full")
+}
+
+// close wakes up waiting producers and consumers, queued positions are still popped.
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// flush persists positions left in memory to the spill file ahead of spilled ones and closes the file.
+// Positions kept in the outbox are not persisted again, since they are replayed from the outbox.
+// It returns the number of lost positions, all of them are lost without spill file or outbox.
+func (q *queue) flush(durable bool) (lost int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := append(q.backlog, q.items...)
+	q.items, q.backlog = nil, nil
+	for _, it := range items {
+		it.commit.report(ErrQueueClosed)
+	}
+	if durable {
+		n := 0
+		for _, it := range items {
+			if it.off == 0 {
+				items[n] = it
+				n++
+			}
+		}
+		items = items[:n]
+		if q.spill != nil {
+			_ = q.spill.clear()
+		}
+	}
+	if q.spill == nil {
+		return len(items)
+	}
+	if err := q.spill.prepend(items); err != nil {
+		q.logger.Error().Err(err).Int("positions", len(items)).Msg("persist queued positions")
+		lost = len(items)
+	}
+	if err := q.spill.close(); err != nil {
+		q.logger.Error().Err(err).Msg("close spill file")
+	}
+	return lost
+}
+
+func (q *queue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{Depth: len(q.items) + len(q.backlog) + q.spill.len(), Spilled: q.spill.len(), Dropped: q.dropped}
+}
@@ -0,0 +1,127 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/outbox"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func positions(from, to int) []common.Position {
+	poss := make([]common.Position, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		poss = append(poss, common.Position{DeviceID: strconv.Itoa(i)})
+	}
+	return poss
+}
+
+// dispatchFirst dispatches the first position and waits for the worker to take it.
+func dispatchFirst(t *testing.T, d *Dispatcher, l *zerolog.Logger) {
+	t.Helper()
+	d.DispatchPositions(l, positions(1, 1))
+	require.Eventually(t, func() bool { return d.inflight.Load() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestDispatcher_Overflow(t *testing.T) {
+	l := zerolog.Nop()
+
+	t.Run("block", func(t *testing.T) {
+		sub := &subscriber{gate: make(chan struct{})}
+		d := NewDispatcher(l, time.Minute, WithQueueSize(1), WithWorkers(1))
+		d.RegisterEventSubscriber(sub)
+		dispatchFirst(t, d, &l)
+		d.DispatchPositions(&l, positions(2, 2))
+
+		dispatched := make(chan struct{})
+		go func() {
+			d.DispatchPositions(&l, positions(3, 3))
+			close(dispatched)
+		}()
+		select {
+		case <-dispatched:
+			t.Fatal("dispatching to the full queue shall block")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.Equal(t, QueueStats{Depth: 1}, d.Queues()["test"])
+
+		close(sub.gate)
+		<-dispatched
+		assert.Equal(t, Stats{Delivered: 3}, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"1", "2", "3"}, sub.received())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		sub := &subscriber{gate: make(chan struct{})}
+		d := NewDispatcher(l, time.Minute, WithQueueSize(2), WithWorkers(1), WithOverflow(OverflowDropOldest))
+		d.RegisterEventSubscriber(sub)
+		dispatchFirst(t, d, &l)
+		d.DispatchPositions(&l, positions(2, 4))
+		assert.Equal(t, QueueStats{Depth: 2, Dropped: 1}, d.Queues()["test"])
+
+		close(sub.gate)
+		assert.Equal(t, Stats{Delivered: 3, Dropped: 1}, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"1", "3", "4"}, sub.received())
+	})
+
+	t.Run("drop oldest with outbox", func(t *testing.T) {
+		dir := t.TempDir()
+		ob, err := outbox.Open(l, dir, outbox.WithSegmentSize(512))
+		require.NoError(t, err)
+		defer ob.Close()
+
+		sub := &subscriber{gate: make(chan struct{})}
+		d := NewDispatcher(l, time.Minute, WithQueueSize(2), WithWorkers(1), WithOverflow(OverflowDropOldest), WithOutbox(ob))
+		d.RegisterEventSubscriber(sub)
+		dispatchFirst(t, d, &l)
+		d.DispatchPositions(&l, positions(2, 20))
+		close(sub.gate)
+		assert.Equal(t, Stats{Delivered: 3, Dropped: 17}, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"1", "19", "20"}, sub.received())
+
+		// dropped positions hold up neither the cursor nor the compaction.
+		assert.Zero(t, ob.Unacked("test"))
+		ob.Compact()
+		assert.Equal(t, 1, ob.Stats().Segments)
+
+		b, err := os.ReadFile(filepath.Join(dir, "deadletter", "test.ndjson"))
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 17)
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := []DispatcherOption{WithQueueSize(1), WithWorkers(1), WithOverflow(OverflowSpill), WithSpillDir(dir)}
+
+		// subscriber is down, so positions are persisted on shutdown.
+		d := NewDispatcher(l, time.Minute, opts...)
+		d.RegisterEventSubscriber(&subscriber{err: errors.New("fake")})
+		dispatchFirst(t, d, &l)
+		d.DispatchPositions(&l, positions(2, 5))
+		assert.Equal(t, QueueStats{Depth: 4, Spilled: 3}, d.Queues()["test"])
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, Stats{Pending: 5, Spilled: 5}, d.Shutdown(ctx))
+
+		// subscriber is up again, persisted positions are delivered in order.
+		sub := new(subscriber)
+		d = NewDispatcher(l, time.Minute, opts...)
+		d.RegisterEventSubscriber(sub)
+		d.DispatchPositions(&l, positions(6, 6))
+		assert.Equal(t, Stats{Delivered: 6}, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, sub.received())
+
+		_, err := os.Stat(filepath.Join(dir, "test.spill"))
+		assert.True(t, os.IsNotExist(err), "empty spill file shall be removed")
+	})
+}
@@ -0,0 +1,62 @@
+package event
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// CloseReason is the reason the session is closed.
+type CloseReason string
+
+const (
+	// ReasonEOF is the session closed by the device.
+	ReasonEOF CloseReason = "eof"
+	// ReasonIdleTimeout is the session got no data for the idle timeout.
+	ReasonIdleTimeout CloseReason = "idle-timeout"
+	// ReasonBadData is the session sent data not recognized by the protocol.
+	ReasonBadData CloseReason = "bad-data"
+	// ReasonCloseSession is the session closed by the protocol, on login failure for instance.
+	ReasonCloseSession CloseReason = "close-session"
+	// ReasonNotCommitted is the session closed since positions are not committed and can't be rejected.
+	ReasonNotCommitted CloseReason = "not-committed"
+	// ReasonShutdown is the session closed by the server shutdown.
+	ReasonShutdown CloseReason = "shutdown"
+	// ReasonError is the session closed by the network error.
+	ReasonError CloseReason = "error"
+)
+
+// SessionInfo describes the device session of the lifecycle events.
+type SessionInfo struct {
+	ID     string `json:"id"`
+	Remote string `json:"remote"`
+	Local  string `json:"local"`
+	// Protocol is empty until the protocol is detected.
+	Protocol string `json:"protocol,omitempty"`
+	// Device is empty until the device is identified.
+	Device   string    `json:"device,omitempty"`
+	OpenedAt time.Time `json:"opened_at"`
+	// Duration, BytesIn, BytesOut and Reason are set for SessionDisconnected only.
+	Duration time.Duration `json:"duration,omitempty"`
+	BytesIn  int64         `json:"bytes_in,omitempty"`
+	BytesOut int64         `json:"bytes_out,omitempty"`
+	Reason   CloseReason   `json:"reason,omitempty"`
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (s SessionInfo) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("id", s.ID).
+		Str("remote", s.Remote).
+		Str("proto", s.Protocol).
+		Str("device", s.Device).
+		Dur("duration", s.Duration).
+		Int64("in", s.BytesIn).
+		Int64("out", s.BytesOut).
+		Str("reason", string(s.Reason))
+}
+
+// DispatchSession queues the session lifecycle event to subscribers listening to it.
+// Events of the identified device are delivered in order with its positions.
+func (d *Dispatcher) DispatchSession(l *zerolog.Logger, name Name, info SessionInfo) {
+	d.dispatchEvent(item{l: l, event: name, session: &info})
+}
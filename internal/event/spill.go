@@ -0,0 +1,198 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+// spilled is the line of the spill file.
+type spilled struct {
+	Offset   uint64          `json:"offset,omitempty"`
+	Position common.Position `json:"position"`
+	Event    Name            `json:"event,omitempty"`
+	Session  *SessionInfo    `json:"session,omitempty"`
+	Error    *FrameError     `json:"error,omitempty"`
+}
+
+func (it item) spilled() spilled {
+	return spilled{Offset: it.off, Position: it.pos, Event: it.event, Session: it.session, Error: it.frameErr}
+}
+
+// spill is the append-only file of positions overflowed the subscriber queue, one JSON position per line
+// with its outbox offset if any, other events are spilled the same way.
+// File is truncated when all positions are read, positions not read are kept for the next start.
+// Numeric attributes are read back as float64.
+type spill struct {
+	path string
+	w    *os.File
+	r    *os.File
+	br   *bufio.Reader
+	n    int
+}
+
+// openSpill opens the spill file counting positions left from the previous run.
+// The trailing incomplete line is truncated.
+func openSpill(path string) (*spill, error) {
+	s := &spill{path: path}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	var (
+		off, end int64
+		buf      = make([]byte, 32*1024)
+	)
+	for {
+		n, err := s.r.Read(buf)
+		for i := 0; i < n; i++ {
+			if buf[i] == '\n' {
+				s.n++
+				end = off + int64(i) + 1
+			}
+		}
+		off += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = s.close()
+			return nil, fmt.Errorf("read spill file: %w", err)
+		}
+	}
+	if end < off {
+		if err := s.w.Truncate(end); err != nil {
+			_ = s.close()
+			return nil, fmt.Errorf("truncate spill file: %w", err)
+		}
+	}
+	if _, err := s.r.Seek(0, io.SeekStart); err != nil {
+		_ = s.close()
+		return nil, fmt.Errorf("seek spill file: %w", err)
+	}
+	s.br.Reset(s.r)
+	return s, nil
+}
+
+func (s *spill) open() (err error) {
+	s.w, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spill file: %w", err)
+	}
+	s.r, err = os.Open(s.path)
+	if err != nil {
+		_ = s.w.Close()
+		return fmt.Errorf("open spill file: %w", err)
+	}
+	s.br = bufio.NewReader(s.r)
+	return nil
+}
+
+// len returns the number of positions not read yet, it is safe to call on nil spill.
+func (s *spill) len() int {
+	if s == nil {
+		return 0
+	}
+	return s.n
+}
+
+func (s *spill) write(it item) error {
+	b, err := json.Marshal(it.spilled())
+	if err != nil {
+		return fmt.Errorf("marshal position: %w", err)
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	if err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	s.n++
+	return nil
+}
+
+func (s *spill) read() (it item, err error) {
+	line, err := s.br.ReadBytes('\n')
+	if err != nil {
+		// file is damaged outside, positions left are lost.
+		s.n = 0
+		_ = s.reset()
+		return it, fmt.Errorf("read spill file: %w", err)
+	}
+	s.n--
+	if s.n == 0 {
+		if err = s.reset(); err != nil {
+			return it, err
+		}
+	}
+	var sp spilled
+	if err = json.Unmarshal(line, &sp); err != nil {
+		return it, fmt.Errorf("unmarshal position: %w", err)
+	}
+	return item{off: sp.Offset, pos: sp.Position, event: sp.Event, session: sp.Session, frameErr: sp.Error}, nil
+}
+
+// clear drops positions not read yet.
+func (s *spill) clear() error {
+	s.n = 0
+	return s.reset()
+}
+
+func (s *spill) reset() error {
+	if err := s.w.Truncate(0); err != nil {
+		return fmt.Errorf("truncate spill file: %w", err)
+	}
+	if _, err := s.r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek spill file: %w", err)
+	}
+	s.br.Reset(s.r)
+	return nil
+}
+
+// prepend writes positions ahead of the positions not read yet.
+func (s *spill) prepend(items []item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	rest, err := io.ReadAll(s.br)
+	if err != nil {
+		return fmt.Errorf("read spill file: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, it := range items {
+		if err = enc.Encode(it.spilled()); err != nil {
+			return fmt.Errorf("marshal position: %w", err)
+		}
+	}
+	buf.Write(rest)
+
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	_ = s.w.Close()
+	_ = s.r.Close()
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace spill file: %w", err)
+	}
+	s.n += len(items)
+	return s.open()
+}
+
+// close closes the file, empty file is removed.
+func (s *spill) close() error {
+	err := s.w.Close()
+	if rerr := s.r.Close(); err == nil {
+		err = rerr
+	}
+	if s.n == 0 {
+		if rerr := os.Remove(s.path); err == nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+// Package kafka provides the events subscriber publishing positions to Kafka.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var (
+	_ event.Listener   = (*Producer)(nil)
+	_ event.Subscriber = (*Producer)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "kafka"
+
+const (
+	defaultLinger          = 10 * time.Millisecond
+	defaultDeliveryTimeout = 10 * time.Second
+	minDeliveryTimeout     = time.Second
+)
+
+// Compression is the codec of record batches.
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionGzip   Compression = "gzip"
+	CompressionSnappy Compression = "snappy"
+	CompressionLZ4    Compression = "lz4"
+	CompressionZstd   Compression = "zstd"
+)
+
+// Valid reports whether the codec is known.
+func (c Compression) Valid() bool {
+	_, ok := c.codec()
+	return ok
+}
+
+func (c Compression) codec() (kgo.CompressionCodec, bool) {
+	switch c {
+	case CompressionNone:
+		return kgo.NoCompression(), true
+	case CompressionGzip:
+		return kgo.GzipCompression(), true
+	case CompressionSnappy:
+		return kgo.SnappyCompression(), true
+	case CompressionLZ4:
+		return kgo.Lz4Compression(), true
+	case CompressionZstd:
+		return kgo.ZstdCompression(), true
+	}
+	return kgo.CompressionCodec{}, false
+}
+
+// Option is a functional option for the producer.
+type Option func(*Producer)
+
+// WithEncoder sets the encoder of positions. Default is JSON.
+func WithEncoder(enc encoding.Encoder) Option {
+	return func(p *Producer) {
+		if enc != nil {
+			p.encoder = enc
+		}
+	}
+}
+
+// WithCompression sets the codec of record batches. Default is snappy.
+func WithCompression(c Compression) Option {
+	return func(p *Producer) {
+		if c.Valid() {
+			p.compression = c
+		}
+	}
+}
+
+// WithLinger sets the time to wait for more records to batch them. Default is 10ms.
+func WithLinger(linger time.Duration) Option {
+	return func(p *Producer) {
+		if linger >= 0 {
+			p.linger = linger
+		}
+	}
+}
+
+// WithBatchMaxBytes sets the max size of the record batch. Default is 1MB of the Kafka client.
+func WithBatchMaxBytes(n int32) Option {
+	return func(p *Producer) {
+		if n > 0 {
+			p.batchMaxBytes = n
+		}
+	}
+}
+
+// WithDeliveryTimeout sets the time to deliver the record, the record is failed after it.
+// It is 1s at least. Default is 10s.
+func WithDeliveryTimeout(to time.Duration) Option {
+	return func(p *Producer) {
+		if to > 0 {
+			p.deliveryTimeout = max(to, minDeliveryTimeout)
+		}
+	}
+}
+
+// Producer publishes positions to the Kafka topic keyed by device, so positions of the device
+// land on the same partition in order.
+// The producer is idempotent and waits for all in-sync replicas, failed delivery is returned
+// to the dispatcher to retry it. Positions produced concurrently by dispatcher workers are batched.
+type Producer struct {
+	client *kgo.Client
+	topic  string
+
+	encoder         encoding.Encoder
+	compression     Compression
+	linger          time.Duration
+	batchMaxBytes   int32
+	deliveryTimeout time.Duration
+}
+
+// NewProducer creates a new producer to the topic of the cluster of brokers.
+func NewProducer(brokers []string, topic string, opts ...Option) (*Producer, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("no brokers")
+	}
+	if topic == "" {
+		return nil, errors.New("no topic")
+	}
+	p := &Producer{
+		topic:           topic,
+		encoder:         encoding.JSON{},
+		compression:     CompressionSnappy,
+		linger:          defaultLinger,
+		deliveryTimeout: defaultDeliveryTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	codec, _ := p.compression.codec()
+	kopts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		kgo.ProducerBatchCompression(codec),
+		kgo.ProducerLinger(p.linger),
+		kgo.RecordDeliveryTimeout(p.deliveryTimeout),
+	}
+	if p.batchMaxBytes > 0 {
+		kopts = append(kopts, kgo.ProducerBatchMaxBytes(p.batchMaxBytes))
+	}
+	client, err := kgo.NewClient(kopts...)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka client: %w", err)
+	}
+	p.client = client
+	return p, nil
+}
+
+func (p *Producer) String() string {
+	return Name
+}
+
+func (p *Producer) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionReceived, Name): p,
+	}
+}
+
+// Handle publishes the position and waits for its delivery.
+func (p *Producer) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	pos := eve.Position()
+	if pos == nil {
+		return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
+	}
+
+	value, err := p.encoder.Encode(*pos)
+	if err != nil {
+		return fmt.Errorf("encode position: %w", err)
+	}
+	rec := &kgo.Record{
+		Key:     []byte(pos.DeviceID),
+		Value:   value,
+		Headers: []kgo.RecordHeader{{Key: "content-type", Value: []byte(p.encoder.ContentType())}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.deliveryTimeout)
+	defer cancel()
+	if err = p.client.ProduceSync(ctx, rec).FirstErr(); err != nil {
+		return fmt.Errorf("produce to %s: %w", p.topic, err)
+	}
+	return nil
+}
+
+// Close flushes buffered records and closes the client.
+func (p *Producer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.deliveryTimeout)
+	defer cancel()
+	err := p.client.Flush(ctx)
+	p.client.Close()
+	if err != nil {
+		return fmt.Errorf("flush kafka producer: %w", err)
+	}
+	return nil
+}
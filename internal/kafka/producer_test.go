@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const topic = "positions"
+
+func positionEvent(device string, seq int) *ev.GenericEvent {
+	pos := common.Position{DeviceID: device}
+	pos.X = float64(seq)
+	e := new(ev.GenericEvent)
+	e.SetPosition(pos)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, Name))
+	return e
+}
+
+// consume reads n records of the topic from the start.
+func consume(t *testing.T, brokers []string, n int) []*kgo.Record {
+	t.Helper()
+	cl, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	recs := make([]*kgo.Record, 0, n)
+	for len(recs) < n {
+		fetches := cl.PollFetches(ctx)
+		require.NoError(t, fetches.Err())
+		recs = append(recs, fetches.Records()...)
+	}
+	return recs
+}
+
+func TestProducer_Handle(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, topic))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	p, err := NewProducer(cluster.ListenAddrs(), topic, WithCompression(CompressionZstd))
+	require.NoError(t, err)
+	devices := []string{"1", "2", "3", "4"}
+	for seq := 1; seq <= 5; seq++ {
+		for _, dev := range devices {
+			require.NoError(t, p.Handle(positionEvent(dev, seq)))
+		}
+	}
+	require.NoError(t, p.Close())
+
+	partitions := make(map[string]int32)
+	tracks := make(map[string][]float64)
+	for _, rec := range consume(t, cluster.ListenAddrs(), 20) {
+		var msg encoding.Message
+		require.NoError(t, json.Unmarshal(rec.Value, &msg))
+		dev := string(rec.Key)
+		assert.Equal(t, dev, msg.Device)
+		assert.Equal(t, []kgo.RecordHeader{{Key: "content-type", Value: []byte("application/json")}}, rec.Headers)
+		if part, ok := partitions[dev]; ok {
+			assert.Equal(t, part, rec.Partition, "device %s shall be produced to one partition", dev)
+		}
+		partitions[dev] = rec.Partition
+		tracks[dev] = append(tracks[dev], msg.Lon)
+	}
+	for _, dev := range devices {
+		assert.Equal(t, []float64{1, 2, 3, 4, 5}, tracks[dev], "device %s", dev)
+	}
+}
+
+func TestProducer_DeliveryError(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	// topic does not exist and is not created, so the delivery is timed out.
+	p, err := NewProducer(cluster.ListenAddrs(), topic, WithDeliveryTimeout(time.Second))
+	require.NoError(t, err)
+	defer p.Close()
+
+	start := time.Now()
+	assert.Error(t, p.Handle(positionEvent("1", 1)))
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestProducer_DispatcherTimeout(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, topic))
+	require.NoError(t, err)
+	defer cluster.Close()
+	// the first produce request is held, so the record buffered behind it is not produced in time.
+	var held atomic.Bool
+	cluster.ControlKey(kmsg.Produce.Int16(), func(kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.KeepControl()
+		if held.CompareAndSwap(false, true) {
+			cluster.SleepControl(func() { time.Sleep(2500 * time.Millisecond) })
+		}
+		return nil, nil, false
+	})
+
+	p, err := NewProducer(cluster.ListenAddrs(), topic, WithDeliveryTimeout(time.Second))
+	require.NoError(t, err)
+	defer p.Close()
+
+	// the record timed out is retried by the dispatcher.
+	l := zerolog.Nop()
+	d := ev.NewDispatcher(l, time.Minute)
+	d.RegisterEventSubscriber(p)
+	d.DispatchPositions(&l, []common.Position{{DeviceID: "1"}})
+	time.Sleep(100 * time.Millisecond)
+	d.DispatchPositions(&l, []common.Position{{DeviceID: "2"}})
+
+	assert.Equal(t, ev.Stats{Delivered: 2}, d.Shutdown(context.Background()))
+	assert.Len(t, consume(t, cluster.ListenAddrs(), 2), 2)
+}
@@ -0,0 +1,291 @@
+// Package mqtt provides the events subscriber publishing positions and device sessions to MQTT broker.
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+var (
+	_ event.Listener   = (*Publisher)(nil)
+	_ event.Subscriber = (*Publisher)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "mqtt"
+
+const (
+	// DefaultTopic is the template of positions topic.
+	DefaultTopic = "gotrackery/{protocol}/{device}/position"
+	// DefaultSessionTopic is the template of device sessions topic.
+	DefaultSessionTopic = "gotrackery/{protocol}/{device}/session"
+	// DefaultStatusTopic is the topic of the server status.
+	DefaultStatusTopic = "gotrackery/status"
+
+	defaultTimeout = 10 * time.Second
+	// disconnectQuiesce is the time in milliseconds to complete the work on disconnect.
+	disconnectQuiesce = 250
+)
+
+const (
+	// Online is the status of the connected server and the identified device.
+	Online = "online"
+	// Offline is the status of the disconnected server and device, it is the last will of the server.
+	Offline = "offline"
+)
+
+// ErrTimeout is returned when the message is not published in time.
+var ErrTimeout = errors.New("timeout")
+
+// ValidTopic reports whether the topic template is valid: not empty and without wildcards.
+func ValidTopic(tmpl string) bool {
+	return tmpl != "" && !strings.ContainsAny(tmpl, "+#")
+}
+
+// Topic expands the template placeholders {protocol} and {device}.
+// Topic separators and wildcards of values are replaced by underscore, empty values are unknown.
+func Topic(tmpl, protocol, device string) string {
+	return strings.NewReplacer("{protocol}", level(protocol), "{device}", level(device)).Replace(tmpl)
+}
+
+func level(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#', 0:
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Session is the message of the device session: online when the device is identified
+// and offline when the session is closed.
+type Session struct {
+	State   string         `json:"state"`
+	Session ev.SessionInfo `json:"session"`
+}
+
+// Option is a functional option for the publisher.
+type Option func(*Publisher)
+
+// WithTopic sets the template of positions topic. Default is DefaultTopic.
+func WithTopic(tmpl string) Option {
+	return func(p *Publisher) {
+		if ValidTopic(tmpl) {
+			p.topic = tmpl
+		}
+	}
+}
+
+// WithSessionTopic sets the template of device sessions topic. Default is DefaultSessionTopic.
+func WithSessionTopic(tmpl string) Option {
+	return func(p *Publisher) {
+		if ValidTopic(tmpl) {
+			p.sessionTopic = tmpl
+		}
+	}
+}
+
+// WithStatusTopic sets the topic of the server status, offline status is the last will. Default is DefaultStatusTopic.
+func WithStatusTopic(topic string) Option {
+	return func(p *Publisher) {
+		if ValidTopic(topic) {
+			p.statusTopic = topic
+		}
+	}
+}
+
+// WithQoS sets QoS of published messages: 0, 1 or 2. Default is 1.
+func WithQoS(qos byte) Option {
+	return func(p *Publisher) {
+		if qos <= 2 {
+			p.qos = qos
+		}
+	}
+}
+
+// WithRetain sets the retain flag of positions, so the last position of the device is kept by the broker.
+// Session and status messages are always retained.
+func WithRetain(retain bool) Option {
+	return func(p *Publisher) {
+		p.retain = retain
+	}
+}
+
+// WithEncoder sets the encoder of positions. Default is JSON.
+func WithEncoder(enc encoding.Encoder) Option {
+	return func(p *Publisher) {
+		if enc != nil {
+			p.encoder = enc
+		}
+	}
+}
+
+// WithClientID sets MQTT client id. Default is random gotrackery-<id>.
+func WithClientID(id string) Option {
+	return func(p *Publisher) {
+		if id != "" {
+			p.clientID = id
+		}
+	}
+}
+
+// WithCredentials sets the user name and password to connect to the broker.
+func WithCredentials(user, password string) Option {
+	return func(p *Publisher) {
+		p.user, p.password = user, password
+	}
+}
+
+// WithTimeout sets the time to connect to the broker and to publish the message. Default is 10s.
+func WithTimeout(to time.Duration) Option {
+	return func(p *Publisher) {
+		if to > 0 {
+			p.timeout = to
+		}
+	}
+}
+
+// Publisher publishes positions and sessions of devices to the broker.
+// The server status is published to the status topic: online on connect and offline on close,
+// offline is the last will of the publisher as well.
+// The publisher reconnects to the broker, failed publishing is returned to the dispatcher to retry it.
+type Publisher struct {
+	client paho.Client
+
+	topic        string
+	sessionTopic string
+	statusTopic  string
+	qos          byte
+	retain       bool
+	encoder      encoding.Encoder
+	clientID     string
+	user         string
+	password     string
+	timeout      time.Duration
+}
+
+// NewPublisher connects to the broker, e.g. tcp://localhost:1883.
+func NewPublisher(broker string, opts ...Option) (*Publisher, error) {
+	if broker == "" {
+		return nil, errors.New("no broker")
+	}
+	p := &Publisher{
+		topic:        DefaultTopic,
+		sessionTopic: DefaultSessionTopic,
+		statusTopic:  DefaultStatusTopic,
+		qos:          1,
+		encoder:      encoding.JSON{},
+		clientID:     "gotrackery-" + gonanoid.Must(8),
+		timeout:      defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	co := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(p.clientID).
+		SetUsername(p.user).
+		SetPassword(p.password).
+		SetConnectTimeout(p.timeout).
+		SetAutoReconnect(true).
+		SetWill(p.statusTopic, Offline, p.qos, true).
+		SetOnConnectHandler(func(c paho.Client) {
+			// publishing from the handler shall not wait, the client is not ready yet.
+			c.Publish(p.statusTopic, p.qos, true, Online)
+		})
+	p.client = paho.NewClient(co)
+	if err := wait(p.client.Connect(), p.timeout); err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", broker, err)
+	}
+	return p, nil
+}
+
+func (p *Publisher) String() string {
+	return Name
+}
+
+func (p *Publisher) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionReceived, Name):     p,
+		fmt.Sprintf("%s.%s", ev.SessionAuthenticated, Name): p,
+		fmt.Sprintf("%s.%s", ev.SessionDisconnected, Name):  p,
+	}
+}
+
+// Handle publishes the position or the session of the identified device and waits for the broker acknowledgement.
+func (p *Publisher) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	switch ev.Name(name) {
+	case ev.PositionReceived:
+		pos := eve.Position()
+		if pos == nil {
+			return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
+		}
+		payload, err := p.encoder.Encode(*pos)
+		if err != nil {
+			return fmt.Errorf("encode position: %w", err)
+		}
+		return p.publish(Topic(p.topic, pos.Protocol, pos.DeviceID), p.retain, payload)
+	case ev.SessionAuthenticated, ev.SessionDisconnected:
+		s := eve.Session()
+		if s == nil {
+			return fmt.Errorf("session not specified")
+		}
+		if s.Device == "" {
+			// session of the device not identified is not published.
+			return nil
+		}
+		msg := Session{State: Online, Session: *s}
+		if ev.Name(name) == ev.SessionDisconnected {
+			msg.State = Offline
+		}
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("marshal session: %w", err)
+		}
+		return p.publish(Topic(p.sessionTopic, s.Protocol, s.Device), true, payload)
+	}
+	return fmt.Errorf("event not found for listner: %s", Name)
+}
+
+func (p *Publisher) publish(topic string, retain bool, payload []byte) error {
+	if err := wait(p.client.Publish(topic, p.qos, retain, payload), p.timeout); err != nil {
+		return fmt.Errorf("publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Close publishes offline status and disconnects from the broker.
+func (p *Publisher) Close() error {
+	err := p.publish(p.statusTopic, true, []byte(Offline))
+	p.client.Disconnect(disconnectQuiesce)
+	return err
+}
+
+func wait(t paho.Token, to time.Duration) error {
+	if !t.WaitTimeout(to) {
+		return ErrTimeout
+	}
+	return t.Error()
+}
@@ -0,0 +1,139 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// broker starts in-process MQTT broker, it returns its address.
+func broker(t *testing.T) (*mochi.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	srv := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, srv.AddHook(new(auth.AllowHook), nil))
+	require.NoError(t, srv.AddListener(listeners.NewTCP("tcp", addr, nil)))
+	require.NoError(t, srv.Serve())
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv, "tcp://" + addr
+}
+
+// listen subscribes the client to all topics of gotrackery.
+func listen(t *testing.T, addr, id string) <-chan paho.Message {
+	t.Helper()
+	msgs := make(chan paho.Message, 16)
+	c := paho.NewClient(paho.NewClientOptions().AddBroker(addr).SetClientID(id))
+	require.NoError(t, wait(c.Connect(), time.Second))
+	t.Cleanup(func() { c.Disconnect(0) })
+	require.NoError(t, wait(c.Subscribe("gotrackery/#", 1, func(_ paho.Client, m paho.Message) { msgs <- m }), time.Second))
+	return msgs
+}
+
+func next(t *testing.T, msgs <-chan paho.Message) paho.Message {
+	t.Helper()
+	select {
+	case m := <-msgs:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message")
+	}
+	return nil
+}
+
+func TestPublisher_Handle(t *testing.T) {
+	_, addr := broker(t)
+	msgs := listen(t, addr, "listener")
+
+	p, err := NewPublisher(addr, WithClientID("gotrackery"), WithTopic("gotrackery/{protocol}/{device}/pos"))
+	require.NoError(t, err)
+	m := next(t, msgs)
+	assert.Equal(t, DefaultStatusTopic, m.Topic())
+	assert.Equal(t, Online, string(m.Payload()))
+
+	info := ev.SessionInfo{ID: "abc", Protocol: "egts", Device: "86/7+"}
+	e := new(ev.GenericEvent)
+	e.SetSession(info)
+	e.SetName(fmt.Sprintf("%s.%s", ev.SessionAuthenticated, Name))
+	require.NoError(t, p.Handle(e))
+	m = next(t, msgs)
+	assert.Equal(t, "gotrackery/egts/86_7_/session", m.Topic())
+	var s Session
+	require.NoError(t, json.Unmarshal(m.Payload(), &s))
+	assert.Equal(t, Session{State: Online, Session: info}, s)
+
+	pos := common.Position{Protocol: "egts", DeviceID: "867"}
+	e = new(ev.GenericEvent)
+	e.SetPosition(pos)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, Name))
+	require.NoError(t, p.Handle(e))
+	m = next(t, msgs)
+	assert.Equal(t, "gotrackery/egts/867/pos", m.Topic())
+	var msg encoding.Message
+	require.NoError(t, json.Unmarshal(m.Payload(), &msg))
+	assert.Equal(t, "867", msg.Device)
+
+	require.NoError(t, p.Close())
+	m = next(t, msgs)
+	assert.Equal(t, DefaultStatusTopic, m.Topic())
+	assert.Equal(t, Offline, string(m.Payload()))
+
+	// statuses are retained, positions are not.
+	late := listen(t, addr, "late")
+	retained := map[string]string{}
+	for i := 0; i < 2; i++ {
+		m = next(t, late)
+		assert.True(t, m.Retained())
+		retained[m.Topic()] = string(m.Payload())
+	}
+	assert.Equal(t, Offline, retained[DefaultStatusTopic])
+	assert.Contains(t, retained["gotrackery/egts/86_7_/session"], `"state":"online"`)
+	select {
+	case m = <-late:
+		t.Fatalf("unexpected message of %s", m.Topic())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPublisher_LastWill(t *testing.T) {
+	srv, addr := broker(t)
+	msgs := listen(t, addr, "listener")
+
+	p, err := NewPublisher(addr, WithClientID("gotrackery"))
+	require.NoError(t, err)
+	defer p.Close()
+	assert.Equal(t, Online, string(next(t, msgs).Payload()))
+
+	// connection is lost without disconnect, so the broker publishes the last will.
+	cl, ok := srv.Clients.Get("gotrackery")
+	require.True(t, ok)
+	cl.Stop(errors.New("connection lost"))
+	m := next(t, msgs)
+	assert.Equal(t, DefaultStatusTopic, m.Topic())
+	assert.Equal(t, Offline, string(m.Payload()))
+}
+
+func TestTopic(t *testing.T) {
+	assert.Equal(t, "gotrackery/unknown/a_b_c_d/position", Topic(DefaultTopic, "", "a/b+c#d"))
+	assert.True(t, ValidTopic(DefaultTopic))
+	assert.False(t, ValidTopic("gotrackery/+/position"))
+	assert.False(t, ValidTopic(""))
+}
@@ -0,0 +1,237 @@
+// Package nats provides the events subscriber publishing positions to NATS JetStream.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	_ event.Listener   = (*Publisher)(nil)
+	_ event.Subscriber = (*Publisher)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "nats"
+
+const (
+	// DefaultSubject is the template of positions subject.
+	DefaultSubject = "gotrackery.{protocol}.{device}.position"
+
+	defaultTimeout    = 10 * time.Second
+	defaultDuplicates = 2 * time.Minute
+)
+
+// ValidSubject reports whether the subject template is valid: not empty, without wildcards and spaces.
+func ValidSubject(tmpl string) bool {
+	return tmpl != "" && !strings.ContainsAny(tmpl, "*> \t\r\n")
+}
+
+// Subject expands the template placeholders {protocol} and {device}.
+// Token separators, wildcards and spaces of values are replaced by underscore, empty values are unknown.
+func Subject(tmpl, protocol, device string) string {
+	return strings.NewReplacer("{protocol}", token(protocol), "{device}", token(device)).Replace(tmpl)
+}
+
+// subjects returns the stream subjects matching all subjects of the template.
+func subjects(tmpl string) string {
+	return strings.NewReplacer("{protocol}", "*", "{device}", "*").Replace(tmpl)
+}
+
+func token(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// MsgID returns the de-duplication id of the position: the same position of the device retried
+// or received again from the device is stored by JetStream once within the duplicates window.
+func MsgID(pos common.Position) string {
+	return fmt.Sprintf("%s:%s:%d", pos.Protocol, pos.DeviceID, pos.DeviceTime.UnixNano())
+}
+
+// Option is a functional option for the publisher.
+type Option func(*Publisher)
+
+// WithSubject sets the template of positions subject. Default is DefaultSubject.
+func WithSubject(tmpl string) Option {
+	return func(p *Publisher) {
+		if ValidSubject(tmpl) {
+			p.subject = tmpl
+		}
+	}
+}
+
+// WithStream creates the stream capturing subjects of the template if it does not exist.
+// Duplicates is the window of messages de-duplication, default is 2m.
+func WithStream(name string, duplicates time.Duration) Option {
+	return func(p *Publisher) {
+		p.stream = name
+		if duplicates > 0 {
+			p.duplicates = duplicates
+		}
+	}
+}
+
+// WithEncoder sets the encoder of positions. Default is JSON.
+func WithEncoder(enc encoding.Encoder) Option {
+	return func(p *Publisher) {
+		if enc != nil {
+			p.encoder = enc
+		}
+	}
+}
+
+// WithConnOptions sets options of NATS connection, e.g. credentials.
+func WithConnOptions(opts ...natsio.Option) Option {
+	return func(p *Publisher) {
+		p.connOpts = append(p.connOpts, opts...)
+	}
+}
+
+// WithTimeout sets the time to connect and to wait for the publish acknowledgement. Default is 10s.
+func WithTimeout(to time.Duration) Option {
+	return func(p *Publisher) {
+		if to > 0 {
+			p.timeout = to
+		}
+	}
+}
+
+// Publisher publishes positions to JetStream subjects derived from protocol and device.
+// The position is reported as delivered when the stream acknowledges it, failed publishing
+// is returned to the dispatcher to retry it. Retries are not stored twice, every message
+// has de-duplication id of the device and the device time.
+type Publisher struct {
+	conn *natsio.Conn
+	js   jetstream.JetStream
+
+	subject    string
+	stream     string
+	duplicates time.Duration
+	encoder    encoding.Encoder
+	connOpts   []natsio.Option
+	timeout    time.Duration
+}
+
+// NewPublisher connects to NATS server, e.g. nats://localhost:4222.
+func NewPublisher(url string, opts ...Option) (*Publisher, error) {
+	if url == "" {
+		return nil, errors.New("no url")
+	}
+	p := &Publisher{
+		subject:    DefaultSubject,
+		duplicates: defaultDuplicates,
+		encoder:    encoding.JSON{},
+		timeout:    defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	copts := append([]natsio.Option{
+		natsio.Name("gotrackery"),
+		natsio.Timeout(p.timeout),
+		natsio.MaxReconnects(-1),
+	}, p.connOpts...)
+	conn, err := natsio.Connect(url, copts...)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", url, err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create jetstream: %w", err)
+	}
+	p.conn, p.js = conn, js
+
+	if p.stream != "" {
+		if err = p.createStream(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Publisher) createStream() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	_, err := p.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:       p.stream,
+		Subjects:   []string{subjects(p.subject)},
+		Duplicates: p.duplicates,
+	})
+	if err != nil && !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+		return fmt.Errorf("create stream %s: %w", p.stream, err)
+	}
+	return nil
+}
+
+func (p *Publisher) String() string {
+	return Name
+}
+
+func (p *Publisher) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionReceived, Name): p,
+	}
+}
+
+// Handle publishes the position and waits for the stream acknowledgement.
+func (p *Publisher) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	pos := eve.Position()
+	if pos == nil {
+		return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
+	}
+
+	data, err := p.encoder.Encode(*pos)
+	if err != nil {
+		return fmt.Errorf("encode position: %w", err)
+	}
+	msg := natsio.NewMsg(Subject(p.subject, pos.Protocol, pos.DeviceID))
+	msg.Data = data
+	msg.Header.Set("Content-Type", p.encoder.ContentType())
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if _, err = p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(MsgID(*pos))); err != nil {
+		return fmt.Errorf("publish to %s: %w", msg.Subject, err)
+	}
+	return nil
+}
+
+// Close flushes buffered messages and closes the connection.
+func (p *Publisher) Close() error {
+	err := p.conn.FlushTimeout(p.timeout)
+	p.conn.Close()
+	if err != nil {
+		return fmt.Errorf("flush nats connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/nats-io/nats-server/v2/server"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stream = "POSITIONS"
+
+// jetStream starts in-process NATS server with JetStream, it returns its url.
+func jetStream(t *testing.T) string {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	go srv.Start()
+	require.True(t, srv.ReadyForConnections(5*time.Second))
+	t.Cleanup(srv.Shutdown)
+	return srv.ClientURL()
+}
+
+func positionEvent(device string, at time.Time) *ev.GenericEvent {
+	pos := common.Position{Protocol: "egts", DeviceID: device, DeviceTime: at}
+	e := new(ev.GenericEvent)
+	e.SetPosition(pos)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, Name))
+	return e
+}
+
+func TestPublisher_Handle(t *testing.T) {
+	url := jetStream(t)
+	p, err := NewPublisher(url, WithStream(stream, time.Minute))
+	require.NoError(t, err)
+	defer p.Close()
+
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	require.NoError(t, p.Handle(positionEvent("867.1", at)))
+	// the retry of the same position is not stored twice.
+	require.NoError(t, p.Handle(positionEvent("867.1", at)))
+	require.NoError(t, p.Handle(positionEvent("867.1", at.Add(time.Second))))
+	require.NoError(t, p.Handle(positionEvent("868", at)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := p.js.Stream(ctx, stream)
+	require.NoError(t, err)
+	info, err := s.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), info.State.Msgs)
+	assert.Equal(t, time.Minute, info.Config.Duplicates)
+
+	m, err := s.GetMsg(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "gotrackery.egts.867_1.position", m.Subject)
+	assert.Equal(t, "application/json", m.Header.Get("Content-Type"))
+	assert.Equal(t, MsgID(*positionEvent("867.1", at).Position()), m.Header.Get(jetstream.MsgIDHeader))
+	var msg encoding.Message
+	require.NoError(t, json.Unmarshal(m.Data, &msg))
+	assert.Equal(t, "867.1", msg.Device)
+	assert.Equal(t, at, msg.Time)
+
+	m, err = s.GetMsg(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "gotrackery.egts.868.position", m.Subject)
+}
+
+func TestPublisher_NoStream(t *testing.T) {
+	url := jetStream(t)
+	p, err := NewPublisher(url, WithTimeout(time.Second))
+	require.NoError(t, err)
+	defer p.Close()
+
+	// the subject is not captured by a stream, so the publishing is not acknowledged.
+	assert.Error(t, p.Handle(positionEvent("867", time.Now())))
+}
+
+func TestPublisher_DispatcherTimeout(t *testing.T) {
+	// the publishing not acknowledged in time is retried by the dispatcher.
+	url := jetStream(t)
+	nc, err := natsio.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	// the subscriber doesn't acknowledge the first publishing, the stream is created after it.
+	received := make(chan struct{}, 1)
+	sub, err := nc.Subscribe(subjects(DefaultSubject), func(*natsio.Msg) { received <- struct{}{} })
+	require.NoError(t, err)
+
+	p, err := NewPublisher(url, WithTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer p.Close()
+
+	l := zerolog.Nop()
+	d := ev.NewDispatcher(l, time.Minute)
+	d.RegisterEventSubscriber(p)
+	d.DispatchPositions(&l, []common.Position{{Protocol: "egts", DeviceID: "867", DeviceTime: time.Now()}})
+
+	<-received
+	require.NoError(t, sub.Unsubscribe())
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: stream, Subjects: []string{subjects(DefaultSubject)}})
+	require.NoError(t, err)
+
+	assert.Equal(t, ev.Stats{Delivered: 1}, d.Shutdown(context.Background()))
+	info, err := s.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), info.State.Msgs)
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "gotrackery.unknown.a_b_c_d.position", Subject(DefaultSubject, "", "a.b*c>d"))
+	assert.Equal(t, "gotrackery.*.*.position", subjects(DefaultSubject))
+	assert.True(t, ValidSubject(DefaultSubject))
+	assert.False(t, ValidSubject("gotrackery.>"))
+	assert.False(t, ValidSubject(""))
+}
@@ -0,0 +1,254 @@
+// Package osmand implements HTTP ingestion of OsmAnd protocol used by Traccar Client and similar applications.
+// Positions are passed as query or form parameters (?id=...&lat=...&lon=...&timestamp=...)
+// or as JSON body of Traccar Client.
+package osmand
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	Proto = "osmand"
+
+	knot = 1.852
+	mps  = 3.6
+
+	accuracy = "accuracy"
+	battery  = "battery"
+	charge   = "charge"
+	moving   = "motion"
+	evnt     = "event"
+	activity = "activity"
+)
+
+var (
+	// ErrNoDevice is returned when request has no device identifier.
+	ErrNoDevice = errors.New("no device id")
+	// ErrMalformed is returned when request parameter or body can not be parsed.
+	ErrMalformed = errors.New("malformed request")
+)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// DecodeQuery decodes the position from OsmAnd request parameters.
+// Time of the position is now, if the timestamp parameter is absent.
+// Unknown parameters are kept as attributes.
+func DecodeQuery(v url.Values, now time.Time) (p common.Position, err error) {
+	p = common.Position{Protocol: Proto, DeviceTime: now}
+	p.Location.Type = geom.DimXY
+	p.Location.Valid = true
+	for key, values := range v {
+		if len(values) == 0 {
+			continue
+		}
+		if err = decodeParam(&p, key, values[0]); err != nil {
+			return p, err
+		}
+	}
+	if p.DeviceID == "" {
+		return p, ErrNoDevice
+	}
+	return p, nil
+}
+
+func decodeParam(p *common.Position, key, value string) (err error) {
+	switch key {
+	case "id", "deviceid":
+		p.DeviceID = value
+	case "valid":
+		p.Location.Valid = value == "1" || strings.EqualFold(value, "true")
+	case "timestamp":
+		p.DeviceTime, err = parseTimestamp(value)
+	case "lat":
+		p.Location.Y, err = parseFloat(key, value)
+	case "lon":
+		p.Location.X, err = parseFloat(key, value)
+	case "location":
+		lat, lon, ok := strings.Cut(value, ",")
+		if !ok {
+			return fmt.Errorf("%w: location %q", ErrMalformed, value)
+		}
+		if p.Location.Y, err = parseFloat(key, lat); err != nil {
+			return err
+		}
+		p.Location.X, err = parseFloat(key, lon)
+	case "speed":
+		var speed float64
+		speed, err = parseFloat(key, value)
+		p.Speed = null.NewFloat(speed*knot, err == nil)
+	case "bearing", "heading":
+		var course float64
+		course, err = parseFloat(key, value)
+		p.Course = null.NewFloat(course, err == nil)
+	case "altitude":
+		p.Location.Z, err = parseFloat(key, value)
+		p.Location.Type = geom.DimXYZ
+	case "hdop", "accuracy", "batt":
+		var f float64
+		f, err = parseFloat(key, value)
+		name := map[string]string{"hdop": common.HDOP, "accuracy": accuracy, "batt": battery}[key]
+		p.Attributes = p.Attributes.AppendNullFloat(name, null.NewFloat(f, err == nil))
+	default:
+		if i, e := strconv.ParseInt(value, 10, 64); e == nil {
+			p.Attributes = p.Attributes.AppendNullInt(key, null.NewInt(i, true))
+		} else if f, e := strconv.ParseFloat(value, 64); e == nil {
+			p.Attributes = p.Attributes.AppendNullFloat(key, null.NewFloat(f, true))
+		} else {
+			p.Attributes = p.Attributes.AppendNullString(key, null.NewString(value, true))
+		}
+	}
+	return err
+}
+
+// parseTimestamp parses unix time in seconds or milliseconds or formatted date time.
+func parseTimestamp(value string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if ts <= math.MaxInt32 {
+			return time.Unix(ts, 0).UTC(), nil
+		}
+		return time.UnixMilli(ts).UTC(), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: timestamp %q", ErrMalformed, value)
+}
+
+func parseFloat(name, value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q", ErrMalformed, name, value)
+	}
+	return f, nil
+}
+
+type jsonBody struct {
+	DeviceID string          `json:"device_id"`
+	Location json.RawMessage `json:"location"`
+}
+
+type jsonLocation struct {
+	Timestamp time.Time `json:"timestamp"`
+	Coords    struct {
+		Latitude  float64  `json:"latitude"`
+		Longitude float64  `json:"longitude"`
+		Accuracy  *float64 `json:"accuracy"`
+		Speed     *float64 `json:"speed"`
+		Heading   *float64 `json:"heading"`
+		Altitude  *float64 `json:"altitude"`
+	} `json:"coords"`
+	IsMoving *bool    `json:"is_moving"`
+	Odometer *float64 `json:"odometer"`
+	Event    string   `json:"event"`
+	Battery  *struct {
+		Level      *float64 `json:"level"`
+		IsCharging *bool    `json:"is_charging"`
+	} `json:"battery"`
+	Activity *struct {
+		Type string `json:"type"`
+	} `json:"activity"`
+}
+
+// DecodeJSON decodes positions from Traccar Client JSON body.
+// Location of the body is a single object or an array of objects.
+// Speed of the location is in m/s, negative speed and heading mean unknown values.
+func DecodeJSON(b []byte) ([]common.Position, error) {
+	var body jsonBody
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	if body.DeviceID == "" {
+		return nil, ErrNoDevice
+	}
+
+	var locs []jsonLocation
+	switch {
+	case len(body.Location) == 0:
+		return nil, fmt.Errorf("%w: no location", ErrMalformed)
+	case body.Location[0] == '[':
+		if err := json.Unmarshal(body.Location, &locs); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+	default:
+		var loc jsonLocation
+		if err := json.Unmarshal(body.Location, &loc); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+		locs = append(locs, loc)
+	}
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("%w: empty location", ErrMalformed)
+	}
+
+	poss := make([]common.Position, 0, len(locs))
+	for _, loc := range locs {
+		poss = append(poss, loc.position(body.DeviceID))
+	}
+	return poss, nil
+}
+
+func (l jsonLocation) position(device string) common.Position {
+	p := common.Position{Protocol: Proto, DeviceID: device, DeviceTime: l.Timestamp.UTC()}
+	p.Location.X = l.Coords.Longitude
+	p.Location.Y = l.Coords.Latitude
+	p.Location.Type = geom.DimXY
+	p.Location.Valid = true
+	if l.Coords.Altitude != nil {
+		p.Location.Z = *l.Coords.Altitude
+		p.Location.Type = geom.DimXYZ
+	}
+	if l.Coords.Speed != nil && *l.Coords.Speed >= 0 {
+		p.Speed = null.NewFloat(*l.Coords.Speed*mps, true)
+	}
+	if l.Coords.Heading != nil && *l.Coords.Heading >= 0 {
+		p.Course = null.NewFloat(*l.Coords.Heading, true)
+	}
+	if l.Coords.Accuracy != nil {
+		p.Attributes = p.Attributes.AppendNullFloat(accuracy, null.FloatFromPtr(l.Coords.Accuracy))
+	}
+	if l.IsMoving != nil {
+		p.Attributes = p.Attributes.AppendNullInt(moving, null.NewInt(boolToInt(*l.IsMoving), true))
+	}
+	if l.Odometer != nil {
+		p.Attributes = p.Attributes.AppendNullFloat(common.Odometer, null.FloatFromPtr(l.Odometer))
+	}
+	if l.Event != "" {
+		p.Attributes = p.Attributes.AppendNullString(evnt, null.NewString(l.Event, true))
+	}
+	if l.Battery != nil {
+		if l.Battery.Level != nil {
+			p.Attributes = p.Attributes.AppendNullFloat(battery, null.NewFloat(*l.Battery.Level*100, true)) //nolint:gomnd
+		}
+		if l.Battery.IsCharging != nil {
+			p.Attributes = p.Attributes.AppendNullInt(charge, null.NewInt(boolToInt(*l.Battery.IsCharging), true))
+		}
+	}
+	if l.Activity != nil && l.Activity.Type != "" {
+		p.Attributes = p.Attributes.AppendNullString(activity, null.NewString(l.Activity.Type, true))
+	}
+	return p
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
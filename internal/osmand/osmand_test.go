@@ -0,0 +1,233 @@
+package osmand
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gookit/event"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	traccarJSON = `{"location":{"timestamp":"2023-05-01T10:20:30.000Z","coords":{"latitude":55.75,` +
+		`"longitude":37.61,"accuracy":5,"speed":10,"heading":90,"altitude":150},"is_moving":true,` +
+		`"odometer":1200,"event":"motionchange","battery":{"level":0.5,"is_charging":false},` +
+		`"activity":{"type":"in_vehicle"}},"device_id":"123456"}`
+	traccarBatchJSON = `{"location":[{"timestamp":"2023-05-01T10:20:30Z","coords":{"latitude":1,"longitude":2,` +
+		`"speed":-1,"heading":-1}},{"timestamp":"2023-05-01T10:20:40Z","coords":{"latitude":3,"longitude":4}}],` +
+		`"device_id":"123456"}`
+)
+
+func TestDecodeQuery(t *testing.T) {
+	now := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		query   string
+		want    common.Position
+		wantErr error
+	}{
+		{
+			name:  "full",
+			query: "id=123456&timestamp=1682936430&lat=55.75&lon=37.61&speed=10&bearing=90&altitude=150&accuracy=5&batt=80&driverUniqueId=d1",
+			want: common.Position{
+				Location:   common.Location{Coordinates: geom.Coordinates{XY: geom.XY{X: 37.61, Y: 55.75}, Z: 150, Type: geom.DimXYZ}, Valid: true},
+				Protocol:   Proto,
+				DeviceID:   "123456",
+				DeviceTime: time.Date(2023, 5, 1, 10, 20, 30, 0, time.UTC),
+				Attributes: common.Attributes{accuracy: 5.0, battery: 80.0, "driverUniqueId": "d1"},
+			},
+		},
+		{
+			name:  "milliseconds and location",
+			query: "deviceid=123456&timestamp=1682936430500&location=55.75,37.61&valid=false&hdop=1.2",
+			want: common.Position{
+				Location:   common.Location{Coordinates: geom.Coordinates{XY: geom.XY{X: 37.61, Y: 55.75}, Type: geom.DimXY}},
+				Protocol:   Proto,
+				DeviceID:   "123456",
+				DeviceTime: time.Date(2023, 5, 1, 10, 20, 30, 500000000, time.UTC),
+				Attributes: common.Attributes{common.HDOP: 1.2},
+			},
+		},
+		{
+			name:  "formatted time",
+			query: "id=1&timestamp=2023-05-01+10:20:30&lat=1&lon=2&sats=7",
+			want: common.Position{
+				Location:   common.Location{Coordinates: geom.Coordinates{XY: geom.XY{X: 2, Y: 1}, Type: geom.DimXY}, Valid: true},
+				Protocol:   Proto,
+				DeviceID:   "1",
+				DeviceTime: time.Date(2023, 5, 1, 10, 20, 30, 0, time.UTC),
+				Attributes: common.Attributes{"sats": int64(7)},
+			},
+		},
+		{
+			name:  "no timestamp",
+			query: "id=1&lat=1&lon=2",
+			want: common.Position{
+				Location:   common.Location{Coordinates: geom.Coordinates{XY: geom.XY{X: 2, Y: 1}, Type: geom.DimXY}, Valid: true},
+				Protocol:   Proto,
+				DeviceID:   "1",
+				DeviceTime: now,
+			},
+		},
+		{name: "no device", query: "lat=1&lon=2", wantErr: ErrNoDevice},
+		{name: "bad latitude", query: "id=1&lat=north&lon=2", wantErr: ErrMalformed},
+		{name: "bad timestamp", query: "id=1&timestamp=yesterday", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			got, err := DecodeQuery(v, now)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			assert.Equal(t, tt.want.Location, got.Location)
+			assert.Equal(t, tt.want.DeviceID, got.DeviceID)
+			assert.Equal(t, tt.want.Protocol, got.Protocol)
+			assert.Equal(t, tt.want.DeviceTime, got.DeviceTime)
+			assert.Equal(t, tt.want.Attributes, got.Attributes)
+		})
+	}
+}
+
+func TestDecodeQuery_SpeedCourse(t *testing.T) {
+	v, err := url.ParseQuery("id=1&lat=1&lon=2&speed=10&heading=45.5")
+	require.NoError(t, err)
+	p, err := DecodeQuery(v, time.Now())
+	require.NoError(t, err)
+	assert.InDelta(t, 18.52, p.Speed.Float64, 1e-9)
+	assert.Equal(t, 45.5, p.Course.Float64)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	poss, err := DecodeJSON([]byte(traccarJSON))
+	require.NoError(t, err)
+	require.Len(t, poss, 1)
+	p := poss[0]
+	assert.Equal(t, "123456", p.DeviceID)
+	assert.Equal(t, Proto, p.Protocol)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 20, 30, 0, time.UTC), p.DeviceTime)
+	assert.Equal(t, common.Location{Coordinates: geom.Coordinates{XY: geom.XY{X: 37.61, Y: 55.75}, Z: 150, Type: geom.DimXYZ}, Valid: true}, p.Location)
+	assert.InDelta(t, 36.0, p.Speed.Float64, 1e-9)
+	assert.Equal(t, 90.0, p.Course.Float64)
+	assert.Equal(t, common.Attributes{
+		accuracy: 5.0, moving: int64(1), common.Odometer: 1200.0, evnt: "motionchange",
+		battery: 50.0, charge: int64(0), activity: "in_vehicle",
+	}, p.Attributes)
+
+	poss, err = DecodeJSON([]byte(traccarBatchJSON))
+	require.NoError(t, err)
+	require.Len(t, poss, 2)
+	assert.False(t, poss[0].Speed.Valid)
+	assert.False(t, poss[0].Course.Valid)
+	assert.Equal(t, 3.0, poss[1].Y)
+
+	_, err = DecodeJSON([]byte(`{"location":{}}`))
+	assert.ErrorIs(t, err, ErrNoDevice)
+	_, err = DecodeJSON([]byte(`{"device_id":"1","location":[]}`))
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = DecodeJSON([]byte(`{"device_id":`))
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+// subscriber collects received positions.
+type subscriber struct {
+	mu   sync.Mutex
+	poss []common.Position
+}
+
+func (s *subscriber) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", ev.PositionReceived, "test"): s}
+}
+
+func (s *subscriber) Handle(e event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.poss = append(s.poss, *e.(*ev.GenericEvent).Position())
+	return nil
+}
+
+func (s *subscriber) positions() []common.Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]common.Position(nil), s.poss...)
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	srv := NewServer(zerolog.Nop(), ":0", WithTimeout(time.Second))
+	sub := new(subscriber)
+	srv.RegisterEventSubscriber(sub)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		do         func() (*http.Response, error)
+		wantStatus int
+	}{
+		{
+			name:       "get",
+			do:         func() (*http.Response, error) { return http.Get(ts.URL + "/?id=1&lat=1&lon=2") },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "post query",
+			do:         func() (*http.Response, error) { return http.Post(ts.URL+"/?id=2&lat=1&lon=2", "", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "post form",
+			do: func() (*http.Response, error) {
+				return http.PostForm(ts.URL, url.Values{"id": {"3"}, "lat": {"1"}, "lon": {"2"}})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "post json",
+			do: func() (*http.Response, error) {
+				return http.Post(ts.URL, "application/json; charset=utf-8", strings.NewReader(traccarBatchJSON))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no device",
+			do:         func() (*http.Response, error) { return http.Get(ts.URL + "/?lat=1&lon=2") },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "method not allowed",
+			do: func() (*http.Response, error) {
+				req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/?id=1", nil)
+				return http.DefaultClient.Do(req)
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.do()
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	require.Eventually(t, func() bool { return len(sub.positions()) == 5 }, time.Second, 10*time.Millisecond)
+	devices := make(map[string]int)
+	for _, p := range sub.positions() {
+		devices[p.DeviceID]++
+	}
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1, "123456": 2}, devices)
+}
@@ -0,0 +1,195 @@
+package osmand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultTimeout         = 10 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+	maxBodySize            = 1 << 20
+)
+
+type ServerOption func(*Server)
+
+// WithTimeout sets read and write timeouts of the server. Default is 10 seconds.
+func WithTimeout(to time.Duration) ServerOption {
+	return func(s *Server) {
+		if to == 0 {
+			to = defaultTimeout
+		}
+		s.timeout = to
+	}
+}
+
+// WithShutdownTimeout sets the time to wait for pending deliveries of events on shutdown. Default is 30 seconds.
+func WithShutdownTimeout(to time.Duration) ServerOption {
+	return func(s *Server) {
+		if to == 0 {
+			to = defaultShutdownTimeout
+		}
+		s.shutdownTimeout = to
+	}
+}
+
+// WithDispatcherOptions sets options of the events dispatcher owned by the server,
+// they are ignored if the dispatcher is shared.
+func WithDispatcherOptions(opts ...ev.DispatcherOption) ServerOption {
+	return func(s *Server) {
+		s.dispatcherOpts = opts
+	}
+}
+
+// WithDispatcher sets events dispatcher shared with other servers.
+// Shared dispatcher is not closed by the server.
+func WithDispatcher(d *ev.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.dispatcher = d
+	}
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// Server is an HTTP server for handling OsmAnd requests of devices.
+// Decoded positions are sent to the subscribers registered by RegisterEventSubscriber.
+type Server struct {
+	*ev.Dispatcher
+	logger          zerolog.Logger
+	timeout         time.Duration
+	shutdownTimeout time.Duration
+	dispatcher      *ev.Dispatcher
+	dispatcherOpts  []ev.DispatcherOption
+	srv             *http.Server
+	listener        net.Listener
+	now             func() time.Time
+}
+
+// NewServer creates a new OsmAnd HTTP server.
+func NewServer(l zerolog.Logger, address string, opts ...ServerOption) *Server {
+	s := &Server{
+		logger:          l.With().Str("proto", Proto).Logger(),
+		timeout:         defaultTimeout,
+		shutdownTimeout: defaultShutdownTimeout,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Dispatcher = s.dispatcher
+	if s.Dispatcher == nil {
+		s.Dispatcher = ev.NewDispatcher(s.logger, s.timeout, s.dispatcherOpts...)
+	}
+	s.srv = &http.Server{
+		Addr:         address,
+		Handler:      s,
+		ReadTimeout:  s.timeout,
+		WriteTimeout: s.timeout,
+	}
+	return s
+}
+
+// ServeHTTP handles GET and POST requests with position in parameters or in JSON body.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With().
+		Str("session", gonanoid.Must(8)).
+		Str("remote", r.RemoteAddr).
+		Logger()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	poss, err := s.decode(w, r)
+	if err != nil {
+		logger.Warn().Err(err).Str("query", r.URL.RawQuery).Msg("got protocol error")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logger.Debug().Str("device", poss[0].DeviceID).Int("positions", len(poss)).Send()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	if err = s.Commit(ctx, &logger, poss); err != nil {
+		// client retries the request later.
+		logger.Warn().Err(err).Str("device", poss[0].DeviceID).Msg("positions are not committed")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) decode(w http.ResponseWriter, r *http.Request) ([]common.Position, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/json" {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		return DecodeJSON(b)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	p, err := DecodeQuery(r.Form, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return []common.Position{p}, nil
+}
+
+// ListenAndServe starts the HTTP server.
+func (s *Server) ListenAndServe() error {
+	err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Listen binds the server to the address.
+func (s *Server) Listen() (err error) {
+	s.listener, err = net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening on interface: %w", err)
+	}
+	return nil
+}
+
+// Serve handles requests until the server is shut down.
+func (s *Server) Serve() error {
+	defer func() {
+		if s.dispatcher == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+			defer cancel()
+			s.logger.Info().Object("deliveries", s.Dispatcher.Shutdown(ctx)).Msg("server stopped")
+		}
+	}()
+
+	s.logger.Info().Str("local", s.listener.Addr().String()).Msg("server starts serving")
+	err := s.srv.Serve(s.listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving: %w", err)
+	}
+	return nil
+}
+
+// Shutdown stops the server, active requests are served until timeout.
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
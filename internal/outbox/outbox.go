@@ -0,0 +1,537 @@
+// Package outbox implements the durable write-ahead log of positions for the events dispatcher.
+// Every position is appended to the log before delivery and acked by every subscriber after delivery,
+// so positions not delivered until shutdown or crash are replayed after restart.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+)
+
+const (
+	cursorsFile          = "cursors.json"
+	deadLetterDir        = "deadletter"
+	defaultSegmentSize   = 64 << 20
+	defaultFlushInterval = time.Second
+)
+
+// ErrClosed is returned when the position is appended to the closed outbox.
+var ErrClosed = errors.New("outbox is closed")
+
+var errStop = errors.New("stop")
+
+// Option is a functional option for the outbox.
+type Option func(*Outbox)
+
+// WithSegmentSize sets the size of the segment file to roll the next one. Default is 64MB.
+func WithSegmentSize(n int64) Option {
+	return func(o *Outbox) {
+		if n > 0 {
+			o.segmentSize = n
+		}
+	}
+}
+
+// WithFlushInterval sets the interval of syncing the segment and saving cursors to disk,
+// so it is the time of records lost on power failure unless they are synced by Sync. Default is 1 second.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *Outbox) {
+		if d > 0 {
+			o.flushInterval = d
+		}
+	}
+}
+
+// Stats are the metrics of the outbox.
+type Stats struct {
+	// Head is the offset of the last appended position.
+	Head uint64
+	// Segments is the number of segment files.
+	Segments int
+	// Size is the size of segment files in bytes.
+	Size int64
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (s Stats) MarshalZerologObject(e *zerolog.Event) {
+	e.Uint64("head", s.Head)
+	e.Int("segments", s.Segments)
+	e.Int64("size", s.Size)
+}
+
+// cursor is the position of the subscriber in the log.
+// Positions are acked out of order by concurrent workers, so acked ones ahead of the cursor
+// are kept until the gap is filled.
+type cursor struct {
+	acked uint64
+	ahead map[uint64]struct{}
+}
+
+// Outbox is the log of positions in segment files of the directory with cursors of subscribers.
+// Segments acked by all subscribers are removed by compaction.
+// Delivery is at least once: positions acked after the last flush are replayed after crash.
+type Outbox struct {
+	logger        zerolog.Logger
+	dir           string
+	segmentSize   int64
+	flushInterval time.Duration
+
+	mu     sync.Mutex
+	segs   []*segment
+	w      *os.File
+	head   uint64
+	synced uint64
+	// syncMu serializes syncs of Sync, callers waiting for it are committed by one sync.
+	syncMu  sync.Mutex
+	cursors map[string]*cursor
+	dirty   bool
+	closed  bool
+	done    chan struct{}
+	flushed chan struct{}
+}
+
+// Open opens the outbox in the directory, the directory is created if it does not exist.
+func Open(l zerolog.Logger, dir string, opts ...Option) (*Outbox, error) {
+	o := &Outbox{
+		logger:        l.With().Str("outbox", dir).Logger(),
+		dir:           dir,
+		segmentSize:   defaultSegmentSize,
+		flushInterval: defaultFlushInterval,
+		cursors:       make(map[string]*cursor),
+		done:          make(chan struct{}),
+		flushed:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+	if err := o.loadCursors(); err != nil {
+		return nil, err
+	}
+	if err := o.loadSegments(); err != nil {
+		return nil, err
+	}
+	o.logger.Info().Object("stats", o.Stats()).Int("subscribers", len(o.cursors)).Msg("outbox opened")
+
+	go o.flushLoop()
+	return o, nil
+}
+
+func (o *Outbox) loadCursors() error {
+	b, err := os.ReadFile(filepath.Join(o.dir, cursorsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read cursors: %w", err)
+	}
+	acked := make(map[string]uint64)
+	if err = json.Unmarshal(b, &acked); err != nil {
+		return fmt.Errorf("unmarshal cursors: %w", err)
+	}
+	for name, off := range acked {
+		o.cursors[name] = &cursor{acked: off, ahead: make(map[uint64]struct{})}
+		if off > o.head {
+			o.head = off
+		}
+	}
+	return nil
+}
+
+// loadSegments finds the head offset scanning the last segment and truncates its damaged tail.
+func (o *Outbox) loadSegments() (err error) {
+	o.segs, err = listSegments(o.dir)
+	if err != nil {
+		return err
+	}
+	for i, s := range o.segs {
+		if i+1 < len(o.segs) {
+			s.last = o.segs[i+1].first - 1
+			if fi, err := os.Stat(s.path); err == nil {
+				s.size = fi.Size()
+			}
+			continue
+		}
+
+		s.last = s.first - 1
+		valid, err := s.scan(func(off uint64, _ []byte) error {
+			s.last = off
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.size = valid
+		if err = os.Truncate(s.path, valid); err != nil {
+			return fmt.Errorf("truncate segment: %w", err)
+		}
+		if s.last > o.head {
+			o.head = s.last
+		}
+		o.w, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Append writes the position to the log and returns its offset. The position is synced to disk
+// by the next flush, Sync waits for it.
+func (o *Outbox) Append(pos common.Position) (uint64, error) {
+	payload, err := json.Marshal(pos)
+	if err != nil {
+		return 0, fmt.Errorf("marshal position: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return 0, ErrClosed
+	}
+	if o.w == nil || o.segs[len(o.segs)-1].size >= o.segmentSize {
+		if err = o.roll(); err != nil {
+			return 0, err
+		}
+	}
+	off := o.head + 1
+	rec := encodeRecord(make([]byte, 0, headerSize+len(payload)), off, payload)
+	if _, err = o.w.Write(rec); err != nil {
+		return 0, fmt.Errorf("write segment: %w", err)
+	}
+	o.head = off
+	s := o.segs[len(o.segs)-1]
+	s.last = off
+	s.size += int64(len(rec))
+	return off, nil
+}
+
+// Sync waits until positions up to the offset are synced to disk. Concurrent calls are grouped:
+// callers waiting for the running sync are committed by the next one covering all of them.
+func (o *Outbox) Sync(off uint64) error {
+	o.syncMu.Lock()
+	defer o.syncMu.Unlock()
+	o.mu.Lock()
+	if o.synced >= off {
+		o.mu.Unlock()
+		return nil
+	}
+	if o.closed {
+		o.mu.Unlock()
+		return ErrClosed
+	}
+	w, head := o.w, o.head
+	o.mu.Unlock()
+
+	err := w.Sync()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil {
+		o.synced = max(o.synced, head)
+	}
+	// the segment may be rolled and synced meanwhile.
+	if o.synced >= off {
+		return nil
+	}
+	return fmt.Errorf("sync segment: %w", err)
+}
+
+// roll closes the active segment and creates the next one.
+func (o *Outbox) roll() (err error) {
+	if o.w != nil {
+		if err = o.w.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+		o.synced = o.head
+		if err = o.w.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+	}
+	s := &segment{path: segmentPath(o.dir, o.head+1), first: o.head + 1, last: o.head}
+	o.w, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		o.w = nil
+		return fmt.Errorf("create segment: %w", err)
+	}
+	o.segs = append(o.segs, s)
+	o.compact()
+	return nil
+}
+
+// Subscribe registers the cursor of the subscriber and returns the last acked offset.
+// New subscriber starts at the head, so it gets only positions appended after.
+func (o *Outbox) Subscribe(name string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	c, ok := o.cursors[name]
+	if !ok {
+		c = &cursor{acked: o.head, ahead: make(map[uint64]struct{})}
+		o.cursors[name] = c
+		o.dirty = true
+	}
+	return c.acked
+}
+
+// Retain removes cursors of subscribers other than the names, e.g. ones removed from the configuration,
+// so they do not hold up compaction. It returns names of removed cursors.
+func (o *Outbox) Retain(names ...string) []string {
+	keep := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		keep[name] = struct{}{}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var removed []string
+	for name := range o.cursors {
+		if _, ok := keep[name]; !ok {
+			delete(o.cursors, name)
+			removed = append(removed, name)
+		}
+	}
+	if len(removed) > 0 {
+		o.dirty = true
+	}
+	return removed
+}
+
+// Ack marks the position delivered to the subscriber.
+func (o *Outbox) Ack(name string, off uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	c, ok := o.cursors[name]
+	if !ok || off <= c.acked {
+		return
+	}
+	if off != c.acked+1 {
+		c.ahead[off] = struct{}{}
+		return
+	}
+	c.acked = off
+	for {
+		if _, ok = c.ahead[c.acked+1]; !ok {
+			break
+		}
+		delete(c.ahead, c.acked+1)
+		c.acked++
+	}
+	o.dirty = true
+}
+
+// deadLetter is the record of the dead letter file.
+type deadLetter struct {
+	Offset   uint64          `json:"offset"`
+	Time     time.Time       `json:"time"`
+	Error    string          `json:"error"`
+	Position common.Position `json:"position"`
+}
+
+// DeadLetter appends the position the subscriber failed to handle to its dead letter file
+// <dir>/deadletter/<name>.ndjson, so the position may be acked without losing it.
+func (o *Outbox) DeadLetter(name string, off uint64, pos common.Position, cause error) error {
+	b, err := json.Marshal(deadLetter{Offset: off, Time: time.Now().UTC(), Error: cause.Error(), Position: pos})
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	dir := filepath.Join(o.dir, deadLetterDir)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create dead letter dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".ndjson"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open dead letter file: %w", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("sync dead letter: %w", err)
+	}
+	return nil
+}
+
+// Unacked returns the number of positions appended after the cursor of the subscriber.
+func (o *Outbox) Unacked(name string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	c, ok := o.cursors[name]
+	if !ok {
+		return 0
+	}
+	return o.head - c.acked - uint64(len(c.ahead))
+}
+
+// Head returns the offset of the last appended position.
+func (o *Outbox) Head() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.head
+}
+
+// Replay calls fn for every position of the subscriber after its cursor up to the offset inclusive.
+// Replay stops on the first error of fn.
+func (o *Outbox) Replay(name string, to uint64, fn func(off uint64, pos common.Position) error) error {
+	o.mu.Lock()
+	c, ok := o.cursors[name]
+	if !ok {
+		o.mu.Unlock()
+		return nil
+	}
+	from := c.acked + 1
+	segs := make([]segment, 0, len(o.segs))
+	for _, s := range o.segs {
+		if s.last >= from && s.first <= to {
+			segs = append(segs, *s)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, s := range segs {
+		_, err := s.scan(func(off uint64, payload []byte) error {
+			if off < from {
+				return nil
+			}
+			if off > to {
+				return errStop
+			}
+			var pos common.Position
+			if err := json.Unmarshal(payload, &pos); err != nil {
+				o.logger.Error().Err(err).Uint64("offset", off).Msg("unmarshal position")
+				return nil
+			}
+			return fn(off, pos)
+		})
+		if errors.Is(err, errStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact removes segments acked by all subscribers, the active segment is kept.
+func (o *Outbox) Compact() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.compact()
+}
+
+func (o *Outbox) compact() {
+	acked := o.head
+	for _, c := range o.cursors {
+		if c.acked < acked {
+			acked = c.acked
+		}
+	}
+	n := 0
+	for n < len(o.segs)-1 && o.segs[n].last <= acked {
+		if err := os.Remove(o.segs[n].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			o.logger.Error().Err(err).Str("segment", o.segs[n].path).Msg("remove segment")
+			break
+		}
+		o.logger.Debug().Str("segment", o.segs[n].path).Msg("segment compacted")
+		n++
+	}
+	o.segs = o.segs[n:]
+}
+
+// Stats returns the metrics of the outbox.
+func (o *Outbox) Stats() Stats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := Stats{Head: o.head, Segments: len(o.segs)}
+	for _, seg := range o.segs {
+		s.Size += seg.size
+	}
+	return s
+}
+
+func (o *Outbox) flushLoop() {
+	defer close(o.flushed)
+	t := time.NewTicker(o.flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-t.C:
+			o.mu.Lock()
+			if err := o.flush(); err != nil {
+				o.logger.Error().Err(err).Msg("flush outbox")
+			}
+			o.compact()
+			o.mu.Unlock()
+		}
+	}
+}
+
+// flush syncs the active segment and saves cursors.
+func (o *Outbox) flush() error {
+	if o.w != nil {
+		if err := o.w.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+		o.synced = o.head
+	}
+	if !o.dirty {
+		return nil
+	}
+	acked := make(map[string]uint64, len(o.cursors))
+	for name, c := range o.cursors {
+		acked[name] = c.acked
+	}
+	b, err := json.Marshal(acked)
+	if err != nil {
+		return fmt.Errorf("marshal cursors: %w", err)
+	}
+	path := filepath.Join(o.dir, cursorsFile)
+	if err = os.WriteFile(path+".tmp", b, 0o644); err != nil {
+		return fmt.Errorf("write cursors: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("replace cursors: %w", err)
+	}
+	o.dirty = false
+	return nil
+}
+
+// Close flushes the outbox and closes the active segment.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	close(o.done)
+	<-o.flushed
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := o.flush()
+	o.compact()
+	if o.w != nil {
+		if cerr := o.w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendPositions(t *testing.T, o *Outbox, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		off, err := o.Append(common.Position{DeviceID: strconv.Itoa(i)})
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), off)
+	}
+}
+
+func replayed(t *testing.T, o *Outbox, name string) (devices []string) {
+	t.Helper()
+	err := o.Replay(name, o.Head(), func(off uint64, pos common.Position) error {
+		assert.Equal(t, strconv.FormatUint(off, 10), pos.DeviceID)
+		devices = append(devices, pos.DeviceID)
+		return nil
+	})
+	require.NoError(t, err)
+	return devices
+}
+
+func TestOutbox_Replay(t *testing.T) {
+	dir := t.TempDir()
+	o, err := Open(zerolog.Nop(), dir, WithSegmentSize(200))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(0), o.Subscribe("db"))
+	appendPositions(t, o, 1, 5)
+	assert.Equal(t, uint64(5), o.Subscribe("late"), "new subscriber starts at the head")
+
+	// acked out of order, 3 is not delivered.
+	for _, off := range []uint64{2, 1, 5, 4} {
+		o.Ack("db", off)
+	}
+	assert.Equal(t, uint64(1), o.Unacked("db"), "4 and 5 are acked ahead of the gap")
+	assert.Equal(t, []string{"3", "4", "5"}, replayed(t, o, "db"))
+	assert.Empty(t, replayed(t, o, "late"))
+	require.NoError(t, o.Close())
+
+	_, err = o.Append(common.Position{})
+	assert.ErrorIs(t, err, ErrClosed)
+
+	// positions acked ahead of the gap are replayed after restart, delivery is at least once.
+	o, err = Open(zerolog.Nop(), dir, WithSegmentSize(200))
+	require.NoError(t, err)
+	defer o.Close()
+	assert.Equal(t, uint64(2), o.Subscribe("db"))
+	assert.Equal(t, []string{"3", "4", "5"}, replayed(t, o, "db"))
+	appendPositions(t, o, 6, 6)
+	assert.Equal(t, []string{"3", "4", "5", "6"}, replayed(t, o, "db"))
+	assert.Equal(t, []string{"6"}, replayed(t, o, "late"))
+}
+
+func TestOutbox_TruncateDamagedTail(t *testing.T) {
+	dir := t.TempDir()
+	o, err := Open(zerolog.Nop(), dir)
+	require.NoError(t, err)
+	o.Subscribe("db")
+	appendPositions(t, o, 1, 2)
+	require.NoError(t, o.Close())
+
+	// crash in the middle of writing the record.
+	segs, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segs, 1)
+	f, err := os.OpenFile(segs[0].path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(encodeRecord(nil, 3, []byte(`{"DeviceID":"3"}`))[:headerSize+4])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	o, err = Open(zerolog.Nop(), dir)
+	require.NoError(t, err)
+	defer o.Close()
+	assert.Equal(t, uint64(2), o.Head())
+	appendPositions(t, o, 3, 3)
+	assert.Equal(t, []string{"1", "2", "3"}, replayed(t, o, "db"))
+}
+
+func TestOutbox_Compact(t *testing.T) {
+	o, err := Open(zerolog.Nop(), t.TempDir(), WithSegmentSize(100), WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	defer o.Close()
+	o.Subscribe("a")
+	o.Subscribe("b")
+	appendPositions(t, o, 1, 20)
+	segments := o.Stats().Segments
+	require.Greater(t, segments, 2)
+
+	for off := uint64(1); off <= 20; off++ {
+		o.Ack("a", off)
+	}
+	o.Compact()
+	assert.Equal(t, segments, o.Stats().Segments, "segments are kept until all subscribers ack them")
+
+	for off := uint64(1); off <= 20; off++ {
+		o.Ack("b", off)
+	}
+	o.Compact()
+	assert.Equal(t, 1, o.Stats().Segments, "active segment is kept")
+	assert.Empty(t, replayed(t, o, "b"))
+}
+
+func TestOutbox_Retain(t *testing.T) {
+	dir := t.TempDir()
+	o, err := Open(zerolog.Nop(), dir, WithSegmentSize(100), WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	o.Subscribe("a")
+	o.Subscribe("b")
+	appendPositions(t, o, 1, 20)
+	require.NoError(t, o.Close())
+
+	// subscriber b is removed from the configuration.
+	o, err = Open(zerolog.Nop(), dir, WithSegmentSize(100), WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	defer o.Close()
+	o.Subscribe("a")
+	assert.Equal(t, []string{"b"}, o.Retain("a"))
+	for off := uint64(1); off <= 20; off++ {
+		o.Ack("a", off)
+	}
+	o.Compact()
+	assert.Equal(t, 1, o.Stats().Segments, "removed cursor does not hold up compaction")
+	assert.Zero(t, o.Unacked("b"))
+}
+
+func TestOutbox_Sync(t *testing.T) {
+	o, err := Open(zerolog.Nop(), t.TempDir(), WithSegmentSize(100), WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			off, err := o.Append(common.Position{})
+			if assert.NoError(t, err) {
+				assert.NoError(t, o.Sync(off))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(20), o.synced, "segments rolled meanwhile are synced too")
+
+	require.NoError(t, o.Close())
+	assert.NoError(t, o.Sync(20))
+	assert.ErrorIs(t, o.Sync(21), ErrClosed)
+}
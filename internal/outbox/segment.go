@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentExt = ".seg"
+	// headerSize is the size of the record header: payload length, payload crc32 and offset.
+	headerSize = 4 + 4 + 8
+	// maxRecordSize limits the payload of the record read, larger length means damaged file.
+	maxRecordSize = 16 << 20
+)
+
+var errCorrupted = errors.New("corrupted record")
+
+// segment is the file of records, it is named after the offset of its first record.
+type segment struct {
+	path  string
+	first uint64
+	last  uint64
+	size  int64
+}
+
+func segmentPath(dir string, first uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+// listSegments returns segments of the directory ordered by the first offset.
+func listSegments(dir string) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read outbox dir: %w", err)
+	}
+	segs := make([]*segment, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, &segment{path: filepath.Join(dir, name), first: first})
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].first < segs[j].first })
+	return segs, nil
+}
+
+// encodeRecord appends the record to the buffer.
+func encodeRecord(b []byte, off uint64, payload []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(payload))
+	b = binary.LittleEndian.AppendUint64(b, off)
+	return append(b, payload...)
+}
+
+// readRecord reads the next record, io.EOF is returned at the end of the segment
+// and errCorrupted if the record is incomplete or damaged.
+func readRecord(r *bufio.Reader) (off uint64, payload []byte, err error) {
+	var h [headerSize]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, errCorrupted
+		}
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(h[0:4])
+	if n > maxRecordSize {
+		return 0, nil, errCorrupted
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, errCorrupted
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(h[4:8]) {
+		return 0, nil, errCorrupted
+	}
+	return binary.LittleEndian.Uint64(h[8:16]), payload, nil
+}
+
+// scan reads all records of the segment calling fn for every one.
+// It returns the size of valid records, the rest of the file is damaged by crash while writing.
+func (s *segment) scan(fn func(off uint64, payload []byte) error) (valid int64, err error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return 0, fmt.Errorf("open segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		off, payload, err := readRecord(r)
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, errCorrupted):
+			return valid, nil
+		case err != nil:
+			return valid, fmt.Errorf("read segment: %w", err)
+		}
+		if err = fn(off, payload); err != nil {
+			return valid, err
+		}
+		valid += int64(headerSize + len(payload))
+	}
+}
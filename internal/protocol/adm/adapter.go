@@ -0,0 +1,91 @@
+package adm
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	index          = "index"
+	status         = "status"
+	firmware       = "firmware"
+	acceleration   = "acceleration"
+	power          = "power"
+	battery        = "battery"
+	vibration      = "vibration"
+	vibrationCount = "vibration_count"
+	inputsAlarm    = "inputs_alarm"
+	counter        = "counter"
+	fuel           = "fuel"
+	temperature    = "temperature"
+	can            = "can"
+)
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the ADM data packet.
+type Adapter struct {
+	Packet *Packet
+	IMEI   string
+}
+
+// GenericPositions implements the common.Adapter interface.
+func (a Adapter) GenericPositions() []common.Position {
+	d := a.Packet.Data
+	if a.Packet.Type != DataPacket || d == nil {
+		return nil
+	}
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   a.IMEI,
+		DeviceTime: d.Time,
+		Speed:      null.NewFloat(d.Speed, true),
+		Course:     null.NewFloat(d.Course, true),
+	}
+	p.Location.X = d.Longitude
+	p.Location.Y = d.Latitude
+	p.Location.Z = float64(d.Altitude)
+	p.Location.Type = geom.DimXYZ
+	p.Location.Valid = d.Valid()
+
+	p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(d.Satellites), true))
+	p.Attributes = p.Attributes.AppendNullFloat(common.HDOP, null.NewFloat(d.HDOP, true))
+	p.Attributes = p.Attributes.AppendNullInt(index, null.NewInt(int64(d.Index), true))
+	p.Attributes = p.Attributes.AppendNullInt(status, null.NewInt(int64(d.Status), true))
+	p.Attributes = p.Attributes.AppendNullInt(firmware, null.NewInt(int64(d.Firmware), true))
+	p.Attributes = p.Attributes.AppendNullInt(acceleration, null.NewInt(int64(d.Acceleration), true))
+	p.Attributes = p.Attributes.AppendNullInt(power, null.NewInt(int64(d.Power), true))
+	p.Attributes = p.Attributes.AppendNullInt(battery, null.NewInt(int64(d.Battery), true))
+
+	if acc := d.Acc; acc != nil {
+		p.Attributes = p.Attributes.AppendNullInt(vibration, null.NewInt(int64(acc.Vibration), true))
+		p.Attributes = p.Attributes.AppendNullInt(vibrationCount, null.NewInt(int64(acc.VibrationCount), true))
+		p.Attributes = p.Attributes.AppendNullInt(common.DigOutput, null.NewInt(int64(acc.Outputs), true))
+		p.Attributes = p.Attributes.AppendNullInt(inputsAlarm, null.NewInt(int64(acc.InputsAlarm), true))
+	}
+	for i, v := range d.Analog {
+		p.Attributes = p.Attributes.AppendNullInt(fmt.Sprintf("%s_%d", common.AnInput, i+1), null.NewInt(int64(v), true))
+	}
+	for i, v := range d.Counters {
+		p.Attributes = p.Attributes.AppendNullInt(fmt.Sprintf("%s_%d", counter, i+1), null.NewInt(int64(v), true))
+	}
+	if f := d.Fuel; f != nil {
+		for i := range f.Levels {
+			p.Attributes = p.Attributes.AppendNullInt(fmt.Sprintf("%s_%d", fuel, i+1), null.NewInt(int64(f.Levels[i]), true))
+			p.Attributes = p.Attributes.AppendNullInt(
+				fmt.Sprintf("%s_%d", temperature, i+1), null.NewInt(int64(f.Temperatures[i]), true))
+		}
+	}
+	if d.CAN != nil {
+		p.Attributes = p.Attributes.AppendNullString(can, null.NewString(hex.EncodeToString(d.CAN), true))
+	}
+	if d.Odometer != nil {
+		p.Attributes = p.Attributes.AppendNullInt(common.Odometer, null.NewInt(int64(*d.Odometer), true))
+	}
+	return []common.Position{p}
+}
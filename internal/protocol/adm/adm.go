@@ -0,0 +1,74 @@
+package adm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "adm"
+)
+
+var (
+	_ tcp.Protocol     = (*ADM)(nil)
+	_ tcp.ReplyChecker = (*ADM)(nil)
+)
+
+// ErrNotLoggedIn is returned when data packet is received before IMEI packet.
+var ErrNotLoggedIn = errors.New("data before imei packet")
+
+// ADM is an ADM protocol struct.
+type ADM struct {
+}
+
+// NewADM creates a new ADM struct instance.
+func NewADM() *ADM {
+	return &ADM{}
+}
+
+// Name returns the name of the ADM protocol.
+func (a *ADM) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the ADM protocol.
+func (a *ADM) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// ExpectReply reports whether server replies to the frame.
+// ADM devices don't wait for acknowledgements, so none of frames are replied.
+func (a *ADM) ExpectReply([]byte) bool {
+	return false
+}
+
+// Respond returns the result of parsing the ADM data.
+func (a *ADM) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	switch pkg.Type {
+	case IMEIPacket:
+		if err != nil {
+			res.CloseSession = true
+			return res, fmt.Errorf("imei packet: %w", err)
+		}
+		s.SetDevice(pkg.IMEI)
+		return res, nil
+	case CommandResponsePacket:
+		return res, nil
+	case DataPacket:
+		if s.Device() == "" {
+			return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+		}
+		if err != nil {
+			return res, fmt.Errorf("decode data: %w", err)
+		}
+		res.GenericAdapter = Adapter{Packet: &pkg, IMEI: s.Device()}
+		return res, nil
+	}
+	return res, fmt.Errorf("%w: %w", common.ErrBadData, err)
+}
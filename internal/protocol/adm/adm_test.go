@@ -0,0 +1,153 @@
+package adm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Frames of device 258 with IMEI 868204005647838.
+// Data frames are made at 2023-04-01 10:00:00 at 55.752220 37.615560 150m, course 180, speed 36.5 km/h,
+// 9 satellites, hdop 0.9, power 12500 mV, battery 4100 mV and odometer 123456.
+const (
+	imeiFrame = "020115033836383230343030353634373833380500"
+	// analog inputs 4095, 0, 0, 0, 0, 1.
+	analogFrame = "020132881a0700000046025f425576164208076d010396000919a0002864d4300410ff0f0000000000000000010040e20100"
+	noFixFrame  = "020122001a080020000000000000000000000000000000000000dc002864d4300410"
+	// CAN block of length 4: 010203.
+	canFrame = "02012ac01a0700000046025f425576164208076d010396000919a0002864d43004100401020340e20100"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "imei", stream: imeiFrame, wantCount: 1},
+		{name: "stream", stream: imeiFrame + analogFrame + noFixFrame + canFrame, wantCount: 4},
+		{name: "truncated", stream: analogFrame[:40], wantErr: common.ErrBadData},
+		{name: "bad size", stream: "020102", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(mustHex(t, tt.stream)))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	odometer := uint32(123456)
+	tests := []struct {
+		name         string
+		frame        string
+		wantType     PacketType
+		wantValid    bool
+		wantAnalog   []uint16
+		wantCAN      []byte
+		wantOdometer *uint32
+		wantErr      error
+	}{
+		{name: "imei", frame: imeiFrame, wantType: IMEIPacket},
+		{
+			name:         "analog and odometer",
+			frame:        analogFrame,
+			wantType:     DataPacket,
+			wantValid:    true,
+			wantAnalog:   []uint16{4095, 0, 0, 0, 0, 1},
+			wantOdometer: &odometer,
+		},
+		{name: "no fix", frame: noFixFrame, wantType: DataPacket},
+		{
+			name:         "can and odometer",
+			frame:        canFrame,
+			wantType:     DataPacket,
+			wantValid:    true,
+			wantCAN:      []byte{1, 2, 3},
+			wantOdometer: &odometer,
+		},
+		{name: "truncated data", frame: "020108881a070000", wantType: DataPacket, wantErr: io.ErrUnexpectedEOF},
+		{
+			name:     "can overflow",
+			frame:    "02012ac01a0700000046025f425576164208076d010396000919a0002864d43004102001020340e20100",
+			wantType: DataPacket,
+			wantErr:  ErrMalformed,
+		},
+		{name: "unsupported", frame: "0201040a", wantType: UnknownPacket, wantErr: ErrUnsupportedPacket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.Decode(mustHex(t, tt.frame))
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantType, p.Type)
+			assert.Equal(t, uint16(258), p.DeviceID)
+			if tt.wantType != DataPacket || tt.wantErr != nil {
+				return
+			}
+			require.NotNil(t, p.Data)
+			assert.Equal(t, tt.wantValid, p.Data.Valid())
+			assert.Equal(t, tt.wantAnalog, p.Data.Analog)
+			assert.Equal(t, tt.wantCAN, p.Data.CAN)
+			assert.Equal(t, tt.wantOdometer, p.Data.Odometer)
+		})
+	}
+}
+
+func TestADM_Respond(t *testing.T) {
+	a := NewADM()
+	s := internal.NewSession()
+
+	res, err := a.Respond(s, mustHex(t, analogFrame))
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	assert.True(t, res.CloseSession)
+
+	res, err = a.Respond(s, mustHex(t, imeiFrame))
+	require.NoError(t, err)
+	assert.Nil(t, res.Response)
+	assert.Equal(t, "868204005647838", s.Device())
+
+	res, err = a.Respond(s, mustHex(t, analogFrame))
+	require.NoError(t, err)
+	assert.Nil(t, res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "868204005647838", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), pos[0].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 55.752220, pos[0].Y, 1e-5)
+	assert.InDelta(t, 37.615560, pos[0].X, 1e-5)
+	assert.InDelta(t, 150, pos[0].Z, 1e-9)
+	assert.InDelta(t, 36.5, pos[0].Speed.Float64, 1e-9)
+	assert.InDelta(t, 180, pos[0].Course.Float64, 1e-9)
+	assert.InDelta(t, 0.9, pos[0].Attributes[common.HDOP], 1e-9)
+	assert.Equal(t, int64(9), pos[0].Attributes[common.Satellites])
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+	assert.Equal(t, int64(4095), pos[0].Attributes[common.AnInput+"_1"])
+	assert.Equal(t, int64(123456), pos[0].Attributes[common.Odometer])
+}
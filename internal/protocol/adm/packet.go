@@ -0,0 +1,199 @@
+package adm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+)
+
+// PacketType is a type of ADM packet.
+type PacketType int
+
+const (
+	UnknownPacket PacketType = iota
+	IMEIPacket
+	DataPacket
+	CommandResponsePacket
+)
+
+const (
+	typeIMEI            = 0x03
+	typeKindMask        = 0x03
+	commandResponseSize = 0x84
+	imeiLen             = 15
+	odometerLen         = 4
+)
+
+// Optional blocks of data packet, presence of the block is signaled by the bit of packet type.
+const (
+	BlockAcc      = 0x04
+	BlockAnalog   = 0x08
+	BlockCounters = 0x10
+	BlockFuel     = 0x20
+	BlockCAN      = 0x40
+	BlockOdometer = 0x80
+)
+
+const (
+	analogInputs = 6
+	counters     = 2
+	fuelSensors  = 3
+	statusNoFix  = 0x20
+)
+
+var (
+	// ErrUnsupportedPacket is returned when packet type is not supported.
+	ErrUnsupportedPacket = errors.New("unsupported packet")
+	// ErrMalformed is returned when the block of the packet is inconsistent.
+	ErrMalformed = errors.New("malformed packet")
+)
+
+// Acc is an accelerometer and outputs block.
+type Acc struct {
+	Vibration      uint8
+	VibrationCount uint8
+	Outputs        uint8
+	InputsAlarm    uint8
+}
+
+// Fuel is a fuel level sensors block.
+type Fuel struct {
+	Levels       [fuelSensors]uint16
+	Temperatures [fuelSensors]int8
+}
+
+// Data is a data packet of navigation state and optional blocks.
+type Data struct {
+	Firmware uint8
+	Index    uint16
+	Status   uint16
+	// Latitude and Longitude are in degrees.
+	Latitude  float64
+	Longitude float64
+	// Course is in degrees.
+	Course float64
+	// Speed is in km/h.
+	Speed        float64
+	Acceleration uint8
+	Altitude     int16
+	HDOP         float64
+	Satellites   uint8
+	Time         time.Time
+	// Power and Battery are in mV.
+	Power   uint16
+	Battery uint16
+
+	Acc      *Acc
+	Analog   []uint16
+	Counters []uint32
+	Fuel     *Fuel
+	// CAN is a raw CAN block without its length.
+	CAN      []byte
+	Odometer *uint32
+}
+
+// Valid reports whether the coordinates are valid.
+func (d *Data) Valid() bool {
+	return d.Status&statusNoFix == 0
+}
+
+// Packet is an ADM packet: either IMEI identification, data or command response.
+type Packet struct {
+	Type     PacketType
+	DeviceID uint16
+	IMEI     string
+	Data     *Data
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+func (p *Packet) Decode(b []byte) error {
+	r := gen.NewReader(b, binary.LittleEndian)
+	p.DeviceID = r.Uint16()
+	size := r.Uint8()
+	if size == commandResponseSize {
+		p.Type = CommandResponsePacket
+		return nil
+	}
+	typ := r.Uint8()
+	if r.Err() != nil {
+		return fmt.Errorf("read header: %w", r.Err())
+	}
+
+	switch {
+	case typ == typeIMEI:
+		p.Type = IMEIPacket
+		imei := r.Bytes(imeiLen)
+		if r.Err() != nil {
+			return fmt.Errorf("read imei: %w", r.Err())
+		}
+		p.IMEI = string(imei)
+		return nil
+	case typ&typeKindMask == 0:
+		p.Type = DataPacket
+		return p.decodeData(r, typ)
+	}
+	p.Type = UnknownPacket
+	return fmt.Errorf("%w: %#02x", ErrUnsupportedPacket, typ)
+}
+
+func (p *Packet) decodeData(r *gen.Reader, typ uint8) error {
+	d := &Data{}
+	d.Firmware = r.Uint8()
+	d.Index = r.Uint16()
+	d.Status = r.Uint16()
+	d.Latitude = float64(math.Float32frombits(r.Uint32()))
+	d.Longitude = float64(math.Float32frombits(r.Uint32()))
+	d.Course = float64(r.Uint16()) / 10
+	d.Speed = float64(r.Uint16()) / 10
+	d.Acceleration = r.Uint8()
+	d.Altitude = int16(r.Uint16())
+	d.HDOP = float64(r.Uint8()) / 10
+	d.Satellites = r.Uint8() & 0x0F
+	d.Time = time.Unix(int64(r.Uint32()), 0).UTC()
+	d.Power = r.Uint16()
+	d.Battery = r.Uint16()
+
+	if typ&BlockAcc != 0 {
+		d.Acc = &Acc{Vibration: r.Uint8(), VibrationCount: r.Uint8(), Outputs: r.Uint8(), InputsAlarm: r.Uint8()}
+	}
+	if typ&BlockAnalog != 0 {
+		for i := 0; i < analogInputs; i++ {
+			d.Analog = append(d.Analog, r.Uint16())
+		}
+	}
+	if typ&BlockCounters != 0 {
+		for i := 0; i < counters; i++ {
+			d.Counters = append(d.Counters, r.Uint32())
+		}
+	}
+	if typ&BlockFuel != 0 {
+		d.Fuel = &Fuel{}
+		for i := range d.Fuel.Levels {
+			d.Fuel.Levels[i] = r.Uint16()
+		}
+		for i := range d.Fuel.Temperatures {
+			d.Fuel.Temperatures[i] = int8(r.Uint8())
+		}
+	}
+	if typ&BlockCAN != 0 {
+		// CAN block starts with its length including the length byte.
+		n := int(r.Uint8())
+		if r.Err() == nil && (n < 1 || n-1 > r.Len()) {
+			return fmt.Errorf("%w: CAN block length %d", ErrMalformed, n)
+		}
+		d.CAN = append([]byte(nil), r.Bytes(n-1)...)
+	}
+	if typ&BlockOdometer != 0 {
+		odometer := r.Uint32()
+		d.Odometer = &odometer
+	}
+	if r.Err() != nil {
+		return fmt.Errorf("read data: %w", r.Err())
+	}
+	p.Data = d
+	return nil
+}
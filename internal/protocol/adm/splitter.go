@@ -0,0 +1,75 @@
+package adm
+
+import (
+	"bufio"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	headerLen = 4
+	sizeIdx   = 2
+)
+
+// Splitter implements common.FrameSplitter contract to extract ADM packet from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for ADM protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract ADM packet from incoming bytes stream.
+// Packet starts with two bytes of device ID followed by one byte of the whole packet size.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if len(data) <= sizeIdx {
+			return s.more(data, atEOF)
+		}
+		pkgLen := int(data[sizeIdx])
+		if pkgLen < headerLen {
+			return s.bad(data)
+		}
+		if len(data) < pkgLen {
+			return s.more(data, atEOF)
+		}
+
+		// Finally got all data, return it.
+		return pkgLen, data[0:pkgLen], nil
+	}
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to ADM protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as ADM protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,87 @@
+package arnavi
+
+import (
+	"fmt"
+	"math"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Tags of data record used by adapter.
+const (
+	TagPower       = 0x01
+	TagLatitude    = 0x03
+	TagLongitude   = 0x04
+	TagCoordParams = 0x05
+)
+
+const (
+	power     = "power"
+	tagPrefix = "tag"
+	knot      = 1.852
+)
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Arnavi package.
+type Adapter struct {
+	Packet *Packet
+	IMEI   string
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Each data record of the package is converted into position.
+func (a Adapter) GenericPositions() []common.Position {
+	pos := make([]common.Position, 0, len(a.Packet.Records))
+	for _, rec := range a.Packet.Records {
+		if rec.Type != RecordData {
+			continue
+		}
+		pos = append(pos, a.convertRecordToGeneric(rec))
+	}
+	if len(pos) > 0 {
+		return pos
+	}
+	return nil
+}
+
+func (a Adapter) convertRecordToGeneric(rec Record) common.Position {
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   a.IMEI,
+		DeviceTime: rec.Time,
+	}
+	p.Location.Type = geom.DimXY
+	for _, t := range rec.Tags {
+		a.copyTag(&p, t)
+	}
+	// Coordinates tags are presented when device has the fix.
+	p.Location.Valid = p.Location.X != 0 || p.Location.Y != 0
+	return p
+}
+
+func (a Adapter) copyTag(p *common.Position, t Tag) {
+	v := t.Value
+	switch t.ID {
+	case TagLatitude:
+		p.Location.Y = float64(math.Float32frombits(v))
+	case TagLongitude:
+		p.Location.X = float64(math.Float32frombits(v))
+	case TagCoordParams:
+		// bytes from the lowest: course in 2 degrees, altitude in 10 meters,
+		// satellites GPS (low nibble) and GLONASS (high nibble) and speed in knots.
+		p.Course = null.NewFloat(float64(v&0xFF)*2, true)
+		p.Location.Type = geom.DimXYZ
+		p.Location.Z = float64(v>>8&0xFF) * 10
+		sats := v >> 16 & 0xFF
+		p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(sats&0x0F+sats>>4), true))
+		p.Speed = null.NewFloat(float64(v>>24)*knot, true)
+	case TagPower:
+		p.Attributes = p.Attributes.AppendNullInt(power, null.NewInt(int64(v), true))
+	default:
+		p.Attributes = p.Attributes.AppendNullInt(fmt.Sprintf("%s_%d", tagPrefix, t.ID), null.NewInt(int64(v), true))
+	}
+}
@@ -0,0 +1,77 @@
+package arnavi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "arnavi"
+)
+
+var (
+	_ tcp.Protocol         = (*Arnavi)(nil)
+	_ tcp.ResponseSplitter = (*Arnavi)(nil)
+)
+
+// ErrNotLoggedIn is returned when package is received before header.
+var ErrNotLoggedIn = errors.New("package before header")
+
+// Arnavi is an Arnavi binary protocol struct.
+type Arnavi struct {
+}
+
+// NewArnavi creates a new Arnavi struct instance.
+func NewArnavi() *Arnavi {
+	return &Arnavi{}
+}
+
+// Name returns the name of the Arnavi protocol.
+func (a *Arnavi) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Arnavi protocol.
+func (a *Arnavi) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// NewResponseSplitter returns a new instance of the split function for the Arnavi replies.
+// Replies are framed by braces instead of brackets, so they are read as is.
+func (a *Arnavi) NewResponseSplitter() common.FrameSplitter {
+	return gen.NewChunkSplitter()
+}
+
+// Respond returns the result of parsing the Arnavi data.
+// Package with wrong checksum is not acknowledged, so device will resend it.
+func (a *Arnavi) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	switch pkg.Type {
+	case HeaderPacket:
+		if err != nil {
+			res.CloseSession = true
+			return res, fmt.Errorf("header: %w", err)
+		}
+		s.SetDevice(pkg.IMEI)
+		res.Response = pkg.Response(time.Now())
+		return res, nil
+	case DataPacket:
+		if s.Device() == "" {
+			return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+		}
+		if err != nil {
+			return res, fmt.Errorf("decode package: %w", err)
+		}
+		res.Response = pkg.Response(time.Now())
+		res.GenericAdapter = Adapter{Packet: &pkg, IMEI: s.Device()}
+		return res, nil
+	}
+	return res, common.ErrBadData
+}
@@ -0,0 +1,128 @@
+package arnavi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Frames of device 868204005647838.
+// Package 1 has two data records made at 2023-04-01 10:00:00 and 10:02:00 at 55.752220 37.615560 150m,
+// course 180, 5 GPS and 4 GLONASS satellites, speed 20 knots, power 12500 mV, tag 6 = 3,
+// and a ping record between them.
+const (
+	headerV1Frame = "ff22de65597fa0150300"
+	headerV2Frame = "ff23de65597fa0150300"
+	packageFrame  = "5b01011900a00028640346025f420455761642055a0f451401d43000000603000000e8000000dc00286400011900180128640346025f420455761642055a0f451401d43000000603000000e85d"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "header", stream: headerV1Frame, wantCount: 1},
+		{name: "header and package", stream: headerV2Frame + packageFrame + packageFrame, wantCount: 3},
+		{name: "empty package", stream: "5b025d", wantCount: 1},
+		{name: "truncated", stream: packageFrame[:len(packageFrame)-2], wantErr: common.ErrBadData},
+		{name: "garbage", stream: "0102", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(mustHex(t, tt.stream)))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	badChecksum := []byte(packageFrame)
+	copy(badChecksum[len(badChecksum)-4:], "00")
+	tests := []struct {
+		name         string
+		frame        string
+		wantType     PacketType
+		wantRecords  int
+		wantResponse string
+		wantErr      error
+	}{
+		{name: "header v1", frame: headerV1Frame, wantType: HeaderPacket, wantResponse: "7b00007d"},
+		{name: "header v2", frame: headerV2Frame, wantType: HeaderPacket, wantResponse: "7b040068c01c28647d"},
+		{name: "unknown header", frame: "ff30de65597fa0150300", wantType: HeaderPacket, wantErr: ErrUnsupportedVersion},
+		{name: "package", frame: packageFrame, wantType: DataPacket, wantRecords: 3, wantResponse: "7b00017d"},
+		{name: "bad checksum", frame: string(badChecksum), wantType: DataPacket, wantRecords: 2, wantErr: ErrChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.Decode(mustHex(t, tt.frame))
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantType, p.Type)
+			assert.Len(t, p.Records, tt.wantRecords)
+			if tt.wantErr != nil {
+				return
+			}
+			if tt.wantType == HeaderPacket {
+				assert.Equal(t, "868204005647838", p.IMEI)
+			}
+			assert.Equal(t, mustHex(t, tt.wantResponse), p.Response(now))
+		})
+	}
+}
+
+func TestArnavi_Respond(t *testing.T) {
+	a := NewArnavi()
+	s := internal.NewSession()
+
+	res, err := a.Respond(s, mustHex(t, packageFrame))
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	assert.True(t, res.CloseSession)
+
+	res, err = a.Respond(s, mustHex(t, headerV1Frame))
+	require.NoError(t, err)
+	assert.Equal(t, "868204005647838", s.Device())
+	assert.Equal(t, mustHex(t, "7b00007d"), res.Response)
+
+	res, err = a.Respond(s, mustHex(t, packageFrame))
+	require.NoError(t, err)
+	assert.Equal(t, mustHex(t, "7b00017d"), res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 2)
+	assert.Equal(t, "868204005647838", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), pos[0].DeviceTime)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 2, 0, 0, time.UTC), pos[1].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 55.752220, pos[0].Y, 1e-5)
+	assert.InDelta(t, 37.615560, pos[0].X, 1e-5)
+	assert.InDelta(t, 150, pos[0].Z, 1e-9)
+	assert.InDelta(t, 180, pos[0].Course.Float64, 1e-9)
+	assert.InDelta(t, 37.04, pos[0].Speed.Float64, 1e-9)
+	assert.Equal(t, int64(9), pos[0].Attributes[common.Satellites])
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+	assert.Equal(t, int64(3), pos[0].Attributes["tag_6"])
+}
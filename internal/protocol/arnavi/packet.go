@@ -0,0 +1,169 @@
+package arnavi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+)
+
+// PacketType is a type of Arnavi packet.
+type PacketType int
+
+const (
+	UnknownPacket PacketType = iota
+	HeaderPacket
+	DataPacket
+)
+
+// Header versions.
+const (
+	HeaderV1 = 0x22
+	HeaderV2 = 0x23
+	HeaderV3 = 0x24
+)
+
+// Record types.
+const (
+	RecordPing   = 0x00
+	RecordData   = 0x01
+	RecordText   = 0x03
+	RecordFile   = 0x04
+	RecordBinary = 0x06
+)
+
+const (
+	responseStart = 0x7B
+	responseEnd   = 0x7D
+	tagLen        = 5
+)
+
+var (
+	// ErrChecksum is returned when record checksum mismatches.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrUnsupportedVersion is returned when header has unknown version.
+	ErrUnsupportedVersion = errors.New("unsupported header version")
+)
+
+// Tag is a single tag of data record: ID and four bytes value.
+type Tag struct {
+	ID    uint8
+	Value uint32
+}
+
+// Record is a single record of package.
+type Record struct {
+	Type uint8
+	Time time.Time
+	// Tags are presented for data records only.
+	Tags []Tag
+}
+
+// Packet is an Arnavi packet: either header with IMEI or package of records.
+type Packet struct {
+	Type    PacketType
+	Version uint8
+	IMEI    string
+	// Parcel is a package number, it is returned in acknowledgement.
+	Parcel  uint8
+	Records []Record
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+func (p *Packet) Decode(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("empty packet")
+	}
+	switch b[0] {
+	case headerStart:
+		p.Type = HeaderPacket
+		return p.decodeHeader(b)
+	case packageStart:
+		p.Type = DataPacket
+		return p.decodePackage(b)
+	}
+	p.Type = UnknownPacket
+	return fmt.Errorf("unknown packet: %x", b)
+}
+
+// Response returns the reply that shall be sent to the device.
+// Header of the first version and packages are acknowledged by the parcel number,
+// headers of later versions are acknowledged by the server time.
+func (p *Packet) Response(now time.Time) []byte {
+	switch {
+	case p.Type == HeaderPacket && p.Version != HeaderV1:
+		t := binary.LittleEndian.AppendUint32(nil, uint32(now.Unix()))
+		b := []byte{responseStart, 0x04, 0x00, sum(t)}
+		return append(append(b, t...), responseEnd)
+	case p.Type == HeaderPacket, p.Type == DataPacket:
+		return []byte{responseStart, 0x00, p.Parcel, responseEnd}
+	}
+	return nil
+}
+
+// sum is a checksum of record data.
+func sum(b []byte) (s byte) {
+	for _, c := range b {
+		s += c
+	}
+	return s
+}
+
+func (p *Packet) decodeHeader(b []byte) error {
+	r := gen.NewReader(b, binary.LittleEndian)
+	r.Skip(1)
+	p.Version = r.Uint8()
+	imei := r.Uint64()
+	if r.Err() != nil {
+		return fmt.Errorf("read header: %w", r.Err())
+	}
+	switch p.Version {
+	case HeaderV1, HeaderV2, HeaderV3:
+	default:
+		return fmt.Errorf("%w: %#02x", ErrUnsupportedVersion, p.Version)
+	}
+	p.IMEI = strconv.FormatUint(imei, 10)
+	return nil
+}
+
+func (p *Packet) decodePackage(b []byte) error {
+	r := gen.NewReader(b, binary.LittleEndian)
+	r.Skip(1)
+	p.Parcel = r.Uint8()
+	for r.Err() == nil {
+		typ := r.Uint8()
+		if typ == packageEnd {
+			break
+		}
+		n := int(r.Uint16())
+		rec := Record{Type: typ, Time: time.Unix(int64(r.Uint32()), 0).UTC()}
+		data := r.Bytes(n)
+		cs := r.Uint8()
+		if r.Err() != nil {
+			break
+		}
+		if got := sum(data); got != cs {
+			return fmt.Errorf("%w: record #%d got %02x, want %02x", ErrChecksum, len(p.Records), got, cs)
+		}
+		if typ == RecordData {
+			rec.Tags = decodeTags(data)
+		}
+		p.Records = append(p.Records, rec)
+	}
+	if r.Err() != nil {
+		return fmt.Errorf("read package: %w", r.Err())
+	}
+	return nil
+}
+
+func decodeTags(b []byte) []Tag {
+	tags := make([]Tag, 0, len(b)/tagLen)
+	r := gen.NewReader(b, binary.LittleEndian)
+	for r.Len() >= tagLen {
+		tags = append(tags, Tag{ID: r.Uint8(), Value: r.Uint32()})
+	}
+	return tags
+}
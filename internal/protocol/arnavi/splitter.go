@@ -0,0 +1,104 @@
+package arnavi
+
+import (
+	"bufio"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	headerStart     = 0xFF
+	headerLen       = 10
+	packageStart    = 0x5B
+	packageEnd      = 0x5D
+	packageHeadLen  = 2
+	recordHeaderLen = 7 // type, length and time.
+	recordCSLen     = 1
+	maxPackageLen   = bufio.MaxScanTokenSize
+)
+
+// Splitter implements common.FrameSplitter contract to extract Arnavi header and packages from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for Arnavi protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Arnavi packet from incoming bytes stream.
+// Header starts with 0xFF and has fixed size. Package starts with [ and parcel number followed by records,
+// each of them has type, two bytes of data length, time, data and checksum, package ends with ].
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		switch data[0] {
+		case headerStart:
+			if len(data) < headerLen {
+				return s.more(data, atEOF)
+			}
+			return headerLen, data[0:headerLen], nil
+		case packageStart:
+			return s.pkg(data, atEOF)
+		default:
+			return s.bad(data)
+		}
+	}
+}
+
+func (s *Splitter) pkg(data []byte, atEOF bool) (int, []byte, error) {
+	off := packageHeadLen
+	for {
+		if off >= maxPackageLen {
+			return s.bad(data)
+		}
+		if len(data) <= off {
+			return s.more(data, atEOF)
+		}
+		if data[off] == packageEnd {
+			break
+		}
+		if len(data) < off+recordHeaderLen {
+			return s.more(data, atEOF)
+		}
+		off += recordHeaderLen + int(binary.LittleEndian.Uint16(data[off+1:off+3])) + recordCSLen
+	}
+
+	// Finally got all data, return it.
+	pkgLen := off + 1
+	return pkgLen, data[0:pkgLen], nil
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Arnavi protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Arnavi protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,129 @@
+package galileosky
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	index       = "index"
+	status      = "status"
+	power       = "power"
+	battery     = "battery"
+	temperature = "temperature"
+	ibutton     = "ibutton"
+	alarm       = "alarm"
+	archive     = "archive"
+	tagPrefix   = "tag"
+)
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Galileosky packet.
+type Adapter struct {
+	Packet *Packet
+	IMEI   string
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Each record of the packet is converted into position, records without time are skipped.
+func (a Adapter) GenericPositions() []common.Position {
+	pos := make([]common.Position, 0, len(a.Packet.Records))
+	for _, rec := range a.Packet.Records {
+		p := a.convertRecordToGeneric(rec)
+		if p.DeviceTime.IsZero() {
+			continue
+		}
+		pos = append(pos, p)
+	}
+	if len(pos) > 0 {
+		return pos
+	}
+	return nil
+}
+
+func (a Adapter) convertRecordToGeneric(rec Record) common.Position {
+	p := common.Position{
+		Protocol: Proto,
+		DeviceID: a.IMEI,
+	}
+	p.Location.Type = geom.DimXY
+	if m := rec.Minimal; m != nil {
+		p.DeviceTime = m.Time
+		p.Location.X = m.Longitude
+		p.Location.Y = m.Latitude
+		p.Location.Valid = m.Valid
+		p.Attributes = p.Attributes.AppendNullInt(alarm, null.NewInt(1, m.Alarm))
+	}
+	p.Attributes = p.Attributes.AppendNullInt(archive, null.NewInt(1, a.Packet.Archive))
+
+	for _, t := range rec.Tags {
+		a.copyTag(&p, t)
+	}
+	return p
+}
+
+func (a Adapter) copyTag(p *common.Position, t Tag) {
+	v := t.Value
+	switch {
+	case t.ID == TagIMEI:
+		p.DeviceID = string(v)
+	case t.ID == TagTime:
+		p.DeviceTime = time.Unix(int64(binary.LittleEndian.Uint32(v)), 0).UTC()
+	case t.ID == TagCoordinates:
+		// low nibble is satellites, high nibble is correctness: 0 - valid, 2 - by cell towers.
+		p.Location.Valid = v[0]>>4 == 0
+		p.Location.Y = float64(int32(binary.LittleEndian.Uint32(v[1:5]))) / 1000000
+		p.Location.X = float64(int32(binary.LittleEndian.Uint32(v[5:9]))) / 1000000
+		p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(v[0]&0x0F), true))
+	case t.ID == TagSpeed:
+		p.Speed = null.NewFloat(float64(binary.LittleEndian.Uint16(v[0:2]))/10, true)
+		p.Course = null.NewFloat(float64(binary.LittleEndian.Uint16(v[2:4]))/10, true)
+	case t.ID == TagAltitude:
+		p.Location.Type = geom.DimXYZ
+		p.Location.Z = float64(int16(binary.LittleEndian.Uint16(v)))
+	case t.ID == TagHDOP:
+		p.Attributes = p.Attributes.AppendNullFloat(common.HDOP, null.NewFloat(float64(v[0])/10, true))
+	case t.ID == TagRecordNumber:
+		p.Attributes = p.Attributes.AppendNullInt(index, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID == TagStatus:
+		p.Attributes = p.Attributes.AppendNullInt(status, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID == TagPower:
+		p.Attributes = p.Attributes.AppendNullInt(power, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID == TagBattery:
+		p.Attributes = p.Attributes.AppendNullInt(battery, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID == TagTemperature:
+		p.Attributes = p.Attributes.AppendNullInt(temperature, null.NewInt(int64(int8(v[0])), true))
+	case t.ID == TagOutputs:
+		p.Attributes = p.Attributes.AppendNullInt(common.DigOutput, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID == TagInputs:
+		p.Attributes = p.Attributes.AppendNullInt(common.DigInput, null.NewInt(int64(binary.LittleEndian.Uint16(v)), true))
+	case t.ID >= TagAnalogInput0 && t.ID <= TagAnalogInput7:
+		p.Attributes = p.Attributes.AppendNullInt(
+			fmt.Sprintf("%s_%d", common.AnInput, t.ID-TagAnalogInput0),
+			null.NewInt(int64(binary.LittleEndian.Uint16(v)), true),
+		)
+	case t.ID == TagIButton:
+		p.Attributes = p.Attributes.AppendNullString(ibutton, null.NewString(fmt.Sprintf("%08X", binary.LittleEndian.Uint32(v)), true))
+	case t.ID == TagOdometer:
+		p.Attributes = p.Attributes.AppendNullInt(common.Odometer, null.NewInt(int64(binary.LittleEndian.Uint32(v)), true))
+	case t.ID == TagHardware, t.ID == TagFirmware, t.ID == TagDeviceID:
+	default:
+		name := fmt.Sprintf("%s_%02x", tagPrefix, t.ID)
+		switch len(v) {
+		case 1, 2, 3, 4: //nolint:gomnd
+			var buf [8]byte
+			copy(buf[:], v)
+			p.Attributes = p.Attributes.AppendNullInt(name, null.NewInt(int64(binary.LittleEndian.Uint64(buf[:])), true))
+		default:
+			p.Attributes = p.Attributes.AppendNullString(name, null.NewString(hex.EncodeToString(v), true))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package galileosky
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "galileosky"
+)
+
+var (
+	_ tcp.Protocol         = (*Galileosky)(nil)
+	_ tcp.ResponseSplitter = (*Galileosky)(nil)
+)
+
+// ErrNotIdentified is returned when packet without IMEI is received before the device was identified.
+var ErrNotIdentified = errors.New("device is not identified")
+
+// Galileosky is a Galileosky protocol struct.
+type Galileosky struct {
+}
+
+// NewGalileosky creates a new Galileosky struct instance.
+func NewGalileosky() *Galileosky {
+	return &Galileosky{}
+}
+
+// Name returns the name of the Galileosky protocol.
+func (g *Galileosky) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Galileosky protocol.
+func (g *Galileosky) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// NewResponseSplitter returns a new instance of the split function for the Galileosky replies.
+// Replies are header and checksum without length, so they are read as is.
+func (g *Galileosky) NewResponseSplitter() common.FrameSplitter {
+	return gen.NewChunkSplitter()
+}
+
+// Respond returns the result of parsing the Galileosky data.
+// Packet with wrong CRC is not acknowledged, so device will resend it.
+func (g *Galileosky) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	if errors.Is(err, ErrCRC) {
+		return res, err
+	}
+
+	for _, rec := range pkg.Records {
+		if imei, ok := rec.Tag(TagIMEI); ok {
+			s.SetDevice(string(imei))
+			break
+		}
+	}
+	if s.Device() == "" {
+		return tcp.Result{CloseSession: true}, ErrNotIdentified
+	}
+
+	// Device would resend the packet with unknown tags endlessly, so it is acknowledged anyway
+	// and records decoded before the failure are kept.
+	res.Response = pkg.Response()
+	if len(pkg.Records) > 0 {
+		res.GenericAdapter = Adapter{Packet: &pkg, IMEI: s.Device()}
+	}
+	if err != nil {
+		return res, fmt.Errorf("decode packet: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,205 @@
+package galileosky
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	identTags = "0182" + "0210" + "03383638323034303035363437383338" + "043200"
+	// record: number 1, time 2023-04-01 10:00:00, valid coordinates with 9 satellites 55.752220 37.615560,
+	// speed 36.5 km/h, course 180.0, altitude 150, hdop 0.9, power 12500 mV, analog input 2 = 4095,
+	// fuel level sensor = 100.
+	recordTags = "100100" + "20a0002864" + "30091cb65203c8f73d02" + "336d010807" + "349600" + "3509" +
+		"41d430" + "52ff0f" + "64640000"
+)
+
+// frame wraps tags into packet with given header and valid CRC.
+func frame(t *testing.T, header uint8, archive bool, tags string) []byte {
+	t.Helper()
+	body, err := hex.DecodeString(tags)
+	require.NoError(t, err)
+	l := uint16(len(body))
+	if archive {
+		l |= ^uint16(lengthMask)
+	}
+	b := binary.LittleEndian.AppendUint16([]byte{header}, l)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint16(b, CRC16(b))
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    []byte
+		wantCount int
+		wantErr   error
+	}{
+		{name: "identification", stream: frame(t, mainHeader, true, identTags), wantCount: 1},
+		{
+			name:      "identification and data",
+			stream:    append(frame(t, mainHeader, true, identTags), frame(t, mainHeader, false, identTags+recordTags)...),
+			wantCount: 2,
+		},
+		{name: "truncated", stream: frame(t, mainHeader, false, recordTags)[:10], wantErr: common.ErrBadData},
+		{name: "bad header", stream: []byte{0x05, 0x01, 0x00, 0x00}, wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(tt.stream))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		frame       []byte
+		wantArchive bool
+		wantRecords int
+		wantErr     error
+	}{
+		{name: "identification", frame: frame(t, mainHeader, true, identTags), wantArchive: true, wantRecords: 1},
+		{name: "two records", frame: frame(t, mainHeader, false, identTags+recordTags+recordTags), wantRecords: 2},
+		{
+			// extended status, channel, refrigerator data, command index and reply of current firmware.
+			name:        "firmware tags",
+			frame:       frame(t, mainHeader, false, identTags+"480100"+"4901"+"5b0300aabbcc"+"e001000000"+"e1024f4b"+"41d430"),
+			wantRecords: 1,
+		},
+		{name: "unknown tag", frame: frame(t, mainHeader, false, identTags+"0b0000"), wantRecords: 1, wantErr: ErrUnknownTag},
+		{name: "compressed", frame: frame(t, compressedHeader, false, "0000000000000000000002"+"3541"+"09"+"d430"), wantRecords: 1},
+		{name: "bad crc", frame: append(frame(t, mainHeader, false, identTags)[:26], 0, 0), wantErr: ErrCRC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.decodeAt(tt.frame, now)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == ErrCRC {
+				return
+			}
+			assert.Equal(t, tt.wantArchive, p.Archive)
+			assert.Len(t, p.Records, tt.wantRecords)
+			assert.Equal(t, append([]byte{responseHeader}, tt.frame[len(tt.frame)-crcLen:]...), p.Response())
+		})
+	}
+}
+
+func TestDecodeMinimalData(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	// 0 | seconds 7776000 (91 days) | valid | lon 37.615560 | lat 55.752220 | alarm
+	lon, lat := 37.615560, 55.752220
+	bits := &bitWriter{buf: make([]byte, minimalDataLen)}
+	bits.write(1, 0)
+	bits.write(25, 7776000)
+	bits.write(1, 1)
+	bits.write(22, uint64((lon+180)/360*(1<<22)))
+	bits.write(21, uint64((lat+90)/180*(1<<21)))
+	bits.write(1, 1)
+	m := decodeMinimalData(bits.buf, now)
+	assert.Equal(t, time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), m.Time)
+	assert.True(t, m.Valid)
+	assert.True(t, m.Alarm)
+	assert.InDelta(t, 37.615560, m.Longitude, 1e-4)
+	assert.InDelta(t, 55.752220, m.Latitude, 1e-4)
+
+	// record of the last year sent from archive.
+	m = decodeMinimalData(bits.buf, time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), m.Time)
+}
+
+func TestGalileosky_Respond(t *testing.T) {
+	g := NewGalileosky()
+	s := internal.NewSession()
+
+	res, err := g.Respond(s, frame(t, mainHeader, false, recordTags))
+	assert.ErrorIs(t, err, ErrNotIdentified)
+	assert.True(t, res.CloseSession)
+
+	f := frame(t, mainHeader, false, identTags+recordTags)
+	res, err = g.Respond(s, f)
+	require.NoError(t, err)
+	assert.Equal(t, "868204005647838", s.Device())
+	assert.Equal(t, append([]byte{responseHeader}, f[len(f)-crcLen:]...), res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "868204005647838", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), pos[0].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 55.752220, pos[0].Y, 1e-9)
+	assert.InDelta(t, 37.615560, pos[0].X, 1e-9)
+	assert.InDelta(t, 150, pos[0].Z, 1e-9)
+	assert.InDelta(t, 36.5, pos[0].Speed.Float64, 1e-9)
+	assert.InDelta(t, 180.0, pos[0].Course.Float64, 1e-9)
+	assert.Equal(t, int64(9), pos[0].Attributes[common.Satellites])
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+	assert.Equal(t, int64(4095), pos[0].Attributes[common.AnInput+"_2"])
+	assert.Equal(t, int64(100), pos[0].Attributes["tag_64"])
+}
+
+func TestGalileosky_RespondUnknownTag(t *testing.T) {
+	g := NewGalileosky()
+	s := internal.NewSession()
+
+	// known record is followed by the record with unknown tag.
+	f := frame(t, mainHeader, false, identTags+recordTags+"100200"+"0b0000")
+	res, err := g.Respond(s, f)
+	assert.ErrorIs(t, err, ErrUnknownTag)
+	assert.False(t, res.CloseSession)
+	assert.Equal(t, append([]byte{responseHeader}, f[len(f)-crcLen:]...), res.Response)
+	require.NotNil(t, res.GenericAdapter, "records decoded before unknown tag shall be kept")
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "868204005647838", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), pos[0].DeviceTime)
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+}
+
+func TestAdapter_CANBlock(t *testing.T) {
+	// 68 bytes of the 0x5C block followed by power and analog input 2 tags.
+	can := strings.Repeat("ab", 68)
+	f := frame(t, mainHeader, false, identTags+"20a0002864"+"5c"+can+"41d430"+"52ff0f")
+	p := Packet{}
+	require.NoError(t, p.decodeAt(f, time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)))
+	pos := Adapter{Packet: &p}.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "868204005647838", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), pos[0].DeviceTime)
+	assert.Equal(t, can, pos[0].Attributes["tag_5c"])
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+	assert.Equal(t, int64(4095), pos[0].Attributes[common.AnInput+"_2"])
+}
+
+// bitWriter is a helper to build minimal data set bits.
+type bitWriter struct {
+	buf []byte
+	pos int
+}
+
+func (b *bitWriter) write(n int, v uint64) {
+	for i := n - 1; i >= 0; i-- {
+		b.buf[b.pos/8] |= byte(v>>i&1) << (7 - b.pos%8)
+		b.pos++
+	}
+}
@@ -0,0 +1,214 @@
+package galileosky
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/sigurn/crc16"
+)
+
+const minimalDataLen = 10
+
+var (
+	// ErrCRC is returned when packet checksum mismatches.
+	ErrCRC = errors.New("crc mismatch")
+	// ErrUnknownTag is returned when record contains tag out of the tag table.
+	ErrUnknownTag = errors.New("unknown tag")
+)
+
+var crcTable = crc16.MakeTable(crc16.CRC16_MODBUS)
+
+// CRC16 calculates the CRC-16/MODBUS checksum of the data.
+func CRC16(data []byte) uint16 {
+	return crc16.Checksum(data, crcTable)
+}
+
+// Tag is a single tag of record.
+type Tag struct {
+	ID    uint8
+	Value []byte
+}
+
+// MinimalData is a minimal data set that opens each record of compressed packet.
+type MinimalData struct {
+	Time      time.Time
+	Valid     bool
+	Longitude float64
+	Latitude  float64
+	Alarm     bool
+}
+
+// Record is a set of tags describing device state at some moment.
+type Record struct {
+	Tags []Tag
+	// Minimal is presented for records of compressed packet only.
+	Minimal *MinimalData
+}
+
+// Tag returns value of the tag with given ID.
+func (r Record) Tag(id uint8) ([]byte, bool) {
+	for _, t := range r.Tags {
+		if t.ID == id {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Packet is a decoded Galileosky packet.
+type Packet struct {
+	Header uint8
+	// Archive signals that device has more unsent records in archive.
+	Archive bool
+	Records []Record
+	CRC     uint16
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+// Decoded tag values don't share memory with the frame.
+func (p *Packet) Decode(b []byte) error {
+	return p.decodeAt(b, time.Now())
+}
+
+// decodeAt decodes bytes frame, now is used to restore the year of compressed records.
+func (p *Packet) decodeAt(b []byte, now time.Time) error {
+	r := gen.NewReader(b, binary.LittleEndian)
+	p.Header = r.Uint8()
+	length := r.Uint16()
+	p.Archive = length&^lengthMask != 0
+	body := r.Bytes(int(length & lengthMask))
+	p.CRC = r.Uint16()
+	if r.Err() != nil {
+		return fmt.Errorf("read packet: %w", r.Err())
+	}
+	if got := CRC16(b[:len(b)-crcLen]); got != p.CRC {
+		return fmt.Errorf("%w: got %04x, want %04x", ErrCRC, got, p.CRC)
+	}
+
+	body = append([]byte(nil), body...)
+	if p.Header == compressedHeader {
+		return p.decodeCompressed(gen.NewReader(body, binary.LittleEndian), now)
+	}
+	return p.decodeMain(gen.NewReader(body, binary.LittleEndian))
+}
+
+// Response returns the reply that shall be sent to the device: 0x02 and the checksum of received packet.
+func (p *Packet) Response() []byte {
+	return binary.LittleEndian.AppendUint16([]byte{responseHeader}, p.CRC)
+}
+
+// decodeMain splits tags into records, a repeated tag opens a new record.
+func (p *Packet) decodeMain(r *gen.Reader) error {
+	var rec Record
+	seen := make(map[uint8]struct{})
+	for r.Len() > 0 {
+		t, err := readTag(r)
+		if err != nil {
+			if len(rec.Tags) > 0 {
+				p.Records = append(p.Records, rec)
+			}
+			return err
+		}
+		if _, ok := seen[t.ID]; ok {
+			p.Records = append(p.Records, rec)
+			rec = Record{}
+			seen = make(map[uint8]struct{})
+		}
+		seen[t.ID] = struct{}{}
+		rec.Tags = append(rec.Tags, t)
+	}
+	if len(rec.Tags) > 0 {
+		p.Records = append(p.Records, rec)
+	}
+	return nil
+}
+
+// decodeCompressed decodes records each of them is minimal data set,
+// number of tags, list of tag IDs and tag values in the same order.
+func (p *Packet) decodeCompressed(r *gen.Reader, now time.Time) error {
+	for r.Len() > 0 {
+		md := decodeMinimalData(r.Bytes(minimalDataLen), now)
+		ids := r.Bytes(int(r.Uint8()))
+		if r.Err() != nil {
+			return fmt.Errorf("read compressed record: %w", r.Err())
+		}
+		rec := Record{Minimal: &md, Tags: make([]Tag, 0, len(ids))}
+		for _, id := range ids {
+			v, err := readValue(r, id)
+			if err != nil {
+				return err
+			}
+			rec.Tags = append(rec.Tags, Tag{ID: id, Value: v})
+		}
+		p.Records = append(p.Records, rec)
+	}
+	return nil
+}
+
+func readTag(r *gen.Reader) (Tag, error) {
+	id := r.Uint8()
+	v, err := readValue(r, id)
+	return Tag{ID: id, Value: v}, err
+}
+
+func readValue(r *gen.Reader, id uint8) ([]byte, error) {
+	size, ok := tagSizes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %#02x at %d", ErrUnknownTag, id, r.Offset()-1)
+	}
+	switch size {
+	case varLen1:
+		size = int(r.Uint8())
+	case varLen2:
+		size = int(r.Uint16())
+	}
+	v := r.Bytes(size)
+	if r.Err() != nil {
+		return nil, fmt.Errorf("read tag %#02x: %w", id, r.Err())
+	}
+	return v, nil
+}
+
+// decodeMinimalData decodes 80 bits of minimal data set:
+// reserved bit, 25 bits of seconds since the beginning of the year, validity bit,
+// 22 bits of longitude, 21 bits of latitude and alarm bit.
+func decodeMinimalData(b []byte, now time.Time) (m MinimalData) {
+	if len(b) != minimalDataLen {
+		return m
+	}
+	bits := &bitReader{buf: b}
+	bits.read(1)
+	secs := bits.read(25)
+	m.Valid = bits.read(1) == 1
+	m.Longitude = 360*float64(bits.read(22))/(1<<22) - 180
+	m.Latitude = 180*float64(bits.read(21))/(1<<21) - 90
+	m.Alarm = bits.read(1) == 1
+
+	now = now.UTC()
+	year := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	m.Time = year.Add(time.Duration(secs) * time.Second)
+	if m.Time.After(now.Add(24 * time.Hour)) {
+		// record was made last year and is sent from archive.
+		m.Time = year.AddDate(-1, 0, 0).Add(time.Duration(secs) * time.Second)
+	}
+	return m
+}
+
+// bitReader reads big endian bit fields.
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (b *bitReader) read(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		byteIdx, bitIdx := b.pos/8, 7-b.pos%8
+		v = v<<1 | uint64(b.buf[byteIdx]>>bitIdx&1)
+		b.pos++
+	}
+	return v
+}
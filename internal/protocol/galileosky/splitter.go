@@ -0,0 +1,82 @@
+package galileosky
+
+import (
+	"bufio"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	mainHeader       = 0x01
+	compressedHeader = 0x08
+	responseHeader   = 0x02
+	headerLen        = 3
+	crcLen           = 2
+	lengthMask       = 0x7FFF
+)
+
+// Splitter implements common.FrameSplitter contract to extract Galileosky packet from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for Galileosky protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Galileosky packet from incoming bytes stream.
+// Packet starts with header byte (0x01 main, 0x08 compressed) followed by two bytes length
+// where the highest bit is archive flag, and ends with two bytes of CRC.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if data[0] != mainHeader && data[0] != compressedHeader {
+			return s.bad(data)
+		}
+		if len(data) < headerLen {
+			return s.more(data, atEOF)
+		}
+
+		pkgLen := headerLen + int(binary.LittleEndian.Uint16(data[1:3])&lengthMask) + crcLen
+		if len(data) < pkgLen {
+			return s.more(data, atEOF)
+		}
+
+		// Finally got all data, return it.
+		return pkgLen, data[0:pkgLen], nil
+	}
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Galileosky protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Galileosky protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,83 @@
+package galileosky
+
+// Well known tags.
+const (
+	TagHardware     = 0x01
+	TagFirmware     = 0x02
+	TagIMEI         = 0x03
+	TagDeviceID     = 0x04
+	TagRecordNumber = 0x10
+	TagTime         = 0x20
+	TagCoordinates  = 0x30
+	TagSpeed        = 0x33
+	TagAltitude     = 0x34
+	TagHDOP         = 0x35
+	TagStatus       = 0x40
+	TagPower        = 0x41
+	TagBattery      = 0x42
+	TagTemperature  = 0x43
+	TagOutputs      = 0x45
+	TagInputs       = 0x46
+	TagExtStatus    = 0x48
+	TagChannel      = 0x49
+	TagAnalogInput0 = 0x50
+	TagAnalogInput7 = 0x57
+	TagRefrigerator = 0x5B
+	TagIButton      = 0x90
+	TagOdometer     = 0xD4
+	TagCommandIndex = 0xE0
+	TagCommandReply = 0xE1
+	TagUserArray    = 0xEA
+	TagExtended     = 0xFE
+)
+
+const (
+	// varLen1 marks tags which value is prefixed with one byte length, e.g. user array and command reply.
+	varLen1 = -1
+	// varLen2 marks tags which value is prefixed with two bytes length, e.g. refrigerator data and extended tags.
+	varLen2 = -2
+)
+
+// tagSizes is a tag table of value sizes in bytes.
+// Galileosky records have no tag delimiters, so a tag out of the table makes the rest of the packet undecodable.
+var tagSizes = func() map[uint8]int {
+	m := map[uint8]int{
+		TagIMEI:         15,
+		TagCoordinates:  9,
+		0x5C:            68,
+		TagRefrigerator: varLen2,
+		TagCommandReply: varLen1,
+		TagUserArray:    varLen1,
+		TagExtended:     varLen2,
+	}
+	set := func(size int, tags ...uint8) {
+		for _, t := range tags {
+			m[t] = size
+		}
+	}
+	span := func(from, to uint8) []uint8 {
+		tags := make([]uint8, 0, to-from+1)
+		for t := from; t <= to; t++ {
+			tags = append(tags, t)
+		}
+		return tags
+	}
+	set(1, TagHardware, TagFirmware, TagHDOP, TagTemperature, TagChannel, 0x88, 0x8A, 0x8B, 0x8C, 0xD5)
+	set(1, span(0xA0, 0xAF)...)
+	set(1, span(0xC4, 0xD2)...)
+	set(2, TagDeviceID, TagRecordNumber, TagAltitude, TagStatus, TagPower, TagBattery, TagOutputs, TagInputs, TagExtStatus)
+	set(2, span(TagAnalogInput0, 0x59)...)
+	set(2, span(0x60, 0x62)...)
+	set(2, span(0x70, 0x79)...)
+	set(2, span(0xB0, 0xB9)...)
+	set(2, span(0xD6, 0xDA)...)
+	set(3, span(0x63, 0x6F)...)
+	set(3, span(0x80, 0x87)...)
+	set(3, 0x5D, 0xFA)
+	set(4, TagTime, TagSpeed, 0x44, 0x47, 0x5A, TagIButton, TagOdometer, 0xD3, TagCommandIndex)
+	set(4, span(0xC0, 0xC3)...)
+	set(4, span(0xDB, 0xDF)...)
+	set(4, span(0xE2, 0xE9)...)
+	set(4, span(0xF0, 0xF9)...)
+	return m
+}()
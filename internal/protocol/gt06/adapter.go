@@ -0,0 +1,114 @@
+package gt06
+
+import (
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	alarm       = "alarm"
+	status      = "status"
+	armed       = "armed"
+	ignition    = "ignition"
+	charging    = "charging"
+	gpsTracking = "gps_tracking"
+	oilCut      = "oil_cut"
+	powerLevel  = "power_level"
+	rssi        = "rssi"
+	realtime    = "realtime"
+)
+
+// alarms maps alarm byte of alarm packets to alarm names.
+var alarms = map[uint8]string{
+	0x01: "sos",
+	0x02: "power_cut",
+	0x03: "vibration",
+	0x04: "geofence_enter",
+	0x05: "geofence_exit",
+	0x06: "overspeed",
+	0x09: "movement",
+	0x0E: "low_battery",
+	0x13: "tampering",
+}
+
+// terminalAlarms maps alarm bits 3-5 of terminal information to alarm names.
+var terminalAlarms = map[uint8]string{
+	0b001: "vibration",
+	0b010: "power_cut",
+	0b011: "low_battery",
+	0b100: "sos",
+}
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the GT06 packet.
+type Adapter struct {
+	Packet *Packet
+	IMEI   string
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Position is produced for packets carrying GPS or LBS information only.
+func (a Adapter) GenericPositions() []common.Position {
+	if a.Packet.Location == nil && a.Packet.Cell == nil {
+		return nil
+	}
+
+	p := common.Position{
+		Protocol: Proto,
+		DeviceID: a.IMEI,
+		Cellular: a.Packet.Cell,
+	}
+	if l := a.Packet.Location; l != nil {
+		a.copyLocation(&p, l)
+	}
+	if a.Packet.Status != nil {
+		a.copyStatus(&p, a.Packet.Status)
+	}
+	if a.Packet.ACC != nil {
+		p.Attributes = p.Attributes.AppendNullInt(ignition, null.NewInt(int64(*a.Packet.ACC), true))
+	}
+	if a.Packet.Mileage != nil {
+		p.Attributes = p.Attributes.AppendNullInt(common.Odometer, null.NewInt(int64(*a.Packet.Mileage), true))
+	}
+	return []common.Position{p}
+}
+
+func (a Adapter) copyLocation(p *common.Position, l *Location) {
+	p.DeviceTime = l.Time
+	p.Location.X = l.Longitude
+	p.Location.Y = l.Latitude
+	p.Location.Type = geom.DimXY
+	p.Location.Valid = l.Valid
+	p.Speed = null.NewFloat(float64(l.Speed), true)
+	p.Course = null.NewFloat(float64(l.Course), true)
+	p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(l.Satellites), true))
+	p.Attributes = p.Attributes.AppendNullInt(realtime, null.NewInt(flag(l.Realtime), true))
+}
+
+func (a Adapter) copyStatus(p *common.Position, s *Status) {
+	info := s.TerminalInfo
+	p.Attributes = p.Attributes.AppendNullInt(status, null.NewInt(int64(info), true))
+	p.Attributes = p.Attributes.AppendNullInt(armed, null.NewInt(flag(info&(1<<0) != 0), true))
+	p.Attributes = p.Attributes.AppendNullInt(ignition, null.NewInt(flag(info&(1<<1) != 0), true))
+	p.Attributes = p.Attributes.AppendNullInt(charging, null.NewInt(flag(info&(1<<2) != 0), true))
+	p.Attributes = p.Attributes.AppendNullInt(gpsTracking, null.NewInt(flag(info&(1<<6) != 0), true))
+	p.Attributes = p.Attributes.AppendNullInt(oilCut, null.NewInt(flag(info&(1<<7) != 0), true))
+	p.Attributes = p.Attributes.AppendNullInt(powerLevel, null.NewInt(int64(s.Voltage), true))
+	p.Attributes = p.Attributes.AppendNullInt(rssi, null.NewInt(int64(s.GSM), true))
+
+	name, ok := alarms[s.Alarm]
+	if !ok {
+		name, ok = terminalAlarms[info>>3&0b111]
+	}
+	p.Attributes = p.Attributes.AppendNullString(alarm, null.NewString(name, ok))
+}
+
+func flag(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package gt06
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "gt06"
+)
+
+var _ tcp.Protocol = (*GT06)(nil)
+
+// ErrNotLoggedIn is returned when data packet is received before login packet.
+var ErrNotLoggedIn = errors.New("data before login")
+
+// GT06 is a Concox/Jimi GT06 protocol struct.
+type GT06 struct {
+}
+
+// NewGT06 creates a new GT06 struct instance.
+func NewGT06() *GT06 {
+	return &GT06{}
+}
+
+// Name returns the name of the GT06 protocol.
+func (g *GT06) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the GT06 protocol.
+func (g *GT06) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// Respond returns the result of parsing the GT06 data.
+// Device is bound to the session by login packet.
+func (g *GT06) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	if pkg.Type == UnknownType {
+		return res, common.ErrBadData
+	}
+	if pkg.Type == Login {
+		if err != nil {
+			return tcp.Result{CloseSession: true}, fmt.Errorf("login: %w", err)
+		}
+		if pkg.IMEI == "" {
+			return tcp.Result{CloseSession: true}, common.ErrBadData
+		}
+		s.SetDevice(pkg.IMEI)
+		res.Response = pkg.Response()
+		return res, nil
+	}
+	if s.Device() == "" {
+		return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+	}
+	if err != nil {
+		return res, fmt.Errorf("decode %#x packet: %w", uint8(pkg.Type), err)
+	}
+
+	res.Response = pkg.Response()
+	res.GenericAdapter = Adapter{Packet: &pkg, IMEI: s.Device()}
+	return res, nil
+}
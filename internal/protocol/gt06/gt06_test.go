@@ -0,0 +1,147 @@
+package gt06
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	loginFrame     = "78780d01012345678901234500018cdd0d0a"
+	heartbeatFrame = "78780a134004040001000fdcee0d0a"
+	gpsInfo        = "0b081d112e10cc027ac7eb0c46584900148f"
+	lbsInfo        = "01cc00287d001fb8"
+)
+
+// frame wraps protocol number, information content and serial number into 0x7878 packet.
+func frame(t *testing.T, proto MessageType, info string, serial uint16) []byte {
+	t.Helper()
+	content, err := hex.DecodeString(info)
+	require.NoError(t, err)
+	body := []byte{byte(1 + len(content) + serialLen + crcLen), byte(proto)}
+	body = append(body, content...)
+	body = binary.BigEndian.AppendUint16(body, serial)
+	body = binary.BigEndian.AppendUint16(body, CRC16(body))
+	return append(append([]byte{shortStart, shortStart}, body...), stopByte1, stopByte2)
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    []byte
+		wantCount int
+		wantErr   error
+	}{
+		{name: "login", stream: mustHex(t, loginFrame), wantCount: 1},
+		{
+			name:      "login, heartbeat and gps",
+			stream:    bytes.Join([][]byte{mustHex(t, loginFrame), mustHex(t, heartbeatFrame), frame(t, GPSLBS, gpsInfo+lbsInfo, 3)}, nil),
+			wantCount: 3,
+		},
+		{name: "extended", stream: mustHex(t, "7979000594000100000d0a"), wantCount: 1},
+		{name: "bad start", stream: mustHex(t, "7879050100010000"), wantErr: common.ErrBadData},
+		{name: "bad stop", stream: mustHex(t, "78780d01012345678901234500018cdd0d0b"), wantErr: common.ErrBadData},
+		{name: "truncated", stream: mustHex(t, loginFrame[:20]), wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(tt.stream))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	tests := []struct {
+		name     string
+		frame    []byte
+		wantType MessageType
+		wantResp string
+		wantErr  error
+	}{
+		{name: "login", frame: mustHex(t, loginFrame), wantType: Login, wantResp: "787805010001d9dc0d0a"},
+		{name: "heartbeat", frame: mustHex(t, heartbeatFrame), wantType: Heartbeat, wantResp: "78780513000f008f0d0a"},
+		{name: "gps lbs", frame: frame(t, GPSLBS, gpsInfo+lbsInfo, 3), wantType: GPSLBS},
+		{name: "gps lbs ext", frame: frame(t, GPSLBSExt, gpsInfo+lbsInfo+"01000100001388", 4), wantType: GPSLBSExt},
+		{name: "lbs", frame: frame(t, LBS, lbsInfo, 5), wantType: LBS},
+		{name: "unsupported", frame: frame(t, 0x8A, "", 6), wantType: 0x8A, wantErr: ErrUnsupportedType},
+		{name: "bad crc", frame: mustHex(t, "78780d01012345678901234500018cde0d0a"), wantType: UnknownType, wantErr: ErrCRC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.Decode(tt.frame)
+			assert.Equal(t, tt.wantType, p.Type)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantResp, hex.EncodeToString(p.Response()))
+		})
+	}
+}
+
+func TestGT06_Respond(t *testing.T) {
+	g := NewGT06()
+	s := internal.NewSession()
+
+	res, err := g.Respond(s, frame(t, GPSLBS, gpsInfo+lbsInfo, 3))
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	assert.True(t, res.CloseSession)
+
+	res, err = g.Respond(s, mustHex(t, loginFrame))
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.Response)
+	assert.Equal(t, "123456789012345", s.Device())
+
+	res, err = g.Respond(s, frame(t, GPSLBS, gpsInfo+lbsInfo, 3))
+	require.NoError(t, err)
+	assert.Empty(t, res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "123456789012345", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2011, 8, 29, 17, 46, 16, 0, time.UTC), pos[0].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 23.111668, pos[0].Y, 1e-6)
+	assert.InDelta(t, 114.409285, pos[0].X, 1e-6)
+	assert.Equal(t, 143.0, pos[0].Course.Float64)
+	assert.Equal(t, int64(12), pos[0].Attributes[common.Satellites])
+	require.NotNil(t, pos[0].Cellular)
+	assert.Equal(t, common.Cellular{CellID: 0x1FB8, LAC: 0x287D, MCC: 460, MNC: 0}, *pos[0].Cellular)
+
+	// alarm: gps, lbs with length, terminal info with ACC on, voltage, gsm, sos alarm, english.
+	res, err = g.Respond(s, frame(t, Alarm, gpsInfo+"09"+lbsInfo+"4206040102", 7))
+	require.NoError(t, err)
+	assert.Equal(t, "787805160007", hex.EncodeToString(res.Response)[:12])
+	pos = res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "sos", pos[0].Attributes[alarm])
+	assert.Equal(t, int64(1), pos[0].Attributes[ignition])
+	assert.Equal(t, int64(1), pos[0].Attributes[gpsTracking])
+	assert.Equal(t, int64(6), pos[0].Attributes[powerLevel])
+	assert.Equal(t, int64(4), pos[0].Attributes[rssi])
+}
@@ -0,0 +1,202 @@
+package gt06
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/sigurn/crc16"
+)
+
+// MessageType is a GT06 protocol number.
+type MessageType uint8
+
+const (
+	Login       MessageType = 0x01
+	GPS         MessageType = 0x10
+	LBS         MessageType = 0x11
+	GPSLBS      MessageType = 0x12
+	Heartbeat   MessageType = 0x13
+	Alarm       MessageType = 0x16
+	GPSLBSExt   MessageType = 0x22
+	AlarmExt    MessageType = 0x26
+	UnknownType MessageType = 0xFF
+)
+
+const (
+	coordPrecision = 1800000 // 30000 parts of minute, 60 minutes of degree
+	serialLen      = 2
+	crcLen         = 2
+)
+
+var (
+	// ErrCRC is returned when packet checksum mismatches.
+	ErrCRC = errors.New("crc mismatch")
+	// ErrUnsupportedType is returned when packet has protocol number that is not supported.
+	ErrUnsupportedType = errors.New("unsupported protocol number")
+)
+
+var crcTable = crc16.MakeTable(crc16.CRC16_X_25)
+
+// CRC16 calculates the CRC-ITU checksum of the data.
+func CRC16(data []byte) uint16 {
+	return crc16.Checksum(data, crcTable)
+}
+
+// Location is a GPS information of the packet.
+type Location struct {
+	Time       time.Time
+	Satellites uint8
+	Latitude   float64
+	Longitude  float64
+	Speed      uint8
+	Course     uint16
+	Valid      bool
+	Realtime   bool
+}
+
+// Status is a terminal status information of heartbeat and alarm packets.
+type Status struct {
+	TerminalInfo uint8
+	Voltage      uint8
+	GSM          uint8
+	Alarm        uint8
+	Language     uint8
+}
+
+// Packet is a decoded GT06 packet.
+type Packet struct {
+	Type     MessageType
+	Serial   uint16
+	IMEI     string
+	Location *Location
+	Cell     *common.Cellular
+	Status   *Status
+	// ACC and Mileage are presented in extended GPS LBS packet only.
+	ACC     *uint8
+	Mileage *uint32
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+func (p *Packet) Decode(b []byte) error {
+	p.Type = UnknownType
+	lenSize := 1
+	if b[0] == longStart {
+		lenSize = 2
+	}
+	if len(b) < startLen+lenSize+1+serialLen+crcLen+stopLen {
+		return fmt.Errorf("packet is too short: %x", b)
+	}
+	body := b[startLen : len(b)-stopLen-crcLen]
+	crc := binary.BigEndian.Uint16(b[len(b)-stopLen-crcLen:])
+	if got := CRC16(body); got != crc {
+		return fmt.Errorf("%w: got %04x, want %04x", ErrCRC, got, crc)
+	}
+
+	r := gen.NewReader(body[lenSize:], binary.BigEndian)
+	p.Type = MessageType(r.Uint8())
+	info := r.Bytes(r.Len() - serialLen)
+	p.Serial = r.Uint16()
+	if r.Err() != nil {
+		return fmt.Errorf("read packet: %w", r.Err())
+	}
+
+	r = gen.NewReader(info, binary.BigEndian)
+	switch p.Type {
+	case Login:
+		p.IMEI = strings.TrimPrefix(hex.EncodeToString(r.Bytes(8)), "0") //nolint:gomnd
+	case GPS:
+		p.Location = readLocation(r)
+	case LBS:
+		p.Cell = readCell(r)
+	case GPSLBS:
+		p.Location = readLocation(r)
+		p.Cell = readCell(r)
+	case GPSLBSExt:
+		p.Location = readLocation(r)
+		p.Cell = readCell(r)
+		acc := r.Uint8()
+		p.ACC = &acc
+		r.Skip(2) //nolint:gomnd // data upload mode and re-upload flag
+		if r.Len() >= 4 {
+			mileage := r.Uint32()
+			p.Mileage = &mileage
+		}
+	case Heartbeat:
+		p.Status = readStatus(r)
+	case Alarm, AlarmExt:
+		p.Location = readLocation(r)
+		if l := int(r.Uint8()); l > 0 {
+			p.Cell = readCell(gen.NewReader(r.Bytes(l-1), binary.BigEndian))
+		}
+		p.Status = readStatus(r)
+	default:
+		return fmt.Errorf("%w: %#x", ErrUnsupportedType, uint8(p.Type))
+	}
+	if r.Err() != nil {
+		return fmt.Errorf("read %#x information: %w", uint8(p.Type), r.Err())
+	}
+	return nil
+}
+
+// Response returns the reply that shall be sent to the terminal.
+// Login, heartbeat and alarm packets are acknowledged with echo of protocol number and serial number.
+func (p *Packet) Response() []byte {
+	switch p.Type {
+	case Login, Heartbeat, Alarm, AlarmExt:
+	default:
+		return nil
+	}
+	b := []byte{shortStart, shortStart, 1 + serialLen + crcLen, byte(p.Type)}
+	b = binary.BigEndian.AppendUint16(b, p.Serial)
+	b = binary.BigEndian.AppendUint16(b, CRC16(b[startLen:]))
+	return append(b, stopByte1, stopByte2)
+}
+
+func readLocation(r *gen.Reader) *Location {
+	var l Location
+	dt := r.Bytes(6) //nolint:gomnd
+	if dt != nil {
+		l.Time = time.Date(2000+int(dt[0]), time.Month(dt[1]), int(dt[2]),
+			int(dt[3]), int(dt[4]), int(dt[5]), 0, time.UTC)
+	}
+	l.Satellites = r.Uint8() & 0x0F //nolint:gomnd // high nibble is length of GPS information
+	l.Latitude = float64(r.Uint32()) / coordPrecision
+	l.Longitude = float64(r.Uint32()) / coordPrecision
+	l.Speed = r.Uint8()
+	flags := r.Uint16()
+	l.Course = flags & 0x03FF //nolint:gomnd
+	l.Realtime = flags&(1<<13) == 0
+	l.Valid = flags&(1<<12) != 0
+	if flags&(1<<10) == 0 {
+		l.Latitude = -l.Latitude
+	}
+	if flags&(1<<11) != 0 {
+		l.Longitude = -l.Longitude
+	}
+	return &l
+}
+
+func readCell(r *gen.Reader) *common.Cellular {
+	return &common.Cellular{
+		MCC:    int64(r.Uint16()),
+		MNC:    int64(r.Uint8()),
+		LAC:    int64(r.Uint16()),
+		CellID: int64(r.Uint24()),
+	}
+}
+
+func readStatus(r *gen.Reader) *Status {
+	return &Status{
+		TerminalInfo: r.Uint8(),
+		Voltage:      r.Uint8(),
+		GSM:          r.Uint8(),
+		Alarm:        r.Uint8(),
+		Language:     r.Uint8(),
+	}
+}
@@ -0,0 +1,97 @@
+package gt06
+
+import (
+	"bufio"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	startLen   = 2
+	stopLen    = 2
+	shortStart = 0x78
+	longStart  = 0x79
+	stopByte1  = 0x0D
+	stopByte2  = 0x0A
+)
+
+// Splitter implements common.FrameSplitter contract to extract GT06 packet from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for GT06 protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract GT06 packet from incoming bytes stream.
+// Packet starts with 0x7878 and one byte length or with 0x7979 and two bytes length,
+// and ends with 0x0D0A stop bits.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if len(data) > 1 && !(data[0] == shortStart && data[1] == shortStart ||
+			data[0] == longStart && data[1] == longStart) {
+			return s.bad(data)
+		}
+
+		lenSize := 1
+		if data[0] == longStart {
+			lenSize = 2
+		}
+		if len(data) < startLen+lenSize {
+			return s.more(data, atEOF)
+		}
+
+		pkgLen := startLen + lenSize + stopLen
+		if lenSize == 1 {
+			pkgLen += int(data[startLen])
+		} else {
+			pkgLen += int(binary.BigEndian.Uint16(data[startLen : startLen+lenSize]))
+		}
+		if len(data) < pkgLen {
+			return s.more(data, atEOF)
+		}
+
+		if data[pkgLen-2] != stopByte1 || data[pkgLen-1] != stopByte2 {
+			return s.bad(data)
+		}
+
+		// Finally got all data, return it.
+		return pkgLen, data[0:pkgLen], nil
+	}
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to GT06 protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as GT06 protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,157 @@
+package navtelecom
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+// FLEX 1.0 field numbers used by adapter.
+const (
+	FieldIndex        = 1
+	FieldEvent        = 2
+	FieldTime         = 3
+	FieldStatus       = 4
+	FieldGSM          = 7
+	FieldNavigation   = 8
+	FieldFixTime      = 9
+	FieldLatitude     = 10
+	FieldLongitude    = 11
+	FieldAltitude     = 12
+	FieldSpeed        = 13
+	FieldCourse       = 14
+	FieldOdometer     = 15
+	FieldPower        = 19
+	FieldBattery      = 20
+	FieldAnalogInput1 = 21
+	FieldAnalogInput8 = 28
+	FieldInputs1      = 29
+	FieldInputs2      = 30
+	FieldOutputs1     = 31
+	FieldOutputs2     = 32
+	FieldEngineHours  = 37
+	FieldTemperature1 = 45
+	FieldTemperature8 = 52
+)
+
+const (
+	index        = "index"
+	event        = "event"
+	status       = "status"
+	rssi         = "rssi"
+	power        = "power"
+	battery      = "battery"
+	engineHours  = "engine_hours"
+	temperature  = "temperature"
+	eventIndex   = "event_index"
+	fieldPrefix  = "flex"
+	coordDivisor = 600000 // coordinates are in 1/10000 of minute.
+)
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Navtelecom FLEX message.
+type Adapter struct {
+	Message *Message
+	IMEI    string
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Each record of the message is converted into position, records without time are skipped.
+func (a Adapter) GenericPositions() []common.Position {
+	pos := make([]common.Position, 0, len(a.Message.Records))
+	for _, rec := range a.Message.Records {
+		p := a.convertRecordToGeneric(rec)
+		if p.DeviceTime.IsZero() {
+			continue
+		}
+		pos = append(pos, p)
+	}
+	if len(pos) > 0 {
+		return pos
+	}
+	return nil
+}
+
+func (a Adapter) convertRecordToGeneric(rec Record) common.Position {
+	p := common.Position{
+		Protocol: Proto,
+		DeviceID: a.IMEI,
+	}
+	p.Location.Type = geom.DimXY
+	if a.Message.Type == TypeAlarm {
+		p.Attributes = p.Attributes.AppendNullInt(eventIndex, null.NewInt(int64(a.Message.EventIndex), true))
+	}
+
+	// Event time is preferred, time of the last valid fix is used if event time is not negotiated.
+	if v, ok := rec[FieldFixTime]; ok {
+		p.DeviceTime = time.Unix(int64(v), 0).UTC()
+	}
+	if v, ok := rec[FieldTime]; ok {
+		p.DeviceTime = time.Unix(int64(v), 0).UTC()
+	}
+
+	for n, v := range rec {
+		a.copyField(&p, n, v)
+	}
+	return p
+}
+
+func (a Adapter) copyField(p *common.Position, n int, v uint64) {
+	switch {
+	case n == FieldTime, n == FieldFixTime:
+	case n == FieldIndex:
+		p.Attributes = p.Attributes.AppendNullInt(index, null.NewInt(int64(v), true))
+	case n == FieldEvent:
+		p.Attributes = p.Attributes.AppendNullInt(event, null.NewInt(int64(v), true))
+	case n == FieldStatus:
+		p.Attributes = p.Attributes.AppendNullInt(status, null.NewInt(int64(v), true))
+	case n == FieldGSM:
+		p.Attributes = p.Attributes.AppendNullInt(rssi, null.NewInt(int64(v), true))
+	case n == FieldNavigation:
+		// bit 1 is valid fix, bits 2-7 are number of satellites.
+		p.Location.Valid = v&0x02 != 0
+		p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(v>>2), true))
+	case n == FieldLatitude:
+		p.Location.Y = float64(int32(v)) / coordDivisor
+	case n == FieldLongitude:
+		p.Location.X = float64(int32(v)) / coordDivisor
+	case n == FieldAltitude:
+		// altitude is in decimeters.
+		p.Location.Type = geom.DimXYZ
+		p.Location.Z = float64(int32(v)) / 10
+	case n == FieldSpeed:
+		p.Speed = null.NewFloat(float64(math.Float32frombits(uint32(v))), true)
+	case n == FieldCourse:
+		p.Course = null.NewFloat(float64(v), true)
+	case n == FieldOdometer:
+		// odometer is in kilometers, attribute is in meters.
+		p.Attributes = p.Attributes.AppendNullInt(common.Odometer,
+			null.NewInt(int64(float64(math.Float32frombits(uint32(v)))*1000), true))
+	case n == FieldPower:
+		p.Attributes = p.Attributes.AppendNullInt(power, null.NewInt(int64(v), true))
+	case n == FieldBattery:
+		p.Attributes = p.Attributes.AppendNullInt(battery, null.NewInt(int64(v), true))
+	case n >= FieldAnalogInput1 && n <= FieldAnalogInput8:
+		p.Attributes = p.Attributes.AppendNullInt(
+			fmt.Sprintf("%s_%d", common.AnInput, n-FieldAnalogInput1+1), null.NewInt(int64(v), true))
+	case n == FieldInputs1, n == FieldInputs2:
+		p.Attributes = p.Attributes.AppendNullInt(
+			fmt.Sprintf("%s_%d", common.DigInput, n-FieldInputs1+1), null.NewInt(int64(v), true))
+	case n == FieldOutputs1, n == FieldOutputs2:
+		p.Attributes = p.Attributes.AppendNullInt(
+			fmt.Sprintf("%s_%d", common.DigOutput, n-FieldOutputs1+1), null.NewInt(int64(v), true))
+	case n == FieldEngineHours:
+		p.Attributes = p.Attributes.AppendNullInt(engineHours, null.NewInt(int64(v), true))
+	case n >= FieldTemperature1 && n <= FieldTemperature8:
+		p.Attributes = p.Attributes.AppendNullInt(
+			fmt.Sprintf("%s_%d", temperature, n-FieldTemperature1+1), null.NewInt(int64(int8(v)), true))
+	default:
+		p.Attributes = p.Attributes.AppendNullInt(fmt.Sprintf("%s_%d", fieldPrefix, n), null.NewInt(int64(v), true))
+	}
+}
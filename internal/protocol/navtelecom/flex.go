@@ -0,0 +1,90 @@
+package navtelecom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+)
+
+const (
+	flexProtocol = 0xB0
+)
+
+// ErrUnknownField is returned when negotiated FLEX set contains the field out of the fields table,
+// records of such structure can not be read since the size of the field is not known.
+var ErrUnknownField = errors.New("unknown flex field")
+
+// fieldSizes are sizes in bytes of FLEX 1.0 fields, index is field number minus one.
+// Fields after 69 are not decoded, their sizes let records with them be read.
+var fieldSizes = []int{
+	4, 2, 4, 1, 1, 1, 1, 1, 4, 4, // 1-10: index, event, time, status, modules 1-2, gsm, nav, fix time, latitude
+	4, 4, 4, 2, 4, 4, 2, 2, 2, 2, // 11-20: longitude, altitude, speed, course, odometer, trip, trip time, power, battery
+	2, 2, 2, 2, 2, 2, 2, 2, 1, 1, // 21-30: analog inputs 1-8, digital inputs 1-16
+	1, 1, 4, 4, 2, 2, 4, 2, 2, 2, // 31-40: outputs 1-16, pulse counters 1-2, frequency 1-2, engine hours, fuel levels 1-3
+	2, 2, 2, 2, 1, 1, 1, 1, 1, 1, // 41-50: fuel levels 4-6, fuel rs-232, temperatures 1-6
+	1, 1, 2, 4, 2, 1, 4, 2, 2, 2, // 51-60: temperatures 7-8, can fuel level, consumption, rpm, coolant, mileage, axle loads 1-3
+	2, 2, 1, 1, 1, 2, 4, 2, 1, 8, // 61-70: axle loads 4-5, pedals, engine load, exhaust fluid, engine time, service, speed
+	2, 1, 16, 4, 2, 4, 37, 1, 1, 1, // 71-80
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 81-90
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 91-100
+	1, 1, 1, 1, 6, 12, 24, 48, 1, 1, // 101-110
+	1, 1, 4, 4, 1, 4, 2, 6, 2, 6, // 111-120
+}
+
+// Flex is a negotiated FLEX telemetry structure.
+type Flex struct {
+	Version       uint8
+	StructVersion uint8
+	// Fields are enabled field numbers in the order they are presented in the record.
+	Fields []int
+}
+
+// RecordSize returns the size in bytes of the record of negotiated structure.
+func (f *Flex) RecordSize() int {
+	size := 0
+	for _, n := range f.Fields {
+		size += fieldSizes[n-1]
+	}
+	return size
+}
+
+// decodeFlexNegotiation decodes the body of *>FLEX message that follows the prefix:
+// protocol, protocol version, structure version, number of bits and the bit field itself.
+func decodeFlexNegotiation(b []byte) (*Flex, error) {
+	r := gen.NewReader(b, binary.LittleEndian)
+	proto := r.Uint8()
+	f := &Flex{Version: r.Uint8(), StructVersion: r.Uint8()}
+	bits := int(r.Uint8())
+	mask := r.Bytes((bits + 7) / 8) //nolint:gomnd
+	if r.Err() != nil {
+		return nil, fmt.Errorf("read flex negotiation: %w", r.Err())
+	}
+	if proto != flexProtocol {
+		return nil, fmt.Errorf("not flex protocol: %#02x", proto)
+	}
+	for i := 0; i < bits; i++ {
+		// bits are numbered from the most significant bit of the first byte.
+		if mask[i/8]&(0x80>>(i%8)) == 0 {
+			continue
+		}
+		if i >= len(fieldSizes) {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownField, i+1)
+		}
+		f.Fields = append(f.Fields, i+1)
+	}
+	return f, nil
+}
+
+// Record is a decoded FLEX record: raw values of enabled fields by field number.
+type Record map[int]uint64
+
+// decodeRecord decodes single record of negotiated structure.
+func (f *Flex) decodeRecord(r *gen.Reader) Record {
+	rec := make(Record, len(f.Fields))
+	for _, n := range f.Fields {
+		rec[n] = r.Uint(fieldSizes[n-1])
+	}
+	return rec
+}
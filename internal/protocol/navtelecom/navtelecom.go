@@ -0,0 +1,126 @@
+package navtelecom
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto   = "navtelecom"
+	ctxFlex = "flex"
+)
+
+var (
+	_ tcp.Protocol         = (*Navtelecom)(nil)
+	_ tcp.ResponseSplitter = (*Navtelecom)(nil)
+)
+
+var (
+	// ErrNotLoggedIn is returned when FLEX negotiation or data is received before identification.
+	ErrNotLoggedIn = errors.New("device is not logged in")
+	// ErrNotNegotiated is returned when FLEX data is received before FLEX structure negotiation.
+	ErrNotNegotiated = errors.New("flex structure is not negotiated")
+	// ErrUnsupportedMessage is returned for NTCB messages that are not supported.
+	ErrUnsupportedMessage = errors.New("unsupported ntcb message")
+)
+
+// Navtelecom is a Navtelecom NTCB/FLEX protocol struct.
+type Navtelecom struct {
+}
+
+// NewNavtelecom creates a new Navtelecom struct instance.
+func NewNavtelecom() *Navtelecom {
+	return &Navtelecom{}
+}
+
+// Name returns the name of the Navtelecom protocol.
+func (n *Navtelecom) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Navtelecom protocol.
+func (n *Navtelecom) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// NewResponseSplitter returns a new instance of the split function for the Navtelecom replies.
+// FLEX acknowledgements are not enveloped and can't be split without the negotiated structure,
+// so they are read as is.
+func (n *Navtelecom) NewResponseSplitter() common.FrameSplitter {
+	return gen.NewChunkSplitter()
+}
+
+// Respond returns the result of parsing the Navtelecom data.
+// NTCB envelopes carry identification *>S and FLEX structure negotiation *>FLEX,
+// the negotiated structure is kept in session to decode FLEX messages that follow.
+func (n *Navtelecom) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	switch bytes[0] {
+	case pingByte:
+		return res, nil
+	case flexMarker:
+		return n.respondFlex(s, bytes)
+	default:
+		return n.respondNTCB(s, bytes)
+	}
+}
+
+func (n *Navtelecom) respondNTCB(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	env := Envelope{}
+	if err = env.Decode(bytes); err != nil {
+		return res, fmt.Errorf("decode ntcb: %w", err)
+	}
+
+	if imei, ok := env.IMEI(); ok {
+		s.SetDevice(imei)
+		res.Response = env.Reply([]byte(prefixIdentifyResp)).Encode()
+		return res, nil
+	}
+
+	f, ok, err := env.Flex()
+	if !ok {
+		return res, fmt.Errorf("%w: %q", ErrUnsupportedMessage, env.Data)
+	}
+	if s.Device() == "" {
+		return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+	}
+	if err != nil {
+		// Device couldn't be served without the structure.
+		return tcp.Result{CloseSession: true}, fmt.Errorf("decode flex negotiation: %w", err)
+	}
+	s.Set(ctxFlex, f)
+	reply := append([]byte(prefixFlexResp), flexProtocol, f.Version, f.StructVersion)
+	res.Response = env.Reply(reply).Encode()
+	return res, nil
+}
+
+// respondFlex decodes FLEX message, message with wrong CRC is not acknowledged, so device will resend it.
+func (n *Navtelecom) respondFlex(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	if s.Device() == "" {
+		return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+	}
+	f := n.flex(s)
+	if f == nil {
+		return tcp.Result{CloseSession: true}, ErrNotNegotiated
+	}
+
+	msg := Message{}
+	if err = msg.Decode(f, bytes); err != nil {
+		return res, fmt.Errorf("decode flex message: %w", err)
+	}
+	res.Response = msg.Response()
+	res.GenericAdapter = Adapter{Message: &msg, IMEI: s.Device()}
+	return res, nil
+}
+
+func (n *Navtelecom) flex(s *internal.Session) *Flex {
+	val := s.Get(ctxFlex)
+	if val == nil {
+		return nil
+	}
+	return val.(*Flex)
+}
@@ -0,0 +1,238 @@
+package navtelecom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const imei = "352094080107532"
+
+// fields negotiated in tests: index, event, time, navigation, latitude, longitude, altitude, speed, course,
+// power and first temperature sensor.
+var fields = []int{1, 2, 3, 8, 10, 11, 12, 13, 14, 19, 45}
+
+// recordTime is 2023-04-01 10:00:00.
+var recordTime = time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+
+func envelope(data string) []byte {
+	e := Envelope{Receiver: 1, Sender: 0, Data: []byte(data)}
+	return e.Encode()
+}
+
+func negotiation(bits int, fields ...int) []byte {
+	mask := make([]byte, (bits+7)/8)
+	for _, n := range fields {
+		mask[(n-1)/8] |= 0x80 >> ((n - 1) % 8)
+	}
+	b := append([]byte(prefixFlex), flexProtocol, 0x0A, 0x0A, uint8(bits))
+	return envelope(string(append(b, mask...)))
+}
+
+// record of index 7, event 0x1234, valid fix with 9 satellites at 55.752220 37.615560 150m,
+// speed 36.5 km/h, course 180, power 12500 mV and temperature -5.
+func record() []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 7)
+	b = binary.LittleEndian.AppendUint16(b, 0x1234)
+	b = binary.LittleEndian.AppendUint32(b, uint32(recordTime.Unix()))
+	b = append(b, 9<<2|0x02|0x01)
+	b = binary.LittleEndian.AppendUint32(b, uint32(int32(55.752220*coordDivisor)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(int32(37.615560*coordDivisor)))
+	b = binary.LittleEndian.AppendUint32(b, 1500)
+	b = binary.LittleEndian.AppendUint32(b, math.Float32bits(36.5))
+	b = binary.LittleEndian.AppendUint16(b, 180)
+	b = binary.LittleEndian.AppendUint16(b, 12500)
+	var temp int8 = -5
+	return append(b, uint8(temp))
+}
+
+func flexMessage(head []byte, records ...[]byte) []byte {
+	b := append([]byte(nil), head...)
+	for _, r := range records {
+		b = append(b, r...)
+	}
+	return append(b, CRC8(b))
+}
+
+func TestCRC8(t *testing.T) {
+	assert.Equal(t, uint8(0xF7), CRC8([]byte("123456789")))
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	identify := envelope(prefixIdentify + ":" + imei)
+	flex := negotiation(69, fields...)
+	array := flexMessage([]byte{flexMarker, TypeArray, 2}, record(), record())
+	tests := []struct {
+		name      string
+		stream    []byte
+		wantCount int
+		wantErr   error
+	}{
+		{name: "identification", stream: identify, wantCount: 1},
+		{name: "ping", stream: []byte{pingByte, pingByte}, wantCount: 2},
+		{
+			name:      "session",
+			stream:    bytes.Join([][]byte{identify, flex, array, {pingByte}, flexMessage([]byte{flexMarker, TypeCurrent}, record())}, nil),
+			wantCount: 5,
+		},
+		{name: "flex without negotiation", stream: append(identify, array...), wantCount: 1, wantErr: common.ErrBadData},
+		{name: "truncated", stream: append(flex, array[:10]...), wantCount: 1, wantErr: common.ErrBadData},
+		{name: "bad header checksum", stream: append([]byte(ntcbPreamble), make([]byte, 12)...)[:15], wantErr: common.ErrBadData},
+		{name: "bad preamble", stream: []byte("@NTX"), wantErr: common.ErrBadData},
+		{name: "garbage", stream: []byte{0x01, 0x02}, wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(tt.stream))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestEnvelope_Decode(t *testing.T) {
+	e := Envelope{}
+	require.NoError(t, e.Decode(envelope(prefixIdentify+":"+imei)))
+	assert.Equal(t, uint32(1), e.Receiver)
+	got, ok := e.IMEI()
+	assert.True(t, ok)
+	assert.Equal(t, imei, got)
+
+	b := envelope(prefixIdentify + ":" + imei)
+	b[len(b)-1] ^= 0xFF
+	assert.ErrorIs(t, e.Decode(b), ErrChecksum)
+}
+
+func TestDecodeFlexNegotiation(t *testing.T) {
+	e := Envelope{}
+	require.NoError(t, e.Decode(negotiation(69, fields...)))
+	f, ok, err := e.Flex()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, fields, f.Fields)
+	assert.Equal(t, len(record()), f.RecordSize())
+
+	// fields of FLEX 1.0 beyond the decoded ones are negotiated and skipped in records.
+	require.NoError(t, e.Decode(negotiation(120, 1, 70, 77, 105, 120)))
+	f, ok, err = e.Flex()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []int{1, 70, 77, 105, 120}, f.Fields)
+	assert.Equal(t, 4+8+37+6+6, f.RecordSize())
+
+	r := gen.NewReader(make([]byte, f.RecordSize()), binary.LittleEndian)
+	assert.Len(t, f.decodeRecord(r), len(f.Fields))
+	assert.NoError(t, r.Err())
+	assert.Zero(t, r.Len())
+
+	require.NoError(t, e.Decode(negotiation(200, 1, 200)))
+	_, _, err = e.Flex()
+	assert.ErrorIs(t, err, ErrUnknownField)
+}
+
+func TestMessage_Decode(t *testing.T) {
+	f := &Flex{Fields: fields}
+	tests := []struct {
+		name         string
+		message      []byte
+		wantRecords  int
+		wantResponse []byte
+		wantErr      error
+	}{
+		{
+			name:         "array",
+			message:      flexMessage([]byte{flexMarker, TypeArray, 2}, record(), record()),
+			wantRecords:  2,
+			wantResponse: flexMessage([]byte{flexMarker, TypeArray, 2}),
+		},
+		{
+			name:         "alarm",
+			message:      flexMessage([]byte{flexMarker, TypeAlarm, 5, 0, 0, 0}, record()),
+			wantRecords:  1,
+			wantResponse: flexMessage([]byte{flexMarker, TypeAlarm, 5, 0, 0, 0}),
+		},
+		{
+			name:         "current",
+			message:      flexMessage([]byte{flexMarker, TypeCurrent}, record()),
+			wantRecords:  1,
+			wantResponse: flexMessage([]byte{flexMarker, TypeCurrent}),
+		},
+		{name: "bad crc", message: append(flexMessage([]byte{flexMarker, TypeCurrent}, record()), 0)[1:], wantErr: ErrCRC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Message{}
+			err := m.Decode(f, tt.message)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			assert.Len(t, m.Records, tt.wantRecords)
+			assert.Equal(t, tt.wantResponse, m.Response())
+		})
+	}
+}
+
+func TestNavtelecom_Respond(t *testing.T) {
+	n := NewNavtelecom()
+	s := internal.NewSession()
+
+	res, err := n.Respond(s, negotiation(69, fields...))
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	assert.True(t, res.CloseSession)
+
+	res, err = n.Respond(s, envelope(prefixIdentify+":"+imei))
+	require.NoError(t, err)
+	assert.Equal(t, imei, s.Device())
+	reply := Envelope{}
+	require.NoError(t, reply.Decode(res.Response))
+	assert.Equal(t, uint32(1), reply.Sender)
+	assert.Equal(t, []byte(prefixIdentifyResp), reply.Data)
+
+	res, err = n.Respond(s, flexMessage([]byte{flexMarker, TypeCurrent}, record()))
+	assert.ErrorIs(t, err, ErrNotNegotiated)
+	assert.True(t, res.CloseSession)
+
+	res, err = n.Respond(s, negotiation(69, fields...))
+	require.NoError(t, err)
+	require.NoError(t, reply.Decode(res.Response))
+	assert.Equal(t, append([]byte(prefixFlexResp), flexProtocol, 0x0A, 0x0A), reply.Data)
+
+	res, err = n.Respond(s, []byte{pingByte})
+	require.NoError(t, err)
+	assert.Nil(t, res.Response)
+
+	res, err = n.Respond(s, flexMessage([]byte{flexMarker, TypeAlarm, 5, 0, 0, 0}, record()))
+	require.NoError(t, err)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, imei, pos[0].DeviceID)
+	assert.Equal(t, recordTime, pos[0].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 55.752220, pos[0].Y, 1e-5)
+	assert.InDelta(t, 37.615560, pos[0].X, 1e-5)
+	assert.InDelta(t, 150, pos[0].Z, 1e-9)
+	assert.InDelta(t, 36.5, pos[0].Speed.Float64, 1e-9)
+	assert.InDelta(t, 180.0, pos[0].Course.Float64, 1e-9)
+	assert.Equal(t, int64(9), pos[0].Attributes[common.Satellites])
+	assert.Equal(t, int64(0x1234), pos[0].Attributes[event])
+	assert.Equal(t, int64(5), pos[0].Attributes[eventIndex])
+	assert.Equal(t, int64(12500), pos[0].Attributes[power])
+	assert.Equal(t, int64(-5), pos[0].Attributes[temperature+"_1"])
+}
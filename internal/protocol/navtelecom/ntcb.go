@@ -0,0 +1,101 @@
+package navtelecom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+)
+
+const (
+	ntcbPreamble  = "@NTC"
+	ntcbHeaderLen = 16
+
+	prefixIdentify     = "*>S"
+	prefixIdentifyResp = "*<S"
+	prefixFlex         = "*>FLEX"
+	prefixFlexResp     = "*<FLEX"
+)
+
+// ErrChecksum is returned when NTCB envelope checksum mismatches.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// Envelope is a NTCB message: header and data.
+type Envelope struct {
+	Receiver uint32
+	Sender   uint32
+	Data     []byte
+}
+
+// xorSum is a checksum of the NTCB header and data.
+func xorSum(b []byte) (sum byte) {
+	for _, c := range b {
+		sum ^= c
+	}
+	return sum
+}
+
+// Decode decodes NTCB envelope: preamble, receiver and sender IDs, data length,
+// data checksum, header checksum and data itself.
+// Decoded data doesn't share memory with the frame.
+func (e *Envelope) Decode(b []byte) error {
+	r := gen.NewReader(b, binary.LittleEndian)
+	preamble := r.Bytes(len(ntcbPreamble))
+	e.Receiver = r.Uint32()
+	e.Sender = r.Uint32()
+	n := r.Uint16()
+	dataSum := r.Uint8()
+	headerSum := r.Uint8()
+	data := r.Bytes(int(n))
+	if r.Err() != nil {
+		return fmt.Errorf("read ntcb: %w", r.Err())
+	}
+	if string(preamble) != ntcbPreamble {
+		return fmt.Errorf("bad ntcb preamble: %q", preamble)
+	}
+	if got := xorSum(b[:ntcbHeaderLen-1]); got != headerSum {
+		return fmt.Errorf("%w: header got %02x, want %02x", ErrChecksum, got, headerSum)
+	}
+	if got := xorSum(data); got != dataSum {
+		return fmt.Errorf("%w: data got %02x, want %02x", ErrChecksum, got, dataSum)
+	}
+	e.Data = append([]byte(nil), data...)
+	return nil
+}
+
+// Encode encodes NTCB envelope.
+func (e *Envelope) Encode() []byte {
+	b := make([]byte, 0, ntcbHeaderLen+len(e.Data))
+	b = append(b, ntcbPreamble...)
+	b = binary.LittleEndian.AppendUint32(b, e.Receiver)
+	b = binary.LittleEndian.AppendUint32(b, e.Sender)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(e.Data)))
+	b = append(b, xorSum(e.Data))
+	b = append(b, xorSum(b))
+	return append(b, e.Data...)
+}
+
+// Reply returns the envelope addressed back to the sender with given data.
+func (e *Envelope) Reply(data []byte) *Envelope {
+	return &Envelope{Receiver: e.Sender, Sender: e.Receiver, Data: data}
+}
+
+// IMEI returns the device IMEI if the envelope is an identification message *>S:<IMEI>.
+func (e *Envelope) IMEI() (string, bool) {
+	if !bytes.HasPrefix(e.Data, []byte(prefixIdentify)) {
+		return "", false
+	}
+	imei := bytes.TrimPrefix(e.Data[len(prefixIdentify):], []byte(":"))
+	return string(imei), len(imei) > 0
+}
+
+// Flex returns the negotiated structure if the envelope is a FLEX negotiation message.
+func (e *Envelope) Flex() (*Flex, bool, error) {
+	if !bytes.HasPrefix(e.Data, []byte(prefixFlex)) {
+		return nil, false, nil
+	}
+	f, err := decodeFlexNegotiation(e.Data[len(prefixFlex):])
+	return f, true, err
+}
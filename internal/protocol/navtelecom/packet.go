@@ -0,0 +1,80 @@
+package navtelecom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/sigurn/crc8"
+)
+
+// Message types of FLEX messages.
+const (
+	TypeArray   = 'A'
+	TypeAlarm   = 'T'
+	TypeCurrent = 'C'
+)
+
+// ErrCRC is returned when FLEX message checksum mismatches.
+var ErrCRC = errors.New("crc mismatch")
+
+var crcTable = crc8.MakeTable(crc8.Params{Poly: 0x31, Init: 0xFF, Check: 0xF7, Name: "CRC-8/NRSC-5"})
+
+// CRC8 calculates the checksum of FLEX message.
+func CRC8(data []byte) uint8 {
+	return crc8.Checksum(data, crcTable)
+}
+
+// Message is a decoded FLEX telemetry message.
+type Message struct {
+	Type uint8
+	// EventIndex is presented for ~T messages only.
+	EventIndex uint32
+	Records    []Record
+}
+
+// Decode decodes FLEX message extracted by Splitter according to negotiated structure.
+func (m *Message) Decode(f *Flex, b []byte) error {
+	if len(b) < flexHeaderLen+crcLen {
+		return fmt.Errorf("read flex message: short message of %d bytes", len(b))
+	}
+	if got, want := CRC8(b[:len(b)-crcLen]), b[len(b)-crcLen]; got != want {
+		return fmt.Errorf("%w: got %02x, want %02x", ErrCRC, got, want)
+	}
+
+	r := gen.NewReader(b[:len(b)-crcLen], binary.LittleEndian)
+	r.Skip(1)
+	m.Type = r.Uint8()
+	count := 1
+	switch m.Type {
+	case TypeArray:
+		count = int(r.Uint8())
+	case TypeAlarm:
+		m.EventIndex = r.Uint32()
+	case TypeCurrent:
+	default:
+		return fmt.Errorf("unsupported flex message: %q", m.Type)
+	}
+	for i := 0; i < count; i++ {
+		m.Records = append(m.Records, f.decodeRecord(r))
+	}
+	if r.Err() != nil {
+		m.Records = nil
+		return fmt.Errorf("read flex records: %w", r.Err())
+	}
+	return nil
+}
+
+// Response returns the acknowledgement of the message: type, number of records
+// or event index and CRC8 of the reply.
+func (m *Message) Response() []byte {
+	b := []byte{flexMarker, m.Type}
+	switch m.Type {
+	case TypeArray:
+		b = append(b, uint8(len(m.Records)))
+	case TypeAlarm:
+		b = binary.LittleEndian.AppendUint32(b, m.EventIndex)
+	}
+	return append(b, CRC8(b))
+}
@@ -0,0 +1,144 @@
+package navtelecom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	flexMarker    = '~'
+	pingByte      = 0x7F
+	flexHeaderLen = 2
+	eventIndexLen = 4
+	crcLen        = 1
+	maxNTCBLen    = bufio.MaxScanTokenSize - ntcbHeaderLen
+)
+
+// Splitter implements common.FrameSplitter contract to extract NTCB envelopes and FLEX messages
+// from incoming bytes.
+// Size of FLEX message depends on the negotiated structure, so Splitter follows *>FLEX negotiation
+// of the session it is created for.
+type Splitter struct {
+	badData []byte
+	err     error
+	flex    *Flex
+}
+
+// NewSplitter creates a new Splitter instance for Navtelecom protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Navtelecom message from incoming bytes stream.
+// NTCB envelope starts with @NTC preamble and has 16 bytes header with data length and checksums.
+// FLEX messages start with ~ and message type: ~A array of records, ~T alarm record, ~C current state,
+// they end with CRC8 and are not enveloped. Single 0x7F byte is a keep alive ping.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		switch data[0] {
+		case pingByte:
+			return 1, data[:1], nil
+		case ntcbPreamble[0]:
+			return s.ntcb(data, atEOF)
+		case flexMarker:
+			return s.flexMessage(data, atEOF)
+		default:
+			return s.bad(data)
+		}
+	}
+}
+
+func (s *Splitter) ntcb(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) < ntcbHeaderLen {
+		if !bytes.HasPrefix([]byte(ntcbPreamble), data[:min(len(data), len(ntcbPreamble))]) {
+			return s.bad(data)
+		}
+		return s.more(data, atEOF)
+	}
+	if string(data[:len(ntcbPreamble)]) != ntcbPreamble || xorSum(data[:ntcbHeaderLen-1]) != data[ntcbHeaderLen-1] {
+		return s.bad(data)
+	}
+	dataLen := int(binary.LittleEndian.Uint16(data[12:14]))
+	if dataLen > maxNTCBLen {
+		return s.bad(data)
+	}
+	pkgLen := ntcbHeaderLen + dataLen
+	if len(data) < pkgLen {
+		return s.more(data, atEOF)
+	}
+
+	// Keep negotiated structure to split FLEX messages that follow.
+	env := Envelope{}
+	if env.Decode(data[:pkgLen]) == nil {
+		if f, ok, err := env.Flex(); ok && err == nil {
+			s.flex = f
+		}
+	}
+	return pkgLen, data[0:pkgLen], nil
+}
+
+func (s *Splitter) flexMessage(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) < flexHeaderLen {
+		return s.more(data, atEOF)
+	}
+	if s.flex == nil {
+		return s.bad(data)
+	}
+
+	var pkgLen int
+	switch data[1] {
+	case TypeArray:
+		if len(data) < flexHeaderLen+1 {
+			return s.more(data, atEOF)
+		}
+		pkgLen = flexHeaderLen + 1 + int(data[2])*s.flex.RecordSize() + crcLen
+	case TypeAlarm:
+		pkgLen = flexHeaderLen + eventIndexLen + s.flex.RecordSize() + crcLen
+	case TypeCurrent:
+		pkgLen = flexHeaderLen + s.flex.RecordSize() + crcLen
+	default:
+		return s.bad(data)
+	}
+
+	if len(data) < pkgLen {
+		return s.more(data, atEOF)
+	}
+
+	// Finally got all data, return it.
+	return pkgLen, data[0:pkgLen], nil
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Navtelecom protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Navtelecom protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,109 @@
+package queclink
+
+import (
+	"strconv"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	event    = "event"
+	buffered = "buffered"
+	ignition = "ignition"
+)
+
+// numeric tells how report fields are converted to attributes, fields out of the table are kept as strings.
+var numeric = map[string]func(string) interface{}{
+	common.Odometer:       toFloat,
+	power:                 toInt,
+	battery:               toInt,
+	duration:              toInt,
+	common.AnInput + "_1": toInt,
+	common.AnInput + "_2": toInt,
+}
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Queclink report.
+type Adapter struct {
+	Message *Message
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Each point of the report is converted into position.
+func (a Adapter) GenericPositions() []common.Position {
+	if len(a.Message.Points) == 0 {
+		return nil
+	}
+	pos := make([]common.Position, 0, len(a.Message.Points))
+	for _, pt := range a.Message.Points {
+		pos = append(pos, a.convertPointToGeneric(pt))
+	}
+	return pos
+}
+
+func (a Adapter) convertPointToGeneric(pt Point) common.Position {
+	m := a.Message
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   m.IMEI,
+		DeviceTime: pt.Time,
+		Speed:      null.NewFloat(pt.Speed, true),
+		Course:     null.NewFloat(float64(pt.Azimuth), true),
+	}
+	if p.DeviceTime.IsZero() {
+		p.DeviceTime = m.SendTime
+	}
+	p.Location.X = pt.Lon
+	p.Location.Y = pt.Lat
+	p.Location.Z = pt.Altitude
+	p.Location.Type = geom.DimXYZ
+	// Zero accuracy means there is no GPS fix.
+	p.Location.Valid = pt.Accuracy > 0 && !pt.Time.IsZero()
+	if pt.MCC != 0 {
+		p.Cellular = &common.Cellular{CellID: pt.CellID, LAC: pt.LAC, MCC: pt.MCC, MNC: pt.MNC}
+	}
+
+	p.Attributes = p.Attributes.AppendNullInt(common.HDOP, null.NewInt(pt.Accuracy, true))
+	p.Attributes = p.Attributes.AppendNullString(event, null.NewString(m.Report, true))
+	p.Attributes = p.Attributes.AppendNullInt(buffered, null.NewInt(1, m.Kind == Buff))
+	switch m.Report {
+	case GTIGN:
+		p.Attributes = p.Attributes.AppendNullInt(ignition, null.NewInt(1, true))
+	case GTIGF:
+		p.Attributes = p.Attributes.AppendNullInt(ignition, null.NewInt(0, true))
+	}
+	for name, val := range m.Fields {
+		conv, ok := numeric[name]
+		if !ok {
+			p.Attributes = p.Attributes.AppendNullString(name, null.NewString(val, true))
+			continue
+		}
+		if v := conv(val); v != nil {
+			if p.Attributes == nil {
+				p.Attributes = make(common.Attributes)
+			}
+			p.Attributes[name] = v
+		}
+	}
+	return p
+}
+
+func toInt(s string) interface{} {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return i
+}
+
+func toFloat(s string) interface{} {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return f
+}
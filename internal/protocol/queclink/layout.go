@@ -0,0 +1,65 @@
+package queclink
+
+import (
+	"github.com/gotrackery/protocol/common"
+)
+
+// Names of report fields those are stored as position attributes.
+const (
+	power      = "power"
+	report     = "report"
+	reportID   = "report_id"
+	reportType = "report_type"
+	eriMask    = "eri_mask"
+	duration   = "duration"
+	hourMeter  = "hour_meter"
+	battery    = "battery"
+	status     = "status"
+)
+
+type family int
+
+const (
+	vehicle family = iota
+	personal
+)
+
+// families maps device type (first byte of protocol version) to devices family.
+// Unknown device types are treated as vehicle trackers.
+var families = map[string]family{
+	"04": vehicle,  // GV200
+	"06": vehicle,  // GV300
+	"0F": vehicle,  // GV55
+	"10": vehicle,  // GV55 Lite
+	"1F": vehicle,  // GV500
+	"25": vehicle,  // GV300
+	"27": vehicle,  // GV300W
+	"2F": vehicle,  // GV55
+	"35": vehicle,  // GV200
+	"36": vehicle,  // GV500
+	"02": personal, // GL200
+	"11": personal, // GL500
+	"1A": personal, // GL300
+	"2C": personal, // GL300W
+	"30": personal, // GL300
+}
+
+var vehicleTail = []string{common.Odometer, hourMeter, common.AnInput + "_1", common.AnInput + "_2", battery, status}
+
+var layouts = map[family]map[string]Layout{
+	vehicle: {
+		GTFRI: {Head: []string{power, report}, Counted: true, Tail: vehicleTail},
+		GTERI: {Head: []string{eriMask, power, report}, Counted: true, Tail: vehicleTail},
+		GTIGN: {Head: []string{duration}, Tail: []string{hourMeter, common.Odometer}},
+		GTIGF: {Head: []string{duration}, Tail: []string{hourMeter, common.Odometer}},
+	},
+	personal: {
+		GTFRI: {Head: []string{reportID, reportType}, Counted: true, Tail: []string{battery}},
+	},
+}
+
+// layoutOf returns fields layout of given report for given device type.
+func layoutOf(deviceType, report string) (Layout, bool) {
+	l, ok := layouts[families[deviceType]][report]
+	return l, ok
+}
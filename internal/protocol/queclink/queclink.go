@@ -0,0 +1,67 @@
+package queclink
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "queclink"
+)
+
+var _ tcp.Protocol = (*Queclink)(nil)
+
+// Queclink is a Queclink @Track protocol struct.
+type Queclink struct {
+}
+
+// NewQueclink creates a new Queclink struct instance.
+func NewQueclink() *Queclink {
+	return &Queclink{}
+}
+
+// Name returns the name of the Queclink protocol.
+func (q *Queclink) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Queclink protocol.
+func (q *Queclink) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// Respond returns the result of parsing the Queclink data.
+// Heartbeats and buffered reports are acknowledged with +SACK, real time reports need no reply.
+func (q *Queclink) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	msg := Message{}
+	err = msg.Parse(bytes)
+	if errors.Is(err, ErrMalformed) {
+		return res, fmt.Errorf("%w: %s", common.ErrBadData, err)
+	}
+	if msg.IMEI != "" {
+		s.SetDevice(msg.IMEI)
+	}
+
+	switch {
+	case msg.Kind == Ack && msg.Report == GTHBD:
+		res.Response = []byte(fmt.Sprintf("+SACK:%s,%s,%s$", GTHBD, msg.Version, msg.Count))
+		return res, nil
+	case msg.Kind == Ack:
+		return res, nil
+	case msg.Kind == Buff:
+		res.Response = []byte(fmt.Sprintf("+SACK:%s$", msg.Count))
+	}
+	if errors.Is(err, ErrUnsupportedReport) {
+		// Reports without position (GTINF, GTGSM, etc.) are still acknowledged to let device drop them from buffer.
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	res.GenericAdapter = Adapter{Message: &msg}
+	return res, nil
+}
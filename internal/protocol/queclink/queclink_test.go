@@ -0,0 +1,150 @@
+package queclink
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	gv300FRI = "+RESP:GTFRI,060228,862193020451183,,12613,10,1,1,0.0,0,105.3,117.129721,31.839312,20160420025326," +
+		"0460,0000,5663,2BB9,00,1234.5,,,,80,420000,,,,20160420025327,1A07$"
+	gv300BuffFRI = "+BUFF:GTFRI,060228,862193020451183,,12613,10,2," +
+		"1,0.0,0,105.3,117.129721,31.839312,20160420025326,0460,0000,5663,2BB9,00," +
+		"0,0.0,0,105.3,117.129721,31.839312,,0460,0000,5663,2BB9,00," +
+		"1234.5,,,,80,420000,,,,20160420025327,1A08$"
+	gv300IGN = "+RESP:GTIGN,060100,135790246811220,,1200,1,4.3,92,70.0,121.354335,31.222073,20090214013254," +
+		"0460,0000,18d8,6141,00,12345:12:34,2000.0,20090214093254,11F0$"
+	gl300FRI = "+RESP:GTFRI,300400,860599000773978,,0,0,1,1,0.0,0,134.1,-117.197087,32.846157,20151007202119," +
+		"0310,0410,0DB3,7E8B,00,95,20151007202121,0030$"
+	gv300ERI = "+RESP:GTERI,060228,862193020451183,,00000002,12613,10,1,1,0.0,0,105.3,117.129721,31.839312,20160420025326," +
+		"0460,0000,5663,2BB9,00,1234.5,,,,80,420000,,,,20160420025327,1A09$"
+	heartbeat = "+ACK:GTHBD,060100,135790246811220,,20100214093254,11F0$"
+	info      = "+RESP:GTINF,060100,135790246811220,,16,89860000000000000000,16,0,0,12000,,4.10,0,0,,,20100214093254,,,,,,20100214093254,11F0$"
+)
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "single", stream: gv300FRI, wantCount: 1},
+		{name: "many with line breaks", stream: heartbeat + "\r\n" + gv300FRI + gv300IGN + "\r\n", wantCount: 3},
+		{name: "not terminated", stream: gv300FRI[:50], wantErr: common.ErrBadData},
+		{name: "garbage", stream: "GET / HTTP/1.1\r\n", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(strings.NewReader(tt.stream))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				if len(scanner.Bytes()) > 0 {
+					cnt++
+				}
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestMessage_Parse(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        string
+		wantReport string
+		wantPoints int
+		wantFields map[string]string
+		wantErr    error
+	}{
+		{
+			name: "gv300 fri", msg: gv300FRI, wantReport: GTFRI, wantPoints: 1,
+			wantFields: map[string]string{power: "12613", report: "10", common.Odometer: "1234.5", battery: "80", status: "420000"},
+		},
+		{
+			name: "gv300 ign", msg: gv300IGN, wantReport: GTIGN, wantPoints: 1,
+			wantFields: map[string]string{duration: "1200", hourMeter: "12345:12:34", common.Odometer: "2000.0"},
+		},
+		{
+			name: "gl300 fri", msg: gl300FRI, wantReport: GTFRI, wantPoints: 1,
+			wantFields: map[string]string{reportID: "0", reportType: "0", battery: "95"},
+		},
+		{
+			name: "gv300 eri", msg: gv300ERI, wantReport: GTERI, wantPoints: 1,
+			wantFields: map[string]string{eriMask: "00000002", power: "12613", report: "10", common.Odometer: "1234.5", battery: "80", status: "420000"},
+		},
+		{name: "buffered", msg: gv300BuffFRI, wantReport: GTFRI, wantPoints: 2},
+		{name: "heartbeat", msg: heartbeat, wantReport: GTHBD},
+		{name: "unsupported", msg: info, wantReport: "GTINF", wantErr: ErrUnsupportedReport},
+		{name: "truncated", msg: "+RESP:GTFRI,060228,862193020451183,,12613,10,3,1,20160420025327,1A07$", wantErr: ErrMalformed},
+		{name: "negative points", msg: "+RESP:GTFRI,060228,862193020451183,,12613,10,-1,20160420025327,1A07$", wantErr: ErrMalformed},
+		{name: "too many points", msg: "+RESP:GTFRI,060228,862193020451183,,12613,10,99999999999,20160420025327,1A07$", wantErr: ErrMalformed},
+		{name: "unknown kind", msg: "+FOO:GTFRI,1,2,3,4,5$", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Message{}
+			err := m.Parse([]byte(tt.msg))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReport, m.Report)
+			assert.Len(t, m.Points, tt.wantPoints)
+			if tt.wantFields != nil {
+				assert.Equal(t, tt.wantFields, m.Fields)
+			}
+		})
+	}
+}
+
+func TestQueclink_Respond(t *testing.T) {
+	q := NewQueclink()
+	s := internal.NewSession()
+
+	res, err := q.Respond(s, []byte(heartbeat))
+	require.NoError(t, err)
+	assert.Equal(t, "+SACK:GTHBD,060100,11F0$", string(res.Response))
+	assert.Equal(t, "135790246811220", s.Device())
+
+	res, err = q.Respond(s, []byte(gv300FRI))
+	require.NoError(t, err)
+	assert.Empty(t, res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "862193020451183", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2016, 4, 20, 2, 53, 26, 0, time.UTC), pos[0].DeviceTime)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 117.129721, pos[0].X, 1e-9)
+	assert.InDelta(t, 31.839312, pos[0].Y, 1e-9)
+	assert.Equal(t, 1234.5, pos[0].Attributes[common.Odometer])
+	assert.Equal(t, int64(12613), pos[0].Attributes[power])
+	assert.Equal(t, "420000", pos[0].Attributes[status])
+	require.NotNil(t, pos[0].Cellular)
+	assert.Equal(t, int64(0x2BB9), pos[0].Cellular.CellID)
+
+	res, err = q.Respond(s, []byte(gv300BuffFRI))
+	require.NoError(t, err)
+	assert.Equal(t, "+SACK:1A08$", string(res.Response))
+	pos = res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 2)
+	assert.False(t, pos[1].Valid)
+	assert.Equal(t, time.Date(2016, 4, 20, 2, 53, 27, 0, time.UTC), pos[1].DeviceTime)
+	assert.Equal(t, int64(1), pos[1].Attributes[buffered])
+
+	res, err = q.Respond(s, []byte(info))
+	require.NoError(t, err)
+	assert.Nil(t, res.GenericAdapter)
+}
@@ -0,0 +1,230 @@
+package queclink
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageKind is a kind of Queclink message: report, buffered report or acknowledgement.
+type MessageKind string
+
+const (
+	Resp MessageKind = "+RESP"
+	Buff MessageKind = "+BUFF"
+	Ack  MessageKind = "+ACK"
+)
+
+// Supported reports.
+const (
+	GTFRI = "GTFRI"
+	GTERI = "GTERI"
+	GTIGN = "GTIGN"
+	GTIGF = "GTIGF"
+	GTHBD = "GTHBD"
+)
+
+const (
+	timeLayout  = "20060102150405"
+	pointFields = 12
+	// protocol version, imei and device name precede report specific fields.
+	commonHead = 3
+	// send time and count number close any message.
+	commonTail = 2
+)
+
+var (
+	// ErrMalformed is returned when message does not satisfy @Track format.
+	ErrMalformed = errors.New("malformed message")
+	// ErrUnsupportedReport is returned when report has no known field layout.
+	ErrUnsupportedReport = errors.New("unsupported report")
+)
+
+// Layout describes report fields that vary between device types and reports.
+// Empty names stand for reserved fields that are skipped.
+type Layout struct {
+	// Head is names of fields between device name and points.
+	Head []string
+	// Counted signals that number of points field precedes points, otherwise report has a single point.
+	Counted bool
+	// Tail is names of fields between last point and send time.
+	Tail []string
+}
+
+// Point is a single location of report.
+type Point struct {
+	Accuracy int64
+	Speed    float64
+	Azimuth  int64
+	Altitude float64
+	Lon, Lat float64
+	Time     time.Time
+	MCC, MNC int64
+	LAC      int64
+	CellID   int64
+}
+
+// Message is a parsed Queclink @Track message.
+type Message struct {
+	Kind     MessageKind
+	Report   string
+	Version  string
+	IMEI     string
+	Name     string
+	Fields   map[string]string
+	Points   []Point
+	SendTime time.Time
+	Count    string
+}
+
+// DeviceType returns device type code of the protocol version, e.g. 06 for GV300.
+func (m *Message) DeviceType() string {
+	if len(m.Version) < 2 { //nolint:gomnd
+		return ""
+	}
+	return strings.ToUpper(m.Version[:2])
+}
+
+// Parse parses $ terminated message extracted by Splitter.
+func (m *Message) Parse(b []byte) error {
+	s := strings.TrimSuffix(string(b), string(endByte))
+	header, body, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("%w: no message kind", ErrMalformed)
+	}
+	m.Kind = MessageKind(header)
+	switch m.Kind {
+	case Resp, Buff, Ack:
+	default:
+		return fmt.Errorf("%w: unknown message kind %q", ErrMalformed, header)
+	}
+
+	f := strings.Split(body, ",")
+	if len(f) < 1+commonHead+commonTail {
+		return fmt.Errorf("%w: %d fields", ErrMalformed, len(f))
+	}
+	m.Report, m.Version, m.IMEI, m.Name = f[0], f[1], f[2], f[3]
+	m.Count = f[len(f)-1]
+	if f[len(f)-2] != "" {
+		t, err := time.Parse(timeLayout, f[len(f)-2])
+		if err != nil {
+			return fmt.Errorf("%w: send time: %s", ErrMalformed, err)
+		}
+		m.SendTime = t
+	}
+	if m.Kind == Ack {
+		return nil
+	}
+
+	l, ok := layoutOf(m.DeviceType(), m.Report)
+	if !ok {
+		return fmt.Errorf("%w: %s of device type %s", ErrUnsupportedReport, m.Report, m.DeviceType())
+	}
+	return m.parseFields(l, f[1+commonHead:len(f)-commonTail])
+}
+
+func (m *Message) parseFields(l Layout, f []string) error {
+	m.Fields = make(map[string]string)
+	if len(f) < len(l.Head) {
+		return fmt.Errorf("%w: no head fields", ErrMalformed)
+	}
+	m.copyFields(l.Head, f)
+	f = f[len(l.Head):]
+
+	n := 1
+	if l.Counted {
+		if len(f) == 0 {
+			return fmt.Errorf("%w: no number of points", ErrMalformed)
+		}
+		var err error
+		if n, err = strconv.Atoi(f[0]); err != nil {
+			return fmt.Errorf("%w: number of points: %s", ErrMalformed, err)
+		}
+		f = f[1:]
+		if n <= 0 || n > len(f)/pointFields {
+			return fmt.Errorf("%w: number of points: %d", ErrMalformed, n)
+		}
+	}
+	if len(f) < n*pointFields {
+		return fmt.Errorf("%w: %d points expected", ErrMalformed, n)
+	}
+	m.Points = make([]Point, 0, n)
+	for i := 0; i < n; i++ {
+		p, err := parsePoint(f[i*pointFields : (i+1)*pointFields])
+		if err != nil {
+			return fmt.Errorf("%w: point #%d: %s", ErrMalformed, i, err)
+		}
+		m.Points = append(m.Points, p)
+	}
+	m.copyFields(l.Tail, f[n*pointFields:])
+	return nil
+}
+
+func (m *Message) copyFields(names []string, f []string) {
+	for i, name := range names {
+		if i >= len(f) {
+			return
+		}
+		if name != "" && f[i] != "" {
+			m.Fields[name] = f[i]
+		}
+	}
+}
+
+func parsePoint(f []string) (p Point, err error) {
+	p.Accuracy, err = parseInt(f[0], 10)
+	if err != nil {
+		return p, fmt.Errorf("accuracy: %w", err)
+	}
+	if p.Speed, err = parseFloat(f[1]); err != nil {
+		return p, fmt.Errorf("speed: %w", err)
+	}
+	if p.Azimuth, err = parseInt(f[2], 10); err != nil {
+		return p, fmt.Errorf("azimuth: %w", err)
+	}
+	if p.Altitude, err = parseFloat(f[3]); err != nil {
+		return p, fmt.Errorf("altitude: %w", err)
+	}
+	if p.Lon, err = parseFloat(f[4]); err != nil {
+		return p, fmt.Errorf("longitude: %w", err)
+	}
+	if p.Lat, err = parseFloat(f[5]); err != nil {
+		return p, fmt.Errorf("latitude: %w", err)
+	}
+	if f[6] != "" {
+		if p.Time, err = time.Parse(timeLayout, f[6]); err != nil {
+			return p, fmt.Errorf("gps time: %w", err)
+		}
+	}
+	if p.MCC, err = parseInt(f[7], 10); err != nil {
+		return p, fmt.Errorf("mcc: %w", err)
+	}
+	if p.MNC, err = parseInt(f[8], 10); err != nil {
+		return p, fmt.Errorf("mnc: %w", err)
+	}
+	if p.LAC, err = parseInt(f[9], 16); err != nil {
+		return p, fmt.Errorf("lac: %w", err)
+	}
+	if p.CellID, err = parseInt(f[10], 16); err != nil {
+		return p, fmt.Errorf("cell id: %w", err)
+	}
+	return p, nil
+}
+
+// parseInt parses integer treating empty field as zero.
+func parseInt(s string, base int) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, base, 64) //nolint:wrapcheck
+}
+
+// parseFloat parses float treating empty field as zero.
+func parseFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64) //nolint:wrapcheck
+}
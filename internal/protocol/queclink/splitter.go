@@ -0,0 +1,73 @@
+package queclink
+
+import (
+	"bufio"
+	"bytes"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	startByte = '+'
+	endByte   = '$'
+)
+
+// Splitter implements common.FrameSplitter contract to extract Queclink @Track message from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for Queclink @Track protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Queclink message from incoming bytes stream.
+// Message starts with + and is terminated by $, line breaks between messages are skipped.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		skip := 0
+		for skip < len(data) && (data[skip] == '\r' || data[skip] == '\n') {
+			skip++
+		}
+		if atEOF && len(data) == skip {
+			return len(data), nil, nil
+		}
+		if len(data) == skip {
+			return skip, nil, nil
+		}
+
+		if data[skip] != startByte {
+			s.badData = data
+			s.err = common.ErrBadData
+			return 0, nil, s.err
+		}
+		if i := bytes.IndexByte(data[skip:], endByte); i >= 0 {
+			// We have a full $ terminated message.
+			return skip + i + 1, data[skip : skip+i+1], nil
+		}
+		// If we're at EOF, we have a final, non-terminated message.
+		if atEOF {
+			s.badData = data
+			s.err = common.ErrBadData
+			return 0, nil, s.err
+		}
+		// Request more data.
+		return skip, nil, nil
+	}
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Queclink protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Queclink protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Reader is a cursor over a binary frame.
+// It remembers the first out of bounds read, so decoders can read a whole structure and check Err once.
+type Reader struct {
+	order binary.ByteOrder
+	buf   []byte
+	off   int
+	err   error
+}
+
+// NewReader creates a new Reader over given bytes with given byte order.
+func NewReader(b []byte, order binary.ByteOrder) *Reader {
+	return &Reader{order: order, buf: b}
+}
+
+// Err returns io.ErrUnexpectedEOF if any read was out of bounds.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Len returns the number of unread bytes.
+func (r *Reader) Len() int {
+	return len(r.buf) - r.off
+}
+
+// Offset returns the number of already read bytes.
+func (r *Reader) Offset() int {
+	return r.off
+}
+
+// Bytes returns next n bytes. Returned slice shares memory with the frame.
+func (r *Reader) Bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.Len() < n {
+		r.err = io.ErrUnexpectedEOF
+		r.off = len(r.buf)
+		return nil
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// Skip skips next n bytes.
+func (r *Reader) Skip(n int) {
+	_ = r.Bytes(n)
+}
+
+// Uint8 reads one byte.
+func (r *Reader) Uint8() uint8 {
+	b := r.Bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// Uint16 reads two bytes.
+func (r *Reader) Uint16() uint16 {
+	b := r.Bytes(2) //nolint:gomnd
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint16(b)
+}
+
+// Uint24 reads three bytes.
+func (r *Reader) Uint24() uint32 {
+	b := r.Bytes(3) //nolint:gomnd
+	if b == nil {
+		return 0
+	}
+	if r.order == binary.LittleEndian {
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	}
+	return uint32(b[2]) | uint32(b[1])<<8 | uint32(b[0])<<16
+}
+
+// Uint32 reads four bytes.
+func (r *Reader) Uint32() uint32 {
+	b := r.Bytes(4) //nolint:gomnd
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint32(b)
+}
+
+// Uint64 reads eight bytes.
+func (r *Reader) Uint64() uint64 {
+	b := r.Bytes(8) //nolint:gomnd
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint64(b)
+}
+
+// Uint reads unsigned integer of given size in bytes (1, 2, 3, 4 or 8).
+func (r *Reader) Uint(size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(r.Uint8())
+	case 2: //nolint:gomnd
+		return uint64(r.Uint16())
+	case 3: //nolint:gomnd
+		return uint64(r.Uint24())
+	case 4: //nolint:gomnd
+		return uint64(r.Uint32())
+	case 8: //nolint:gomnd
+		return r.Uint64()
+	}
+	r.Skip(size)
+	return 0
+}
@@ -0,0 +1,79 @@
+package ruptela
+
+import (
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	priority = "priority"
+	event    = "event"
+	ioPrefix = "io"
+)
+
+// ioNames maps well known IO element IDs to attribute names.
+// Elements out of the table are stored as io_<ID>.
+var ioNames = map[uint16]string{
+	2:  common.DigInput + "_1",
+	3:  common.DigInput + "_2",
+	4:  common.DigInput + "_3",
+	5:  common.DigInput + "_4",
+	22: common.AnInput + "_1",
+	23: common.AnInput + "_2",
+	27: "rssi",
+	29: "power",
+	30: "battery",
+	65: common.Odometer,
+}
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Ruptela records packet.
+type Adapter struct {
+	Packet *Packet
+}
+
+// GenericPositions implements the common.Adapter interface.
+func (a Adapter) GenericPositions() []common.Position {
+	if len(a.Packet.Records) == 0 {
+		return nil
+	}
+	pos := make([]common.Position, 0, len(a.Packet.Records))
+	for _, rec := range a.Packet.Records {
+		pos = append(pos, a.convertRecordToGeneric(rec))
+	}
+	return pos
+}
+
+func (a Adapter) convertRecordToGeneric(rec Record) common.Position {
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   a.Packet.IMEI,
+		DeviceTime: rec.Timestamp,
+		Speed:      null.NewFloat(float64(rec.GPS.Speed), true),
+		Course:     null.NewFloat(rec.GPS.Angle, true),
+	}
+	p.Location.X = rec.GPS.Longitude
+	p.Location.Y = rec.GPS.Latitude
+	p.Location.Z = rec.GPS.Altitude
+	p.Location.Type = geom.DimXYZ
+	// Device reports zero coordinates and satellites when there is no GNSS fix.
+	p.Location.Valid = rec.GPS.Satellites > 0 && (rec.GPS.Longitude != 0 || rec.GPS.Latitude != 0)
+
+	p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(rec.GPS.Satellites), true))
+	p.Attributes = p.Attributes.AppendNullFloat(common.HDOP, null.NewFloat(rec.GPS.HDOP, true))
+	p.Attributes = p.Attributes.AppendNullInt(priority, null.NewInt(int64(rec.Priority), true))
+	p.Attributes = p.Attributes.AppendNullInt(event, null.NewInt(int64(rec.EventID), rec.EventID != 0))
+	for _, io := range rec.IO {
+		name, ok := ioNames[io.ID]
+		if !ok {
+			name = fmt.Sprintf("%s_%d", ioPrefix, io.ID)
+		}
+		p.Attributes = p.Attributes.AppendNullInt(name, null.NewInt(int64(io.Value), true))
+	}
+	return p
+}
@@ -0,0 +1,164 @@
+package ruptela
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/sigurn/crc16"
+)
+
+// Command is a Ruptela packet command identifier.
+type Command uint8
+
+const (
+	CmdRecords         Command = 1
+	CmdExtendedRecords Command = 68
+	CmdRecordsResponse Command = 100
+)
+
+const (
+	coordPrecision  = 10000000
+	recordsAccepted = 0x01
+)
+
+var (
+	// ErrCRC is returned when packet checksum mismatches.
+	ErrCRC = errors.New("crc mismatch")
+	// ErrUnsupportedCommand is returned when packet carries command that is not supported.
+	ErrUnsupportedCommand = errors.New("unsupported command")
+)
+
+var crcTable = crc16.MakeTable(crc16.CRC16_KERMIT)
+
+// CRC16 calculates the CRC-16/KERMIT checksum of the data.
+func CRC16(data []byte) uint16 {
+	return crc16.Checksum(data, crcTable)
+}
+
+// GPSElement is a location part of record.
+type GPSElement struct {
+	Longitude float64
+	Latitude  float64
+	// Altitude is in meters.
+	Altitude float64
+	// Angle is in degrees.
+	Angle      float64
+	Satellites uint8
+	// Speed is in km/h.
+	Speed uint16
+	HDOP  float64
+}
+
+// IOElement is a single IO property of record.
+type IOElement struct {
+	ID    uint16
+	Size  int
+	Value uint64
+}
+
+// Record is a single data record.
+type Record struct {
+	Timestamp time.Time
+	Priority  uint8
+	GPS       GPSElement
+	// EventID is an IO element ID that triggered the record.
+	EventID uint16
+	IO      []IOElement
+}
+
+// Packet is a Ruptela packet: IMEI, command and records for the records commands.
+type Packet struct {
+	IMEI    string
+	Command Command
+	// RecordsLeft signals that device has more records in its memory.
+	RecordsLeft bool
+	Records     []Record
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+// IMEI and command are decoded even if command is not supported.
+func (p *Packet) Decode(b []byte) error {
+	r := gen.NewReader(b, binary.BigEndian)
+	data := r.Bytes(int(r.Uint16()))
+	crc := r.Uint16()
+	if r.Err() != nil {
+		return fmt.Errorf("read packet: %w", r.Err())
+	}
+	if got := CRC16(data); got != crc {
+		return fmt.Errorf("%w: got %04x, want %04x", ErrCRC, got, crc)
+	}
+
+	r = gen.NewReader(data, binary.BigEndian)
+	p.IMEI = strconv.FormatUint(r.Uint64(), 10)
+	p.Command = Command(r.Uint8())
+	if r.Err() != nil {
+		return fmt.Errorf("read imei: %w", r.Err())
+	}
+	switch p.Command {
+	case CmdRecords, CmdExtendedRecords:
+		return p.decodeRecords(r)
+	}
+	return fmt.Errorf("%w: %d", ErrUnsupportedCommand, p.Command)
+}
+
+// Response returns the reply that shall be sent to the device, records are acknowledged by positive response.
+func (p *Packet) Response() []byte {
+	switch p.Command {
+	case CmdRecords, CmdExtendedRecords:
+		return encode([]byte{byte(CmdRecordsResponse), recordsAccepted})
+	}
+	return nil
+}
+
+// encode frames data by length and CRC.
+func encode(data []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(data)))
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint16(b, CRC16(data))
+}
+
+func (p *Packet) decodeRecords(r *gen.Reader) error {
+	p.RecordsLeft = r.Uint8() != 0
+	n := int(r.Uint8())
+	p.Records = make([]Record, 0, n)
+	for i := 0; i < n; i++ {
+		rec := p.decodeRecord(r)
+		if r.Err() != nil {
+			return fmt.Errorf("read record #%d: %w", i, r.Err())
+		}
+		p.Records = append(p.Records, rec)
+	}
+	return nil
+}
+
+func (p *Packet) decodeRecord(r *gen.Reader) (rec Record) {
+	rec.Timestamp = time.Unix(int64(r.Uint32()), 0).UTC()
+	r.Skip(1) // timestamp extension orders records of the same second.
+	// Extended records use two bytes for event and IO IDs and have record extension byte.
+	idSize := 1
+	if p.Command == CmdExtendedRecords {
+		idSize = 2
+		r.Skip(1)
+	}
+	rec.Priority = r.Uint8()
+	rec.GPS.Longitude = float64(int32(r.Uint32())) / coordPrecision
+	rec.GPS.Latitude = float64(int32(r.Uint32())) / coordPrecision
+	rec.GPS.Altitude = float64(r.Uint16()) / 10
+	rec.GPS.Angle = float64(r.Uint16()) / 100
+	rec.GPS.Satellites = r.Uint8()
+	rec.GPS.Speed = r.Uint16()
+	rec.GPS.HDOP = float64(r.Uint8()) / 10
+
+	rec.EventID = uint16(r.Uint(idSize))
+	for _, size := range []int{1, 2, 4, 8} {
+		cnt := int(r.Uint8())
+		for j := 0; j < cnt && r.Err() == nil; j++ {
+			rec.IO = append(rec.IO, IOElement{ID: uint16(r.Uint(idSize)), Size: size, Value: r.Uint(size)})
+		}
+	}
+	return rec
+}
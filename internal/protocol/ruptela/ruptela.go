@@ -0,0 +1,70 @@
+package ruptela
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "ruptela"
+)
+
+var (
+	_ tcp.Protocol     = (*Ruptela)(nil)
+	_ tcp.ReplyChecker = (*Ruptela)(nil)
+)
+
+// Ruptela is a Ruptela protocol struct.
+type Ruptela struct {
+}
+
+// NewRuptela creates a new Ruptela struct instance.
+func NewRuptela() *Ruptela {
+	return &Ruptela{}
+}
+
+// Name returns the name of the Ruptela protocol.
+func (r *Ruptela) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Ruptela protocol.
+func (r *Ruptela) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// ExpectReply reports whether server replies to the frame, only records commands are acknowledged.
+func (r *Ruptela) ExpectReply(frame []byte) bool {
+	if len(frame) <= lengthLen+imeiLen {
+		return false
+	}
+	cmd := Command(frame[lengthLen+imeiLen])
+	return cmd == CmdRecords || cmd == CmdExtendedRecords
+}
+
+// Respond returns the result of parsing the Ruptela data.
+// Every packet carries IMEI, so there is no separate login.
+// Packet with wrong CRC is not acknowledged, so device will resend it.
+func (r *Ruptela) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	if errors.Is(err, ErrCRC) {
+		return res, err
+	}
+	if pkg.IMEI != "" {
+		s.SetDevice(pkg.IMEI)
+	}
+	if errors.Is(err, ErrUnsupportedCommand) {
+		return res, nil
+	}
+	if err != nil {
+		return res, fmt.Errorf("decode packet: %w", err)
+	}
+	res.Response = pkg.Response()
+	res.GenericAdapter = Adapter{Packet: &pkg}
+	return res, nil
+}
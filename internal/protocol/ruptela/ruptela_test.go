@@ -0,0 +1,150 @@
+package ruptela
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Frames of device 13226005504143, each of records frames has two records made at 2023-04-01 10:00:00
+// at 55.752220 37.615560 150m, course 180, speed 36 km/h, 9 satellites, hdop 0.9, event 5,
+// IO elements: 2 = 1, 200 (401 for extended) = 7, 29 = 12500, 65 = 123456.
+const (
+	recordsFrame         = "005900000c076b5c208f010002642800a00000166badd0213b1d1805dc46500900240905020201c807011d30d401410001e24000642800a00000166badd0213b1d1805dc46500900240905020201c807011d30d401410001e24000db03"
+	extendedRecordsFrame = "006500000c076b5c208f440002642800a0000000166badd0213b1d1805dc46500900240900050200020101910701001d30d40100410001e24000642800a0000000166badd0213b1d1805dc46500900240900050200020101910701001d30d40100410001e240000bfa"
+	identificationFrame  = "000d00000c076b5c208f0f00010203f1d5"
+	recordsResponse      = "0002640113bc"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "records", stream: recordsFrame, wantCount: 1},
+		{name: "stream", stream: identificationFrame + recordsFrame + extendedRecordsFrame, wantCount: 3},
+		{name: "truncated", stream: recordsFrame[:40], wantErr: common.ErrBadData},
+		{name: "too short", stream: "000200", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(mustHex(t, tt.stream)))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	tests := []struct {
+		name         string
+		frame        string
+		wantCommand  Command
+		wantRecords  int
+		wantIO       []IOElement
+		wantResponse string
+		wantErr      error
+	}{
+		{
+			name:        "records",
+			frame:       recordsFrame,
+			wantCommand: CmdRecords,
+			wantRecords: 2,
+			wantIO: []IOElement{
+				{ID: 2, Size: 1, Value: 1}, {ID: 200, Size: 1, Value: 7},
+				{ID: 29, Size: 2, Value: 12500}, {ID: 65, Size: 4, Value: 123456},
+			},
+			wantResponse: recordsResponse,
+		},
+		{
+			name:        "extended records",
+			frame:       extendedRecordsFrame,
+			wantCommand: CmdExtendedRecords,
+			wantRecords: 2,
+			wantIO: []IOElement{
+				{ID: 2, Size: 1, Value: 1}, {ID: 401, Size: 1, Value: 7},
+				{ID: 29, Size: 2, Value: 12500}, {ID: 65, Size: 4, Value: 123456},
+			},
+			wantResponse: recordsResponse,
+		},
+		{name: "identification", frame: identificationFrame, wantCommand: 15, wantErr: ErrUnsupportedCommand},
+		{name: "bad crc", frame: recordsFrame[:len(recordsFrame)-4] + "0000", wantErr: ErrCRC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.Decode(mustHex(t, tt.frame))
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == ErrCRC {
+				return
+			}
+			assert.Equal(t, "13226005504143", p.IMEI)
+			assert.Equal(t, tt.wantCommand, p.Command)
+			require.Len(t, p.Records, tt.wantRecords)
+			if tt.wantErr != nil {
+				assert.Nil(t, p.Response())
+				return
+			}
+			rec := p.Records[0]
+			assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), rec.Timestamp)
+			assert.InDelta(t, 55.752220, rec.GPS.Latitude, 1e-9)
+			assert.InDelta(t, 37.615560, rec.GPS.Longitude, 1e-9)
+			assert.InDelta(t, 150, rec.GPS.Altitude, 1e-9)
+			assert.InDelta(t, 180, rec.GPS.Angle, 1e-9)
+			assert.InDelta(t, 0.9, rec.GPS.HDOP, 1e-9)
+			assert.Equal(t, uint16(36), rec.GPS.Speed)
+			assert.Equal(t, uint8(9), rec.GPS.Satellites)
+			assert.Equal(t, uint16(5), rec.EventID)
+			assert.Equal(t, tt.wantIO, rec.IO)
+			assert.Equal(t, mustHex(t, tt.wantResponse), p.Response())
+		})
+	}
+}
+
+func TestRuptela_Respond(t *testing.T) {
+	r := NewRuptela()
+	s := internal.NewSession()
+
+	res, err := r.Respond(s, mustHex(t, identificationFrame))
+	require.NoError(t, err)
+	assert.Nil(t, res.Response)
+	assert.Nil(t, res.GenericAdapter)
+	assert.Equal(t, "13226005504143", s.Device())
+	assert.False(t, r.ExpectReply(mustHex(t, identificationFrame)))
+
+	res, err = r.Respond(s, mustHex(t, recordsFrame))
+	require.NoError(t, err)
+	assert.True(t, r.ExpectReply(mustHex(t, recordsFrame)))
+	assert.Equal(t, mustHex(t, recordsResponse), res.Response)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 2)
+	assert.Equal(t, "13226005504143", pos[0].DeviceID)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 36, pos[0].Speed.Float64, 1e-9)
+	assert.Equal(t, int64(12500), pos[0].Attributes["power"])
+	assert.Equal(t, int64(123456), pos[0].Attributes[common.Odometer])
+	assert.Equal(t, int64(7), pos[0].Attributes["io_200"])
+}
@@ -0,0 +1,82 @@
+package ruptela
+
+import (
+	"bufio"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	lengthLen  = 2
+	crcLen     = 2
+	imeiLen    = 8
+	minDataLen = imeiLen + 1
+	maxDataLen = bufio.MaxScanTokenSize - lengthLen - crcLen
+)
+
+// Splitter implements common.FrameSplitter contract to extract Ruptela packet from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for Ruptela protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Ruptela packet from incoming bytes stream.
+// Packet starts with two bytes of data length followed by data (IMEI, command and payload)
+// and ends with two bytes of CRC.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if len(data) < lengthLen {
+			return s.more(data, atEOF)
+		}
+		dataLen := int(binary.BigEndian.Uint16(data[0:2]))
+		if dataLen < minDataLen || dataLen > maxDataLen {
+			return s.bad(data)
+		}
+
+		pkgLen := lengthLen + dataLen + crcLen
+		if len(data) < pkgLen {
+			return s.more(data, atEOF)
+		}
+
+		// Finally got all data, return it.
+		return pkgLen, data[0:pkgLen], nil
+	}
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Ruptela protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Ruptela protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
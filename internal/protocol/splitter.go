@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"bufio"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*ChunkSplitter)(nil)
+
+// ChunkSplitter implements common.FrameSplitter contract that returns whatever bytes are available as a frame.
+// It suits to read replies of protocols where replies have no framing of their own (a bare counter or a flag).
+type ChunkSplitter struct{}
+
+// NewChunkSplitter creates a new ChunkSplitter instance.
+func NewChunkSplitter() *ChunkSplitter {
+	return &ChunkSplitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract returning all buffered bytes at once.
+func (s *ChunkSplitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if len(data) == 0 {
+			return 0, nil, nil
+		}
+		return len(data), data, nil
+	}
+}
+
+// Error always returns nil as any data is acceptable.
+func (s *ChunkSplitter) Error() error {
+	return nil
+}
+
+// BadData always returns nil as any data is acceptable.
+func (s *ChunkSplitter) BadData() []byte {
+	return nil
+}
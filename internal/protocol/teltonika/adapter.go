@@ -0,0 +1,99 @@
+package teltonika
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	priority   = "priority"
+	event      = "event"
+	generation = "generation"
+	ioPrefix   = "io"
+)
+
+// ioNames maps well known FMB IO element IDs to attribute names.
+// Elements out of the table are stored as io_<ID>.
+var ioNames = map[uint16]string{
+	1:   common.DigInput + "_1",
+	2:   common.DigInput + "_2",
+	3:   common.DigInput + "_3",
+	9:   common.AnInput + "_1",
+	10:  common.AnInput + "_2",
+	16:  common.Odometer,
+	21:  "rssi",
+	66:  "power",
+	67:  "battery",
+	69:  "gnss_status",
+	179: common.DigOutput + "_1",
+	180: common.DigOutput + "_2",
+	181: common.PDOP,
+	182: common.HDOP,
+	239: "ignition",
+	240: common.Move,
+}
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the Teltonika AVL data packet.
+type Adapter struct {
+	Packet *Packet
+	IMEI   string
+}
+
+// GenericPositions implements the common.Adapter interface.
+func (a Adapter) GenericPositions() []common.Position {
+	if a.Packet.Type != DataPacket || len(a.Packet.Records) == 0 {
+		return nil
+	}
+	pos := make([]common.Position, 0, len(a.Packet.Records))
+	for _, rec := range a.Packet.Records {
+		pos = append(pos, a.convertRecordToGeneric(rec))
+	}
+	return pos
+}
+
+func (a Adapter) convertRecordToGeneric(rec Record) common.Position {
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   a.IMEI,
+		DeviceTime: rec.Timestamp,
+		Speed:      null.NewFloat(float64(rec.GPS.Speed), true),
+		Course:     null.NewFloat(float64(rec.GPS.Angle), true),
+	}
+	p.Location.X = rec.GPS.Longitude
+	p.Location.Y = rec.GPS.Latitude
+	p.Location.Z = float64(rec.GPS.Altitude)
+	p.Location.Type = geom.DimXYZ
+	// Device reports zero coordinates and satellites when there is no GNSS fix.
+	p.Location.Valid = rec.GPS.Satellites > 0 && (rec.GPS.Longitude != 0 || rec.GPS.Latitude != 0)
+
+	p.Attributes = p.Attributes.AppendNullInt(common.Satellites, null.NewInt(int64(rec.GPS.Satellites), true))
+	p.Attributes = p.Attributes.AppendNullInt(priority, null.NewInt(int64(rec.Priority), true))
+	p.Attributes = p.Attributes.AppendNullInt(event, null.NewInt(int64(rec.EventID), rec.EventID != 0))
+	p.Attributes = p.Attributes.AppendNullInt(
+		generation,
+		null.NewInt(int64(rec.GenerationType), a.Packet.Codec == Codec16),
+	)
+	for _, io := range rec.IO {
+		a.copyIOElement(&p, io)
+	}
+	return p
+}
+
+func (a Adapter) copyIOElement(p *common.Position, io IOElement) {
+	name, ok := ioNames[io.ID]
+	if !ok {
+		name = fmt.Sprintf("%s_%d", ioPrefix, io.ID)
+	}
+	if io.Bytes != nil {
+		p.Attributes = p.Attributes.AppendNullString(name, null.NewString(hex.EncodeToString(io.Bytes), true))
+		return
+	}
+	p.Attributes = p.Attributes.AppendNullInt(name, null.NewInt(int64(io.Value), true))
+}
@@ -0,0 +1,257 @@
+package teltonika
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/sigurn/crc16"
+)
+
+// PacketType is a type of Teltonika packet.
+type PacketType int
+
+const (
+	UnknownPacket PacketType = iota
+	LoginPacket
+	PingPacket
+	DataPacket
+)
+
+// Codec is a Teltonika AVL data codec identifier.
+type Codec uint8
+
+const (
+	Codec8  Codec = 0x08
+	Codec8E Codec = 0x8E
+	Codec16 Codec = 0x10
+)
+
+const (
+	coordPrecision = 10000000
+	imeiAccepted   = 0x01
+	imeiRejected   = 0x00
+	// udpAckLen is the length of UDP acknowledgement after its length field.
+	udpAckLen = 5
+	// udpNotUsable is the byte following packet ID of UDP datagram and its acknowledgement.
+	udpNotUsable = 0x01
+)
+
+var (
+	// ErrCRC is returned when AVL data packet checksum mismatches.
+	ErrCRC = errors.New("crc mismatch")
+	// ErrUnsupportedCodec is returned when AVL data packet is encoded by unknown codec.
+	ErrUnsupportedCodec = errors.New("unsupported codec")
+	// ErrRecordsCount is returned when number of data fields are not equal to each other.
+	ErrRecordsCount = errors.New("records count mismatch")
+)
+
+var crcTable = crc16.MakeTable(crc16.CRC16_ARC)
+
+// CRC16 calculates the CRC-16/IBM checksum of the data.
+func CRC16(data []byte) uint16 {
+	return crc16.Checksum(data, crcTable)
+}
+
+// GPSElement is a location part of AVL record.
+type GPSElement struct {
+	Longitude  float64
+	Latitude   float64
+	Altitude   int16
+	Angle      uint16
+	Satellites uint8
+	Speed      uint16
+}
+
+// IOElement is a single IO property of AVL record.
+// Fixed size values are kept in Value, variable size values (codec 8 extended NX) are kept in Bytes.
+type IOElement struct {
+	ID    uint16
+	Size  int
+	Value uint64
+	Bytes []byte
+}
+
+// Record is a single AVL data record.
+type Record struct {
+	Timestamp time.Time
+	Priority  uint8
+	GPS       GPSElement
+	// EventID is an IO element ID that triggered the record, 0 if record is periodical.
+	EventID uint16
+	// GenerationType is a record generation cause, presented only in codec 16.
+	GenerationType uint8
+	IO             []IOElement
+}
+
+// Packet is a Teltonika packet: either IMEI handshake, keep alive ping or AVL data.
+type Packet struct {
+	Type    PacketType
+	IMEI    string
+	Codec   Codec
+	Records []Record
+	// PacketID and AVLPacketID identify UDP datagram, they are echoed in its acknowledgement.
+	PacketID    uint16
+	AVLPacketID uint8
+}
+
+// Decode decodes bytes frame extracted by Splitter.
+func (p *Packet) Decode(b []byte) error {
+	switch {
+	case len(b) == 1 && b[0] == pingByte:
+		p.Type = PingPacket
+		return nil
+	case len(b) >= avlHeaderLen && binary.BigEndian.Uint32(b[0:4]) == 0:
+		p.Type = DataPacket
+		return p.decodeData(b)
+	case len(b) > imeiHeaderLen:
+		p.Type = LoginPacket
+		return p.decodeIMEI(b)
+	}
+	p.Type = UnknownPacket
+	return fmt.Errorf("unknown packet: %x", b)
+}
+
+// Response returns the reply that shall be sent to the device.
+// Handshake is acknowledged by 0x01, AVL data is acknowledged by the number of accepted records.
+func (p *Packet) Response() []byte {
+	switch p.Type {
+	case LoginPacket:
+		if p.IMEI == "" {
+			return []byte{imeiRejected}
+		}
+		return []byte{imeiAccepted}
+	case DataPacket:
+		return binary.BigEndian.AppendUint32(nil, uint32(len(p.Records)))
+	}
+	return nil
+}
+
+// DecodeUDP decodes UDP datagram extracted by UDPSplitter: two bytes length, packet ID, not usable byte,
+// AVL packet ID, IMEI prefixed with two bytes length and AVL data without preamble and CRC.
+func (p *Packet) DecodeUDP(b []byte) error {
+	p.Type = DataPacket
+	r := gen.NewReader(b, binary.BigEndian)
+	r = gen.NewReader(r.Bytes(int(r.Uint16())), binary.BigEndian)
+	p.PacketID = r.Uint16()
+	r.Skip(1)
+	p.AVLPacketID = r.Uint8()
+	imei := r.Bytes(int(r.Uint16()))
+	if r.Err() != nil {
+		return fmt.Errorf("read udp header: %w", r.Err())
+	}
+	if err := p.setIMEI(imei); err != nil {
+		return err
+	}
+	return p.decodeAVL(r.Bytes(r.Len()))
+}
+
+// UDPResponse returns the acknowledgement of UDP datagram with the number of accepted records.
+func (p *Packet) UDPResponse(accepted int) []byte {
+	b := binary.BigEndian.AppendUint16(nil, udpAckLen)
+	b = binary.BigEndian.AppendUint16(b, p.PacketID)
+	return append(b, udpNotUsable, p.AVLPacketID, uint8(accepted))
+}
+
+func (p *Packet) decodeIMEI(b []byte) error {
+	r := gen.NewReader(b, binary.BigEndian)
+	imei := r.Bytes(int(r.Uint16()))
+	if r.Err() != nil {
+		return fmt.Errorf("read imei: %w", r.Err())
+	}
+	return p.setIMEI(imei)
+}
+
+func (p *Packet) setIMEI(imei []byte) error {
+	for _, c := range imei {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("imei is not numeric: %q", imei)
+		}
+	}
+	p.IMEI = string(imei)
+	return nil
+}
+
+func (p *Packet) decodeData(b []byte) error {
+	r := gen.NewReader(b, binary.BigEndian)
+	r.Skip(4) //nolint:gomnd // preamble
+	data := r.Bytes(int(r.Uint32()))
+	crc := r.Uint32()
+	if r.Err() != nil {
+		return fmt.Errorf("read avl data: %w", r.Err())
+	}
+	if got := uint32(CRC16(data)); got != crc {
+		return fmt.Errorf("%w: got %04x, want %04x", ErrCRC, got, crc)
+	}
+	return p.decodeAVL(data)
+}
+
+// decodeAVL decodes AVL data: codec, number of records, records and number of records again.
+func (p *Packet) decodeAVL(data []byte) error {
+	r := gen.NewReader(data, binary.BigEndian)
+	p.Codec = Codec(r.Uint8())
+	switch p.Codec {
+	case Codec8, Codec8E, Codec16:
+	default:
+		return fmt.Errorf("%w: %#x", ErrUnsupportedCodec, uint8(p.Codec))
+	}
+
+	n := int(r.Uint8())
+	p.Records = make([]Record, 0, n)
+	for i := 0; i < n; i++ {
+		rec := p.decodeRecord(r)
+		if r.Err() != nil {
+			return fmt.Errorf("read record #%d: %w", i, r.Err())
+		}
+		p.Records = append(p.Records, rec)
+	}
+	if m := int(r.Uint8()); m != n || r.Err() != nil {
+		return fmt.Errorf("%w: %d != %d", ErrRecordsCount, n, m)
+	}
+	return nil
+}
+
+func (p *Packet) decodeRecord(r *gen.Reader) (rec Record) {
+	rec.Timestamp = time.UnixMilli(int64(r.Uint64())).UTC()
+	rec.Priority = r.Uint8()
+	rec.GPS.Longitude = float64(int32(r.Uint32())) / coordPrecision
+	rec.GPS.Latitude = float64(int32(r.Uint32())) / coordPrecision
+	rec.GPS.Altitude = int16(r.Uint16())
+	rec.GPS.Angle = r.Uint16()
+	rec.GPS.Satellites = r.Uint8()
+	rec.GPS.Speed = r.Uint16()
+
+	// Codec 8 uses one byte for IO IDs and counters, codec 8 extended uses two bytes for both,
+	// codec 16 uses two bytes for IO IDs and one byte for counters.
+	idSize, cntSize := 1, 1
+	switch p.Codec {
+	case Codec8E:
+		idSize, cntSize = 2, 2
+	case Codec16:
+		idSize = 2
+	}
+
+	rec.EventID = uint16(r.Uint(idSize))
+	if p.Codec == Codec16 {
+		rec.GenerationType = r.Uint8()
+	}
+	total := int(r.Uint(cntSize))
+	rec.IO = make([]IOElement, 0, total)
+	for _, size := range []int{1, 2, 4, 8} {
+		cnt := int(r.Uint(cntSize))
+		for j := 0; j < cnt && r.Err() == nil; j++ {
+			rec.IO = append(rec.IO, IOElement{ID: uint16(r.Uint(idSize)), Size: size, Value: r.Uint(size)})
+		}
+	}
+	if p.Codec == Codec8E {
+		cnt := int(r.Uint16())
+		for j := 0; j < cnt && r.Err() == nil; j++ {
+			id := r.Uint16()
+			b := append([]byte(nil), r.Bytes(int(r.Uint16()))...)
+			rec.IO = append(rec.IO, IOElement{ID: id, Size: len(b), Bytes: b})
+		}
+	}
+	return rec
+}
@@ -0,0 +1,134 @@
+package teltonika
+
+import (
+	"bufio"
+	"encoding/binary"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+const (
+	imeiHeaderLen = 2
+	avlHeaderLen  = 8
+	crcLen        = 4
+	maxIMEILen    = 17
+	maxAVLLen     = bufio.MaxScanTokenSize - avlHeaderLen - crcLen
+	pingByte      = 0xFF
+	udpLenSize    = 2
+	// udpHeaderLen is the size of UDP datagram header: length, packet ID, not usable byte,
+	// AVL packet ID and IMEI length.
+	udpHeaderLen = 8
+)
+
+// Splitter implements common.FrameSplitter contract to extract Teltonika IMEI handshake and AVL data packets
+// from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+	// udp is set to extract UDP datagrams.
+	udp bool
+}
+
+// NewSplitter creates a new Splitter instance for Teltonika protocol.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// NewUDPSplitter creates a new Splitter instance for Teltonika protocol over UDP.
+func NewUDPSplitter() *Splitter {
+	return &Splitter{udp: true}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract Teltonika packet from incoming bytes stream.
+// IMEI handshake is prefixed with two bytes length, AVL data packet starts with four zero bytes preamble
+// followed by four bytes of data length and four bytes of CRC at the end.
+// Single 0xFF byte is a keep alive ping. UDP datagram is prefixed with two bytes length.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if s.udp {
+			return s.datagram(data, atEOF)
+		}
+
+		if data[0] == pingByte {
+			return 1, data[:1], nil
+		}
+
+		if len(data) < imeiHeaderLen {
+			return s.more(data, atEOF)
+		}
+
+		var pkgLen int
+		if data[0] == 0 && data[1] == 0 {
+			if len(data) < avlHeaderLen {
+				return s.more(data, atEOF)
+			}
+			if binary.BigEndian.Uint16(data[2:4]) != 0 {
+				return s.bad(data)
+			}
+			dataLen := binary.BigEndian.Uint32(data[4:8])
+			if dataLen == 0 || dataLen > maxAVLLen {
+				return s.bad(data)
+			}
+			pkgLen = avlHeaderLen + int(dataLen) + crcLen
+		} else {
+			imeiLen := binary.BigEndian.Uint16(data[0:2])
+			if imeiLen > maxIMEILen {
+				return s.bad(data)
+			}
+			pkgLen = imeiHeaderLen + int(imeiLen)
+		}
+
+		if len(data) < pkgLen {
+			return s.more(data, atEOF)
+		}
+
+		// Finally got all data, return it.
+		return pkgLen, data[0:pkgLen], nil
+	}
+}
+
+// datagram extracts UDP datagram.
+func (s *Splitter) datagram(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) < udpLenSize {
+		return s.more(data, atEOF)
+	}
+	pkgLen := udpLenSize + int(binary.BigEndian.Uint16(data[0:2]))
+	if pkgLen < udpHeaderLen {
+		return s.bad(data)
+	}
+	if len(data) < pkgLen {
+		return s.more(data, atEOF)
+	}
+	return pkgLen, data[0:pkgLen], nil
+}
+
+// more requests more data or registers bad data if stream is over.
+func (s *Splitter) more(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF {
+		return s.bad(data)
+	}
+	return 0, nil, nil
+}
+
+func (s *Splitter) bad(data []byte) (int, []byte, error) {
+	s.badData = data
+	s.err = common.ErrBadData
+	return 0, nil, s.err
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to Teltonika protocol.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as Teltonika protocol.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
@@ -0,0 +1,84 @@
+package teltonika
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "teltonika"
+)
+
+var (
+	_ tcp.Protocol         = (*Teltonika)(nil)
+	_ tcp.ResponseSplitter = (*Teltonika)(nil)
+	_ tcp.Nacker           = (*Teltonika)(nil)
+)
+
+// ErrNotLoggedIn is returned when AVL data packet is received before IMEI handshake.
+var ErrNotLoggedIn = errors.New("data before imei handshake")
+
+// Teltonika is a Teltonika codec 8, 8 extended and 16 protocol struct.
+type Teltonika struct {
+}
+
+// NewTeltonika creates a new Teltonika struct instance.
+func NewTeltonika() *Teltonika {
+	return &Teltonika{}
+}
+
+// Name returns the name of the Teltonika protocol.
+func (t *Teltonika) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the Teltonika protocol.
+func (t *Teltonika) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// NewResponseSplitter returns a new instance of the split function for the Teltonika replies.
+// Replies are bare handshake flag or records counter, so they are read as is.
+func (t *Teltonika) NewResponseSplitter() common.FrameSplitter {
+	return gen.NewChunkSplitter()
+}
+
+// Nack rejects AVL data by zero number of accepted records, so device will resend it.
+func (t *Teltonika) Nack(_ *internal.Session, _ []byte) []byte {
+	return make([]byte, 4)
+}
+
+// Respond returns the result of parsing the Teltonika data.
+// AVL data with wrong CRC is not acknowledged, so device will resend it.
+func (t *Teltonika) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	err = pkg.Decode(bytes)
+	switch pkg.Type {
+	case LoginPacket:
+		res.Response = pkg.Response()
+		if err != nil {
+			res.CloseSession = true
+			return res, fmt.Errorf("handshake: %w", err)
+		}
+		s.SetDevice(pkg.IMEI)
+		return res, nil
+	case PingPacket:
+		return res, nil
+	case DataPacket:
+		if s.Device() == "" {
+			return tcp.Result{CloseSession: true}, ErrNotLoggedIn
+		}
+		if err != nil {
+			return res, fmt.Errorf("decode avl data: %w", err)
+		}
+		res.Response = pkg.Response()
+		res.GenericAdapter = Adapter{Packet: &pkg, IMEI: s.Device()}
+		return res, nil
+	}
+	return res, common.ErrBadData
+}
@@ -0,0 +1,166 @@
+package teltonika
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	imeiFrame    = "000f333536333037303432343431303133"
+	codec8Frame  = "000000000000003608010000016b40d8ea30010000000000000000000000000000000105021503010101425e0f01f10000601a014e0000000000000000010000c7cf"
+	codec8EFrame = "000000000000004a8e010000016b412cee000100000000000000000000000000000000010005000100010100010011001d00010010015e2c880002000b000000003544c87a000e000000001dd7e06a00000100002994"
+	// udpFrame is codec 8 datagram of packet ID 0xCAFE and AVL packet ID 0x05, its acknowledgement is udpAck.
+	udpFrame     = "003dcafe0105000f33353230393330383634303336353508010000016b4f815b30010000000000000000000000000000000103021503010101425dbc000001"
+	udpAck       = "0005cafe010501"
+	codec16Frame = "000000000000005f10020000016bdbc7833000000000000000000000000000000000000b05040200010000030002000b00270042563a00000000016bdbc7871800000000000000000000000000000000000b05040200010000030002000b00260042563a00000200005fb3"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "imei", stream: imeiFrame, wantCount: 1},
+		{name: "imei and data", stream: imeiFrame + codec8Frame + codec8EFrame + codec16Frame, wantCount: 4},
+		{name: "ping", stream: "ff" + codec8Frame, wantCount: 2},
+		{name: "truncated", stream: codec8Frame[:40], wantErr: common.ErrBadData},
+		{name: "bad preamble", stream: "0000000100000010", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(bytes.NewReader(mustHex(t, tt.stream)))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPacket_Decode(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       string
+		wantType    PacketType
+		wantCodec   Codec
+		wantRecords int
+		wantIO      int
+		wantResp    string
+		wantErr     error
+	}{
+		{name: "imei", frame: imeiFrame, wantType: LoginPacket, wantResp: "01"},
+		{name: "ping", frame: "ff", wantType: PingPacket},
+		{
+			name: "codec 8", frame: codec8Frame, wantType: DataPacket,
+			wantCodec: Codec8, wantRecords: 1, wantIO: 5, wantResp: "00000001",
+		},
+		{
+			name: "codec 8 extended", frame: codec8EFrame, wantType: DataPacket,
+			wantCodec: Codec8E, wantRecords: 1, wantIO: 5, wantResp: "00000001",
+		},
+		{
+			name: "codec 16", frame: codec16Frame, wantType: DataPacket,
+			wantCodec: Codec16, wantRecords: 2, wantIO: 4, wantResp: "00000002",
+		},
+		{
+			name: "bad crc", frame: codec8Frame[:len(codec8Frame)-2] + "00", wantType: DataPacket,
+			wantErr: ErrCRC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{}
+			err := p.Decode(mustHex(t, tt.frame))
+			assert.Equal(t, tt.wantType, p.Type)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCodec, p.Codec)
+			assert.Len(t, p.Records, tt.wantRecords)
+			if tt.wantRecords > 0 {
+				assert.Len(t, p.Records[0].IO, tt.wantIO)
+			}
+			assert.Equal(t, tt.wantResp, hex.EncodeToString(p.Response()))
+		})
+	}
+}
+
+func TestTeltonika_Respond(t *testing.T) {
+	tel := NewTeltonika()
+	s := internal.NewSession()
+
+	res, err := tel.Respond(s, mustHex(t, codec8Frame))
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	assert.True(t, res.CloseSession)
+
+	res, err = tel.Respond(s, mustHex(t, imeiFrame))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{imeiAccepted}, res.Response)
+	assert.Equal(t, "356307042441013", s.Device())
+
+	res, err = tel.Respond(s, mustHex(t, codec8Frame))
+	require.NoError(t, err)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "356307042441013", pos[0].DeviceID)
+	assert.Equal(t, Proto, pos[0].Protocol)
+	assert.Equal(t, time.Date(2019, 6, 10, 10, 4, 46, 0, time.UTC), pos[0].DeviceTime)
+	assert.False(t, pos[0].Valid)
+	assert.Equal(t, int64(1), pos[0].Attributes[common.DigInput+"_1"])
+	assert.Equal(t, int64(3), pos[0].Attributes["rssi"])
+	assert.Equal(t, int64(24079), pos[0].Attributes["power"])
+}
+
+func TestUDP_Respond(t *testing.T) {
+	u := NewUDP()
+	s := internal.NewSession()
+
+	// the datagram is extracted by its length.
+	scanner := bufio.NewScanner(bytes.NewReader(mustHex(t, udpFrame)))
+	splitter := u.NewFrameSplitter()
+	scanner.Split(splitter.Splitter())
+	require.True(t, scanner.Scan())
+	frame := scanner.Bytes()
+	assert.False(t, scanner.Scan())
+	require.NoError(t, splitter.Error())
+
+	res, err := u.Respond(s, frame)
+	require.NoError(t, err)
+	assert.Equal(t, udpAck, hex.EncodeToString(res.Response))
+	assert.Equal(t, "352093086403655", s.Device())
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "352093086403655", pos[0].DeviceID)
+	assert.Equal(t, time.Date(2019, 6, 13, 6, 23, 26, 0, time.UTC), pos[0].DeviceTime)
+	assert.Equal(t, int64(1), pos[0].Attributes[common.DigInput+"_1"])
+
+	assert.Equal(t, "0005cafe010500", hex.EncodeToString(u.Nack(s, frame)))
+
+	_, err = u.Respond(s, mustHex(t, udpFrame[:len(udpFrame)-2]))
+	assert.Error(t, err)
+}
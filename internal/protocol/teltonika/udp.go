@@ -0,0 +1,54 @@
+package teltonika
+
+import (
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+var (
+	_ tcp.Protocol = (*UDP)(nil)
+	_ tcp.Nacker   = (*UDP)(nil)
+)
+
+// UDP is a Teltonika protocol over UDP. Every datagram carries the IMEI with AVL data,
+// so there is no handshake, and it is acknowledged by packet IDs and the number of accepted records.
+type UDP struct {
+}
+
+// NewUDP creates a new UDP struct instance.
+func NewUDP() *UDP {
+	return &UDP{}
+}
+
+// Name returns the name of the Teltonika protocol.
+func (u *UDP) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for Teltonika datagrams.
+func (u *UDP) NewFrameSplitter() common.FrameSplitter {
+	return NewUDPSplitter()
+}
+
+// Nack acknowledges zero accepted records of the datagram, so device will resend it.
+func (u *UDP) Nack(_ *internal.Session, frame []byte) []byte {
+	pkg := Packet{}
+	_ = pkg.DecodeUDP(frame)
+	return pkg.UDPResponse(0)
+}
+
+// Respond returns the result of parsing the Teltonika datagram.
+// Datagram failed to decode is not acknowledged, so device will resend it.
+func (u *UDP) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	pkg := Packet{}
+	if err = pkg.DecodeUDP(bytes); err != nil {
+		return res, fmt.Errorf("decode udp datagram: %w", err)
+	}
+	s.SetDevice(pkg.IMEI)
+	res.Response = pkg.UDPResponse(len(pkg.Records))
+	res.GenericAdapter = Adapter{Packet: &pkg, IMEI: pkg.IMEI}
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package tk103
+
+import (
+	gen "github.com/gotrackery/gotrackery/internal/protocol"
+	"github.com/gotrackery/protocol/common"
+	"github.com/peterstace/simplefeatures/geom"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	status  = "status"
+	alarm   = "alarm"
+	rssi    = "rssi"
+	battery = "battery"
+	command = "command"
+	dialect = "dialect"
+)
+
+var _ gen.Adapter = (*Adapter)(nil)
+
+// Adapter is a common adapter for the TK103/H02 message.
+type Adapter struct {
+	Message *Message
+	// DeviceID is the device the session is bound to.
+	DeviceID string
+}
+
+// GenericPositions implements the common.Adapter interface.
+// Messages without location are not converted.
+func (a Adapter) GenericPositions() []common.Position {
+	fix := a.Message.Fix
+	if fix == nil {
+		return nil
+	}
+	p := common.Position{
+		Protocol:   Proto,
+		DeviceID:   a.DeviceID,
+		DeviceTime: fix.Time,
+		Speed:      null.NewFloat(fix.Speed, true),
+		Course:     null.NewFloat(fix.Course, true),
+	}
+	p.Location.X = fix.Longitude
+	p.Location.Y = fix.Latitude
+	p.Location.Type = geom.DimXY
+	p.Location.Valid = fix.Valid
+
+	p.Attributes = p.Attributes.AppendNullString(dialect, null.NewString(a.Message.Dialect, true))
+	p.Attributes = p.Attributes.AppendNullString(command, null.NewString(a.Message.Command, true))
+	for name, v := range a.Message.Attributes {
+		p.Attributes = p.Attributes.AppendNullInt(name, null.NewInt(v, true))
+	}
+	return []common.Position{p}
+}
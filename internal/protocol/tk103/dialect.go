@@ -0,0 +1,84 @@
+package tk103
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+const knot = 1.852
+
+// ErrMalformed is returned when message doesn't match the dialect format.
+var ErrMalformed = errors.New("malformed message")
+
+// Dialect is a parser of the one family of messages.
+// Implement it to support the new family and pass it to NewTK103 by WithDialects option.
+type Dialect interface {
+	// Name returns the name of the dialect.
+	Name() string
+	// Match reports whether the message belongs to the dialect.
+	Match(msg []byte) bool
+	// Parse parses the message.
+	Parse(msg []byte) (Message, error)
+}
+
+// Fix is a navigation state reported by message.
+type Fix struct {
+	Time  time.Time
+	Valid bool
+	// Latitude and Longitude are in degrees, south and west are negative.
+	Latitude  float64
+	Longitude float64
+	// Speed is in km/h.
+	Speed float64
+	// Course is in degrees.
+	Course float64
+}
+
+// Message is a parsed message of any dialect.
+type Message struct {
+	Dialect string
+	// Command is a message type as it is named by dialect: V1, BP05 and so on.
+	Command  string
+	DeviceID string
+	// Login signals that DeviceID is a device identifier the session shall be bound to.
+	Login bool
+	// Fix is presented for messages with location only.
+	Fix        *Fix
+	Attributes map[string]int64
+	// Response is the reply the dialect requires, nil if message is not replied.
+	Response []byte
+}
+
+// parseCoordinate converts DDMM.MMMM (DDDMM.MMMM for longitude) and hemisphere into degrees.
+func parseCoordinate(value, hemisphere string) (float64, error) {
+	c, err := common.ParseCardinalAxis(hemisphere)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	a, err := common.ParseAxisWGS84(value, c)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return a.Float64(), nil
+}
+
+// parseTime parses date and time of given layouts in UTC.
+func parseTime(layout, value string) (time.Time, error) {
+	t, err := time.ParseInLocation(layout, value, time.UTC)
+	if err != nil {
+		return t, fmt.Errorf("%w: time %q", ErrMalformed, value)
+	}
+	return t, nil
+}
+
+func parseFloat(name, value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q", ErrMalformed, name, value)
+	}
+	return v, nil
+}
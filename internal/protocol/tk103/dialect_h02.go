@@ -0,0 +1,95 @@
+package tk103
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	h02Name     = "h02"
+	h02Location = "V1"
+	h02Link     = "LINK"
+)
+
+var _ Dialect = H02Dialect{}
+
+// H02Dialect is a dialect of *HQ,IMEI,command,...# messages.
+// Messages are not replied, every message carries device IMEI.
+type H02Dialect struct{}
+
+// Name returns the name of the dialect.
+func (H02Dialect) Name() string {
+	return h02Name
+}
+
+// Match reports whether the message is H02 message.
+func (H02Dialect) Match(msg []byte) bool {
+	return bytes.HasPrefix(msg, []byte("*")) && bytes.HasSuffix(msg, []byte("#"))
+}
+
+// Parse parses H02 message, location V1 and heartbeat LINK messages are decoded,
+// other commands are returned without data.
+func (H02Dialect) Parse(msg []byte) (m Message, err error) {
+	f := strings.Split(string(msg[1:len(msg)-1]), ",")
+	if len(f) < 3 { //nolint:gomnd
+		return m, fmt.Errorf("%w: %q", ErrMalformed, msg)
+	}
+	m = Message{Dialect: h02Name, DeviceID: f[1], Command: f[2], Login: true}
+	switch m.Command {
+	case h02Location:
+		err = m.parseH02Location(f)
+	case h02Link:
+		err = m.parseH02Link(f)
+	}
+	return m, err
+}
+
+// parseH02Location parses HQ,IMEI,V1,hhmmss,A,DDMM.MMMM,N,DDDMM.MMMM,E,speed,course,ddmmyy[,status,...].
+func (m *Message) parseH02Location(f []string) error {
+	if len(f) < 12 { //nolint:gomnd
+		return fmt.Errorf("%w: %d fields of location", ErrMalformed, len(f))
+	}
+	fix := &Fix{Valid: f[4] == "A"}
+	var err error
+	if fix.Time, err = parseTime("020106150405", f[11]+f[3]); err != nil {
+		return err
+	}
+	if fix.Latitude, err = parseCoordinate(f[5], f[6]); err != nil {
+		return err
+	}
+	if fix.Longitude, err = parseCoordinate(f[7], f[8]); err != nil {
+		return err
+	}
+	if fix.Speed, err = parseFloat("speed", f[9]); err != nil {
+		return err
+	}
+	fix.Speed *= knot
+	if fix.Course, err = parseFloat("course", f[10]); err != nil {
+		return err
+	}
+	m.Fix = fix
+	if len(f) > 12 { //nolint:gomnd
+		if st, err := strconv.ParseUint(f[12], 16, 32); err == nil {
+			m.Attributes = map[string]int64{status: int64(st)}
+		}
+	}
+	return nil
+}
+
+// parseH02Link parses HQ,IMEI,LINK,hhmmss,rssi,satellites,battery,steps,roll,ddmmyy.
+func (m *Message) parseH02Link(f []string) error {
+	if len(f) < 7 { //nolint:gomnd
+		return fmt.Errorf("%w: %d fields of link", ErrMalformed, len(f))
+	}
+	m.Attributes = make(map[string]int64)
+	for name, i := range map[string]int{rssi: 4, common.Satellites: 5, battery: 6} {
+		if v, err := strconv.ParseInt(f[i], 10, 64); err == nil {
+			m.Attributes[name] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package tk103
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	tk103Name      = "tk103"
+	tk103IDLen     = 12
+	tk103CmdLen    = 4
+	tk103IMEILen   = 15
+	tk103LocLen    = 53
+	tk103Handshake = "BP00"
+	tk103Login     = "BP05"
+	tk103Location  = "BR00"
+	tk103Alarm     = "BO01"
+)
+
+var _ Dialect = TK103Dialect{}
+
+// TK103Dialect is a dialect of (<12 digits ID><command><data>) messages.
+// Handshake, login and alarm messages are replied, other messages are identified by the ID only.
+type TK103Dialect struct{}
+
+// Name returns the name of the dialect.
+func (TK103Dialect) Name() string {
+	return tk103Name
+}
+
+// Match reports whether the message is TK103 message.
+func (TK103Dialect) Match(msg []byte) bool {
+	return bytes.HasPrefix(msg, []byte("(")) && bytes.HasSuffix(msg, []byte(")")) &&
+		len(msg) >= 2+tk103IDLen+tk103CmdLen
+}
+
+// Parse parses TK103 message.
+func (TK103Dialect) Parse(msg []byte) (m Message, err error) {
+	if len(msg) < 2+tk103IDLen+tk103CmdLen {
+		return m, fmt.Errorf("%w: %q", ErrMalformed, msg)
+	}
+	body := string(msg[1 : len(msg)-1])
+	id, data := body[:tk103IDLen], body[tk103IDLen+tk103CmdLen:]
+	m = Message{Dialect: tk103Name, DeviceID: id, Command: body[tk103IDLen : tk103IDLen+tk103CmdLen]}
+
+	switch m.Command {
+	case tk103Handshake:
+		if len(data) < tk103IMEILen {
+			return m, fmt.Errorf("%w: handshake %q", ErrMalformed, msg)
+		}
+		m.DeviceID, m.Login = data[:tk103IMEILen], true
+		m.Response = []byte("(" + id + "AP01HSO)")
+	case tk103Login:
+		if len(data) < tk103IMEILen {
+			return m, fmt.Errorf("%w: login %q", ErrMalformed, msg)
+		}
+		m.DeviceID, m.Login = data[:tk103IMEILen], true
+		m.Response = []byte("(" + id + "AP05)")
+		err = m.parseTK103Location(data[tk103IMEILen:])
+	case tk103Location:
+		err = m.parseTK103Location(data)
+	case tk103Alarm:
+		if len(data) < 1 {
+			return m, fmt.Errorf("%w: alarm %q", ErrMalformed, msg)
+		}
+		m.Response = []byte("(" + id + "AS01" + data[:1] + ")")
+		err = m.parseTK103Location(data[1:])
+		if a, e := strconv.ParseInt(data[:1], 10, 64); e == nil && m.Attributes != nil {
+			m.Attributes[alarm] = a
+		}
+	}
+	return m, err
+}
+
+// parseTK103Location parses yymmdd A DDMM.MMMM N DDDMM.MMMM E speed hhmmss course status [L mileage].
+func (m *Message) parseTK103Location(s string) error {
+	if len(s) < tk103LocLen {
+		return fmt.Errorf("%w: location %q", ErrMalformed, s)
+	}
+	fix := &Fix{Valid: s[6] == 'A'}
+	var err error
+	if fix.Time, err = parseTime("060102150405", s[0:6]+s[33:39]); err != nil {
+		return err
+	}
+	if fix.Latitude, err = parseCoordinate(s[7:16], s[16:17]); err != nil {
+		return err
+	}
+	if fix.Longitude, err = parseCoordinate(s[17:27], s[27:28]); err != nil {
+		return err
+	}
+	if fix.Speed, err = parseFloat("speed", s[28:33]); err != nil {
+		return err
+	}
+	if fix.Course, err = parseFloat("course", s[39:45]); err != nil {
+		return err
+	}
+	m.Fix = fix
+
+	m.Attributes = make(map[string]int64)
+	if st, err := strconv.ParseUint(s[45:53], 2, 32); err == nil {
+		m.Attributes[status] = int64(st)
+	}
+	if rest := s[tk103LocLen:]; len(rest) > 1 && rest[0] == 'L' {
+		if mileage, err := strconv.ParseUint(rest[1:], 16, 32); err == nil {
+			m.Attributes[common.Odometer] = int64(mileage)
+		}
+	}
+	return nil
+}
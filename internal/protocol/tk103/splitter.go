@@ -0,0 +1,76 @@
+package tk103
+
+import (
+	"bufio"
+	"bytes"
+
+	"github.com/gotrackery/protocol/common"
+)
+
+var _ common.FrameSplitter = (*Splitter)(nil)
+
+// terminators maps message start byte of each framing to its end byte.
+var terminators = map[byte]byte{
+	'*': '#', // H02 *HQ,...#
+	'(': ')', // TK103 (...)
+}
+
+// Splitter implements common.FrameSplitter contract to extract text message from incoming bytes.
+type Splitter struct {
+	badData []byte
+	err     error
+}
+
+// NewSplitter creates a new Splitter instance for TK103/H02 protocols.
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+// Splitter implements bufio.SplitFunc contract to extract message from incoming bytes stream.
+// Message starts with * and is terminated by # or starts with ( and is terminated by ),
+// line breaks between messages are skipped.
+func (s *Splitter) Splitter() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		skip := 0
+		for skip < len(data) && (data[skip] == '\r' || data[skip] == '\n') {
+			skip++
+		}
+		if atEOF && len(data) == skip {
+			return len(data), nil, nil
+		}
+		if len(data) == skip {
+			return skip, nil, nil
+		}
+
+		end, ok := terminators[data[skip]]
+		if !ok {
+			s.badData = data
+			s.err = common.ErrBadData
+			return 0, nil, s.err
+		}
+		if i := bytes.IndexByte(data[skip:], end); i >= 0 {
+			// We have a full terminated message.
+			return skip + i + 1, data[skip : skip+i+1], nil
+		}
+		// If we're at EOF, we have a final, non-terminated message.
+		if atEOF {
+			s.badData = data
+			s.err = common.ErrBadData
+			return 0, nil, s.err
+		}
+		// Request more data.
+		return skip, nil, nil
+	}
+}
+
+// Error returns error if any registered.
+// Use it to check that data corresponds to TK103/H02 protocols.
+func (s *Splitter) Error() error {
+	return s.err
+}
+
+// BadData returns bad data if any registered.
+// Use it to log which bytes couldn't be parsed as TK103/H02 protocols.
+func (s *Splitter) BadData() []byte {
+	return s.badData
+}
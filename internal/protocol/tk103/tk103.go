@@ -0,0 +1,87 @@
+package tk103
+
+import (
+	"fmt"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+)
+
+const (
+	Proto = "tk103"
+)
+
+var (
+	_ tcp.Protocol     = (*TK103)(nil)
+	_ tcp.ReplyChecker = (*TK103)(nil)
+)
+
+// Option configures TK103 protocol.
+type Option func(*TK103)
+
+// WithDialects replaces default dialects by given ones, dialects are matched in given order.
+func WithDialects(dialects ...Dialect) Option {
+	return func(t *TK103) {
+		t.dialects = dialects
+	}
+}
+
+// TK103 is a family of text protocols of generic trackers: H02 and TK103 dialects by default.
+type TK103 struct {
+	dialects []Dialect
+}
+
+// NewTK103 creates a new TK103 struct instance.
+func NewTK103(opts ...Option) *TK103 {
+	t := &TK103{dialects: []Dialect{H02Dialect{}, TK103Dialect{}}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Name returns the name of the TK103 protocol.
+func (t *TK103) Name() string {
+	return Proto
+}
+
+// NewFrameSplitter returns a new instance of the split function for the TK103 protocol.
+func (t *TK103) NewFrameSplitter() common.FrameSplitter {
+	return NewSplitter()
+}
+
+// ExpectReply reports whether server replies to the frame, it depends on the dialect and message.
+func (t *TK103) ExpectReply(frame []byte) bool {
+	msg, err := t.parse(frame)
+	return err == nil && msg.Response != nil
+}
+
+// Respond returns the result of parsing the TK103 data.
+// Session is bound to the device by login messages or by the first message with device ID.
+func (t *TK103) Respond(s *internal.Session, bytes []byte) (res tcp.Result, err error) {
+	msg, err := t.parse(bytes)
+	if err != nil {
+		return res, err
+	}
+	if msg.Login || s.Device() == "" {
+		s.SetDevice(msg.DeviceID)
+	}
+	res.Response = msg.Response
+	res.GenericAdapter = Adapter{Message: &msg, DeviceID: s.Device()}
+	return res, nil
+}
+
+func (t *TK103) parse(b []byte) (Message, error) {
+	for _, d := range t.dialects {
+		if !d.Match(b) {
+			continue
+		}
+		msg, err := d.Parse(b)
+		if err != nil {
+			return msg, fmt.Errorf("parse %s message: %w", d.Name(), err)
+		}
+		return msg, nil
+	}
+	return Message{}, fmt.Errorf("%w: no dialect for %q", common.ErrBadData, b)
+}
@@ -0,0 +1,272 @@
+package tk103
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/gotrackery/protocol/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	h02LocationMsg     = "*HQ,865205030330012,V1,145452,A,2240.55181,N,11358.32389,E,1.00,90,100815,FFFFFBFF#"
+	h02LocationSWMsg   = "*HQ,4210051415,V1,164549,V,0956.3869,S,08406.7068,W,000.00,000,221215,FFFFFBFF,712,01,0,0,6#"
+	h02LinkMsg         = "*HQ,355488020533263,LINK,152800,6,8,80,0,0,151117#"
+	tk103HandshakeMsg  = "(027044702512BP00000027044702512HSO)"
+	tk103LoginMsg      = "(027043288150BP05000027043288150160522A5539.6549N03731.0124E000.0104531000.0000000000L00000000)"
+	tk103LocationMsg   = "(080525135000BR00080612A2232.9828N11404.9297E012.5022828180.5000000001L000450AA)"
+	tk103AlarmMsg      = "(080525135000BO011080612A2232.9828N11404.9297E000.0022828000.0000000000L000450AA)"
+	tk103UnexpectedMsg = "(080525135000BP12)"
+)
+
+func TestSplitter_Splitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		wantCount int
+		wantErr   error
+	}{
+		{name: "h02", stream: h02LocationMsg, wantCount: 1},
+		{name: "tk103", stream: tk103LoginMsg, wantCount: 1},
+		{name: "mixed with line breaks", stream: h02LocationMsg + "\r\n" + tk103LocationMsg + "\n" + h02LinkMsg, wantCount: 3},
+		{name: "truncated", stream: tk103LoginMsg[:30], wantErr: common.ErrBadData},
+		{name: "garbage", stream: "$HQ", wantErr: common.ErrBadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSplitter()
+			scanner := bufio.NewScanner(strings.NewReader(tt.stream))
+			scanner.Split(s.Splitter())
+			cnt := 0
+			for scanner.Scan() {
+				cnt++
+			}
+			assert.Equal(t, tt.wantCount, cnt)
+			assert.ErrorIs(t, s.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseCoordinate(t *testing.T) {
+	tests := []struct {
+		value      string
+		hemisphere string
+		want       float64
+	}{
+		{value: "2240.55181", hemisphere: "N", want: 22.675863},
+		{value: "11358.32389", hemisphere: "E", want: 113.972065},
+		{value: "0956.3869", hemisphere: "S", want: -9.939782},
+		{value: "08406.7068", hemisphere: "W", want: -84.111780},
+		{value: "0000.0000", hemisphere: "N", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+tt.hemisphere, func(t *testing.T) {
+			got, err := parseCoordinate(tt.value, tt.hemisphere)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-6)
+		})
+	}
+	_, err := parseCoordinate("22a0.5", "N")
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = parseCoordinate("2240.55181", "X")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestDialect_Parse(t *testing.T) {
+	tests := []struct {
+		name         string
+		dialect      Dialect
+		msg          string
+		wantDeviceID string
+		wantCommand  string
+		wantLogin    bool
+		wantFix      *Fix
+		wantAttrs    map[string]int64
+		wantResponse string
+		wantErr      error
+	}{
+		{
+			name:         "h02 location",
+			dialect:      H02Dialect{},
+			msg:          h02LocationMsg,
+			wantDeviceID: "865205030330012",
+			wantCommand:  "V1",
+			wantLogin:    true,
+			wantFix: &Fix{
+				Time: time.Date(2015, 8, 10, 14, 54, 52, 0, time.UTC), Valid: true,
+				Latitude: 22.675863, Longitude: 113.972065, Speed: 1.852, Course: 90,
+			},
+			wantAttrs: map[string]int64{status: 0xFFFFFBFF},
+		},
+		{
+			name:         "h02 southern western location",
+			dialect:      H02Dialect{},
+			msg:          h02LocationSWMsg,
+			wantDeviceID: "4210051415",
+			wantCommand:  "V1",
+			wantLogin:    true,
+			wantFix: &Fix{
+				Time:     time.Date(2015, 12, 22, 16, 45, 49, 0, time.UTC),
+				Latitude: -9.939782, Longitude: -84.111780,
+			},
+			wantAttrs: map[string]int64{status: 0xFFFFFBFF},
+		},
+		{
+			name:         "h02 link",
+			dialect:      H02Dialect{},
+			msg:          h02LinkMsg,
+			wantDeviceID: "355488020533263",
+			wantCommand:  "LINK",
+			wantLogin:    true,
+			wantAttrs:    map[string]int64{rssi: 6, common.Satellites: 8, battery: 80},
+		},
+		{name: "h02 malformed", dialect: H02Dialect{}, msg: "*HQ#", wantErr: ErrMalformed},
+		{
+			name:         "tk103 handshake",
+			dialect:      TK103Dialect{},
+			msg:          tk103HandshakeMsg,
+			wantDeviceID: "000027044702512",
+			wantCommand:  "BP00",
+			wantLogin:    true,
+			wantResponse: "(027044702512AP01HSO)",
+		},
+		{
+			name:         "tk103 login",
+			dialect:      TK103Dialect{},
+			msg:          tk103LoginMsg,
+			wantDeviceID: "000027043288150",
+			wantCommand:  "BP05",
+			wantLogin:    true,
+			wantFix: &Fix{
+				Time: time.Date(2016, 5, 22, 10, 45, 31, 0, time.UTC), Valid: true,
+				Latitude: 55.660915, Longitude: 37.516873,
+			},
+			wantAttrs:    map[string]int64{status: 0, common.Odometer: 0},
+			wantResponse: "(027043288150AP05)",
+		},
+		{
+			name:         "tk103 location",
+			dialect:      TK103Dialect{},
+			msg:          tk103LocationMsg,
+			wantDeviceID: "080525135000",
+			wantCommand:  "BR00",
+			wantFix: &Fix{
+				Time: time.Date(2008, 6, 12, 2, 28, 28, 0, time.UTC), Valid: true,
+				Latitude: 22.549713, Longitude: 114.082162, Speed: 12.5, Course: 180.5,
+			},
+			wantAttrs: map[string]int64{status: 1, common.Odometer: 0x450AA},
+		},
+		{
+			name:         "tk103 alarm",
+			dialect:      TK103Dialect{},
+			msg:          tk103AlarmMsg,
+			wantDeviceID: "080525135000",
+			wantCommand:  "BO01",
+			wantFix: &Fix{
+				Time: time.Date(2008, 6, 12, 2, 28, 28, 0, time.UTC), Valid: true,
+				Latitude: 22.549713, Longitude: 114.082162,
+			},
+			wantAttrs:    map[string]int64{status: 0, common.Odometer: 0x450AA, alarm: 1},
+			wantResponse: "(080525135000AS011)",
+		},
+		{
+			name:         "tk103 unexpected command",
+			dialect:      TK103Dialect{},
+			msg:          tk103UnexpectedMsg,
+			wantDeviceID: "080525135000",
+			wantCommand:  "BP12",
+		},
+		{name: "tk103 truncated location", dialect: TK103Dialect{}, msg: "(080525135000BR00080612A2232)", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, tt.dialect.Match([]byte(tt.msg)))
+			m, err := tt.dialect.Parse([]byte(tt.msg))
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			assert.Equal(t, tt.wantDeviceID, m.DeviceID)
+			assert.Equal(t, tt.wantCommand, m.Command)
+			assert.Equal(t, tt.wantLogin, m.Login)
+			assert.Equal(t, tt.wantAttrs, m.Attributes)
+			if tt.wantResponse == "" {
+				assert.Nil(t, m.Response)
+			} else {
+				assert.Equal(t, tt.wantResponse, string(m.Response))
+			}
+			if tt.wantFix == nil {
+				assert.Nil(t, m.Fix)
+				return
+			}
+			require.NotNil(t, m.Fix)
+			assert.Equal(t, tt.wantFix.Time, m.Fix.Time)
+			assert.Equal(t, tt.wantFix.Valid, m.Fix.Valid)
+			assert.InDelta(t, tt.wantFix.Latitude, m.Fix.Latitude, 1e-6)
+			assert.InDelta(t, tt.wantFix.Longitude, m.Fix.Longitude, 1e-6)
+			assert.InDelta(t, tt.wantFix.Speed, m.Fix.Speed, 1e-9)
+			assert.InDelta(t, tt.wantFix.Course, m.Fix.Course, 1e-9)
+		})
+	}
+}
+
+func TestTK103_Respond(t *testing.T) {
+	p := NewTK103()
+	s := internal.NewSession()
+
+	_, err := p.Respond(s, []byte("[garbage]"))
+	assert.ErrorIs(t, err, common.ErrBadData)
+
+	// Messages before login are bound to the device by ID.
+	res, err := p.Respond(s, []byte(tk103LocationMsg))
+	require.NoError(t, err)
+	assert.Equal(t, "080525135000", s.Device())
+	assert.False(t, p.ExpectReply([]byte(tk103LocationMsg)))
+	assert.Nil(t, res.Response)
+
+	res, err = p.Respond(s, []byte(tk103LoginMsg))
+	require.NoError(t, err)
+	assert.Equal(t, "000027043288150", s.Device())
+	assert.True(t, p.ExpectReply([]byte(tk103LoginMsg)))
+	assert.Equal(t, []byte("(027043288150AP05)"), res.Response)
+
+	res, err = p.Respond(s, []byte(tk103LocationMsg))
+	require.NoError(t, err)
+	require.NotNil(t, res.GenericAdapter)
+	pos := res.GenericAdapter.GenericPositions()
+	require.Len(t, pos, 1)
+	assert.Equal(t, "000027043288150", pos[0].DeviceID)
+	assert.True(t, pos[0].Valid)
+	assert.InDelta(t, 22.549713, pos[0].Y, 1e-6)
+	assert.InDelta(t, 114.082162, pos[0].X, 1e-6)
+	assert.Equal(t, "BR00", pos[0].Attributes[command])
+	assert.Equal(t, int64(0x450AA), pos[0].Attributes[common.Odometer])
+
+	res, err = p.Respond(s, []byte(tk103HandshakeMsg))
+	require.NoError(t, err)
+	assert.Nil(t, res.GenericAdapter.GenericPositions())
+
+	// Only given dialects are used.
+	p = NewTK103(WithDialects(TK103Dialect{}))
+	_, err = p.Respond(internal.NewSession(), []byte(h02LocationMsg))
+	assert.ErrorIs(t, err, common.ErrBadData)
+	assert.False(t, p.ExpectReply([]byte(h02LocationMsg)))
+}
+
+func TestTK103_Replay(t *testing.T) {
+	// Replay of the recorded stream relies on splitter and reply check only.
+	p := NewTK103()
+	stream := h02LocationMsg + tk103HandshakeMsg + tk103AlarmMsg
+	scanner := bufio.NewScanner(bytes.NewReader([]byte(stream)))
+	scanner.Split(p.NewFrameSplitter().Splitter())
+	var replies []bool
+	for scanner.Scan() {
+		replies = append(replies, p.ExpectReply(scanner.Bytes()))
+	}
+	assert.Equal(t, []bool{false, true, true}, replies)
+}
@@ -0,0 +1,231 @@
+// Package redis provides the events subscriber appending positions to Redis streams
+// and keeping the last known position of every device.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	_ event.Listener   = (*Publisher)(nil)
+	_ event.Subscriber = (*Publisher)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "redis"
+
+const (
+	// DefaultStream is the template of positions stream key.
+	DefaultStream = "gotrackery:positions:{protocol}"
+	// DefaultLatest is the key of the hash of last known positions.
+	DefaultLatest = "gotrackery:latest"
+
+	defaultMaxLen  = 100000
+	defaultTimeout = 5 * time.Second
+)
+
+// ErrNotFound is returned when the device has no known position.
+var ErrNotFound = errors.New("position not found")
+
+// write appends the position to the stream and overwrites the last known position of the device
+// when the position is newer. The script is atomic, so the position is appended once or not at all.
+// KEYS[1] is the stream, KEYS[2] is the hash of positions, KEYS[3] is the hash of their device times,
+// ARGV[1] is max length of the stream, ARGV[2] is the device, ARGV[3] is the device time in Unix milliseconds,
+// it is empty for the position without time, and ARGV[4] is the position.
+// Keys of the script are not in one hash slot, so Redis Cluster is not supported.
+var write = goredis.NewScript(`
+redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'device', ARGV[2], 'data', ARGV[4])
+if ARGV[2] == '' or ARGV[3] == '' then
+	return 0
+end
+local t = tonumber(redis.call('HGET', KEYS[3], ARGV[2]))
+if t and t >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[4])
+redis.call('HSET', KEYS[3], ARGV[2], ARGV[3])
+return 1
+`)
+
+// Stream expands the template placeholder {protocol}, empty protocol is unknown.
+func Stream(tmpl, protocol string) string {
+	if protocol == "" {
+		protocol = "unknown"
+	}
+	return strings.ReplaceAll(tmpl, "{protocol}", protocol)
+}
+
+// deviceTime formats the time in Unix milliseconds, it is empty for zero time.
+func deviceTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// Option is a functional option for the publisher.
+type Option func(*Publisher)
+
+// WithStream sets the template of positions stream key. Default is DefaultStream.
+func WithStream(tmpl string) Option {
+	return func(p *Publisher) {
+		if tmpl != "" {
+			p.stream = tmpl
+		}
+	}
+}
+
+// WithMaxLen sets the approximate max length of the stream, older positions are trimmed. Default is 100000.
+func WithMaxLen(n int64) Option {
+	return func(p *Publisher) {
+		if n > 0 {
+			p.maxLen = n
+		}
+	}
+}
+
+// WithLatest sets the key of the hash of last known positions. Default is DefaultLatest.
+// Device times of positions are kept in the hash of the key with :time suffix.
+func WithLatest(key string) Option {
+	return func(p *Publisher) {
+		if key != "" {
+			p.latest = key
+		}
+	}
+}
+
+// WithEncoder sets the encoder of positions. Default is JSON.
+func WithEncoder(enc encoding.Encoder) Option {
+	return func(p *Publisher) {
+		if enc != nil {
+			p.encoder = enc
+		}
+	}
+}
+
+// WithTimeout sets the timeout of commands. Default is 5s.
+func WithTimeout(to time.Duration) Option {
+	return func(p *Publisher) {
+		if to > 0 {
+			p.timeout = to
+		}
+	}
+}
+
+// Publisher appends positions to the stream of their protocol and keeps the last known position
+// of every device in the hash by device, positions older than the known one or without device time
+// do not overwrite it.
+// Both are written atomically by the script, failed writing is returned to the dispatcher to retry it.
+type Publisher struct {
+	client goredis.UniversalClient
+
+	stream  string
+	maxLen  int64
+	latest  string
+	encoder encoding.Encoder
+	timeout time.Duration
+}
+
+// NewPublisher creates a new publisher of the client.
+func NewPublisher(client goredis.UniversalClient, opts ...Option) (*Publisher, error) {
+	if client == nil {
+		return nil, errors.New("no client")
+	}
+	p := &Publisher{
+		client:  client,
+		stream:  DefaultStream,
+		maxLen:  defaultMaxLen,
+		latest:  DefaultLatest,
+		encoder: encoding.JSON{},
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("ping redis: %w", err)
+	}
+	if err := write.Load(ctx, client).Err(); err != nil {
+		return nil, fmt.Errorf("load script: %w", err)
+	}
+	return p, nil
+}
+
+func (p *Publisher) String() string {
+	return Name
+}
+
+func (p *Publisher) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionReceived, Name): p,
+	}
+}
+
+// Handle appends the position to the stream and updates the last known position of the device.
+func (p *Publisher) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	pos := eve.Position()
+	if pos == nil {
+		return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
+	}
+
+	data, err := p.encoder.Encode(*pos)
+	if err != nil {
+		return fmt.Errorf("encode position: %w", err)
+	}
+	stream := Stream(p.stream, pos.Protocol)
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	// the script is loaded again if it is flushed, e.g. by the restart of the server.
+	err = write.Run(ctx, p.client, []string{stream, p.latest, p.latest + ":time"},
+		p.maxLen, pos.DeviceID, deviceTime(pos.DeviceTime), data).Err()
+	if err != nil {
+		return fmt.Errorf("write position to %s: %w", stream, err)
+	}
+	return nil
+}
+
+// Latest returns the last known position of the device encoded by JSON encoder.
+func (p *Publisher) Latest(ctx context.Context, device string) (*encoding.Message, error) {
+	data, err := p.client.HGet(ctx, p.latest, device).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get latest position: %w", err)
+	}
+	var msg encoding.Message
+	if err = json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal latest position: %w", err)
+	}
+	return &msg, nil
+}
+
+// Close closes the client.
+func (p *Publisher) Close() error {
+	if err := p.client.Close(); err != nil {
+		return fmt.Errorf("close redis client: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func positionEvent(protocol, device string, at time.Time, lon float64) *ev.GenericEvent {
+	pos := common.Position{Protocol: protocol, DeviceID: device, DeviceTime: at}
+	pos.X = lon
+	e := new(ev.GenericEvent)
+	e.SetPosition(pos)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, Name))
+	return e
+}
+
+func newPublisher(t *testing.T, opts ...Option) (*Publisher, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	p, err := NewPublisher(goredis.NewClient(&goredis.Options{Addr: srv.Addr()}), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = p.Close() })
+	return p, srv
+}
+
+func TestPublisher_Handle(t *testing.T) {
+	p, srv := newPublisher(t)
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	require.NoError(t, p.Handle(positionEvent("egts", "1", at, 1)))
+	require.NoError(t, p.Handle(positionEvent("egts", "2", at, 2)))
+	require.NoError(t, p.Handle(positionEvent("gt06", "3", at, 3)))
+
+	egts, err := srv.Stream("gotrackery:positions:egts")
+	require.NoError(t, err)
+	require.Len(t, egts, 2)
+	assert.Equal(t, []string{"device", "1"}, egts[0].Values[:2])
+	gt06, err := srv.Stream("gotrackery:positions:gt06")
+	require.NoError(t, err)
+	assert.Len(t, gt06, 1)
+
+	msg, err := p.Latest(context.Background(), "2")
+	require.NoError(t, err)
+	assert.Equal(t, "2", msg.Device)
+	assert.Equal(t, at, msg.Time)
+	assert.Equal(t, 2.0, msg.Lon)
+
+	_, err = p.Latest(context.Background(), "4")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPublisher_Latest(t *testing.T) {
+	p, srv := newPublisher(t)
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	steps := []struct {
+		at  time.Time
+		lon float64
+	}{
+		{at: at, lon: 1},
+		{at: at.Add(time.Second), lon: 2},
+		// late positions of the device do not overwrite the known one.
+		{at: at.Add(-time.Minute), lon: 3},
+		{at: at.Add(time.Second), lon: 4},
+		// position without device time, e.g. LBS only one, is not the known one.
+		{lon: 5},
+	}
+	for _, s := range steps {
+		require.NoError(t, p.Handle(positionEvent("egts", "1", s.at, s.lon)))
+	}
+
+	msg, err := p.Latest(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, at.Add(time.Second), msg.Time)
+	assert.Equal(t, 2.0, msg.Lon)
+	// all positions are appended to the stream.
+	stream, err := srv.Stream("gotrackery:positions:egts")
+	require.NoError(t, err)
+	assert.Len(t, stream, 5)
+
+	// times are compared as numbers.
+	early := time.UnixMilli(9000)
+	require.NoError(t, p.Handle(positionEvent("egts", "2", early, 1)))
+	require.NoError(t, p.Handle(positionEvent("egts", "2", early.Add(time.Second), 2)))
+	msg, err = p.Latest(context.Background(), "2")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, msg.Lon)
+
+	// the known position is set by the first position with device time.
+	require.NoError(t, p.Handle(positionEvent("egts", "3", time.Time{}, 1)))
+	_, err = p.Latest(context.Background(), "3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPublisher_MaxLen(t *testing.T) {
+	p, srv := newPublisher(t, WithMaxLen(3), WithStream("fleet:{protocol}"), WithLatest("fleet:latest"))
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Handle(positionEvent("", "1", at.Add(time.Duration(i)*time.Second), float64(i))))
+	}
+	stream, err := srv.Stream("fleet:unknown")
+	require.NoError(t, err)
+	assert.Len(t, stream, 3)
+	assert.True(t, srv.Exists("fleet:latest"))
+	assert.True(t, srv.Exists("fleet:latest:time"))
+}
+
+func TestPublisher_Unavailable(t *testing.T) {
+	p, srv := newPublisher(t, WithTimeout(time.Second))
+	srv.Close()
+	assert.Error(t, p.Handle(positionEvent("egts", "1", time.Now(), 1)))
+}
+
+func TestPublisher_ScriptFlush(t *testing.T) {
+	p, srv := newPublisher(t)
+	at := time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)
+	require.NoError(t, p.Handle(positionEvent("egts", "1", at, 1)))
+	// scripts are flushed, e.g. by the restart of the server.
+	require.NoError(t, goredis.NewClient(&goredis.Options{Addr: srv.Addr()}).ScriptFlush(context.Background()).Err())
+	require.NoError(t, p.Handle(positionEvent("egts", "1", at.Add(time.Second), 2)))
+
+	stream, err := srv.Stream("gotrackery:positions:egts")
+	require.NoError(t, err)
+	assert.Len(t, stream, 2)
+	msg, err := p.Latest(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, msg.Lon)
+}
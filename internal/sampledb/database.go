@@ -2,6 +2,7 @@ package sampledb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	ev "github.com/gotrackery/gotrackery/internal/event"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -66,13 +68,16 @@ func (d *DB) Handle(e event.Event) (err error) {
 	case string(ev.PositionReceived):
 		pos := eve.Position()
 		if pos == nil {
-			return fmt.Errorf("position not specified")
+			return fmt.Errorf("%w: position not specified", ev.ErrPermanent)
 		}
 		tr, err := CreateFromCommon(*pos)
 		if err != nil {
-			return fmt.Errorf("create position from common: %w", err)
+			return fmt.Errorf("%w: create position from common: %w", ev.ErrPermanent, err)
 		}
 		err = d.insert(context.Background(), tr)
+		if rejected(err) {
+			return fmt.Errorf("%w: insert position: %w", ev.ErrPermanent, err)
+		}
 		if err != nil {
 			return fmt.Errorf("insert position: %w", err)
 		}
@@ -114,3 +119,10 @@ func (d *DB) insert(ctx context.Context, pos *Position) error {
 	}
 	return nil
 }
+
+// rejected reports whether the position is rejected by the database: data exception
+// or integrity constraint violation, so inserting it again fails too.
+func rejected(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
@@ -0,0 +1,91 @@
+// Package server runs several protocol servers in one process.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Server is the contract of the server run within the Group.
+type Server interface {
+	// Listen binds the server to its address.
+	Listen() error
+	// Serve serves until the server is shut down.
+	Serve() error
+	// Shutdown stops the server.
+	Shutdown() error
+}
+
+type member struct {
+	name string
+	srv  Server
+}
+
+// Group runs servers concurrently and shuts them down together.
+type Group struct {
+	logger  zerolog.Logger
+	members []member
+}
+
+// NewGroup creates a new empty group of servers.
+func NewGroup(l zerolog.Logger) *Group {
+	return &Group{logger: l}
+}
+
+// Add adds the server to the group, name is used for logging and errors.
+func (g *Group) Add(name string, srv Server) {
+	g.members = append(g.members, member{name: name, srv: srv})
+}
+
+// Run binds all servers and serves them until the context is done or any server stops.
+// If any server fails to bind, already bound ones are shut down and nothing is served.
+// Run returns after all servers are stopped.
+func (g *Group) Run(ctx context.Context) error {
+	for i, m := range g.members {
+		if err := m.srv.Listen(); err != nil {
+			g.shutdown(g.members[:i])
+			return fmt.Errorf("listen %s: %w", m.name, err)
+		}
+	}
+
+	errs := make(chan error, len(g.members))
+	var wg sync.WaitGroup
+	for _, m := range g.members {
+		wg.Add(1)
+		go func(m member) {
+			defer wg.Done()
+			err := m.srv.Serve()
+			if err != nil {
+				err = fmt.Errorf("serve %s: %w", m.name, err)
+			}
+			errs <- err
+		}(m)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		g.logger.Info().Msg("shutting down servers...")
+	case err = <-errs:
+		g.logger.Warn().Err(err).Msg("server stopped, shutting down others...")
+	}
+	g.shutdown(g.members)
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		err = errors.Join(err, e)
+	}
+	return err
+}
+
+func (g *Group) shutdown(members []member) {
+	for _, m := range members {
+		if err := m.srv.Shutdown(); err != nil {
+			g.logger.Warn().Err(err).Str("server", m.name).Msg("shutdown server")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFake = errors.New("fake")
+
+// fakeServer serves until it is shut down or fails with serveErr.
+type fakeServer struct {
+	listenErr error
+	serveErr  chan error
+	listened  atomic.Bool
+	shutdowns atomic.Int32
+	stop      chan struct{}
+}
+
+func newFakeServer(listenErr error) *fakeServer {
+	return &fakeServer{listenErr: listenErr, serveErr: make(chan error, 1), stop: make(chan struct{})}
+}
+
+func (f *fakeServer) Listen() error {
+	f.listened.Store(f.listenErr == nil)
+	return f.listenErr
+}
+
+func (f *fakeServer) Serve() error {
+	select {
+	case <-f.stop:
+		return nil
+	case err := <-f.serveErr:
+		return err
+	}
+}
+
+func (f *fakeServer) Shutdown() error {
+	if f.shutdowns.Add(1) == 1 {
+		close(f.stop)
+	}
+	return nil
+}
+
+func TestGroup_Run(t *testing.T) {
+	t.Run("context done", func(t *testing.T) {
+		a, b := newFakeServer(nil), newFakeServer(nil)
+		g := NewGroup(zerolog.Nop())
+		g.Add("a", a)
+		g.Add("b", b)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.NoError(t, g.Run(ctx))
+		assert.Equal(t, int32(1), a.shutdowns.Load())
+		assert.Equal(t, int32(1), b.shutdowns.Load())
+	})
+
+	t.Run("server failed", func(t *testing.T) {
+		a, b := newFakeServer(nil), newFakeServer(nil)
+		g := NewGroup(zerolog.Nop())
+		g.Add("a", a)
+		g.Add("b", b)
+		b.serveErr <- errFake
+		err := g.Run(context.Background())
+		assert.ErrorIs(t, err, errFake)
+		assert.ErrorContains(t, err, "serve b")
+		assert.Equal(t, int32(1), a.shutdowns.Load())
+	})
+
+	t.Run("listen failed", func(t *testing.T) {
+		a, b, c := newFakeServer(nil), newFakeServer(errFake), newFakeServer(nil)
+		g := NewGroup(zerolog.Nop())
+		g.Add("a", a)
+		g.Add("b", b)
+		g.Add("c", c)
+		err := g.Run(context.Background())
+		assert.ErrorIs(t, err, errFake)
+		assert.ErrorContains(t, err, "listen b")
+		assert.Equal(t, int32(1), a.shutdowns.Load())
+		assert.False(t, c.listened.Load())
+		assert.Equal(t, int32(0), c.shutdowns.Load())
+	})
+}
@@ -0,0 +1,121 @@
+package tcp
+
+import (
+	"github.com/gotrackery/gotrackery/internal"
+	"github.com/rs/zerolog"
+)
+
+// AutoProto is the name of the protocol auto-detection mode.
+const AutoProto = "auto"
+
+// Score is the rate of the protocol matching the first bytes of the connection.
+type Score int
+
+const (
+	// ScoreNone means bytes are not the protocol data.
+	ScoreNone Score = iota
+	// ScorePartial means the protocol splitter needs more bytes to get the frame.
+	ScorePartial
+	// ScoreFramed means the protocol splitter got the frame, but the protocol failed to decode it
+	// or the frame has no meaning by itself (keep alive ping for instance).
+	ScoreFramed
+	// ScoreDecoded means the protocol decoded the first frame and identified the device or replied to it.
+	ScoreDecoded
+)
+
+var scoreNames = map[Score]string{
+	ScoreNone:    "none",
+	ScorePartial: "partial",
+	ScoreFramed:  "framed",
+	ScoreDecoded: "decoded",
+}
+
+func (s Score) String() string {
+	return scoreNames[s]
+}
+
+// Detection is the result of scoring the first bytes against the protocols.
+type Detection struct {
+	// Protocol is the best matched protocol, it is nil if no protocol matched.
+	Protocol Protocol
+	// Score is the score of the Protocol.
+	Score Score
+	// Scores are the scores of all protocols by name.
+	Scores map[string]Score
+}
+
+// Final reports whether more bytes can't change the detection:
+// the first frame is decoded or no protocol matches the bytes.
+func (d Detection) Final() bool {
+	return d.Score == ScoreDecoded || d.Score == ScoreNone
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (d Detection) MarshalZerologObject(e *zerolog.Event) {
+	if d.Protocol != nil {
+		e.Str("proto", d.Protocol.Name())
+	}
+	e.Stringer("score", d.Score)
+	scores := zerolog.Dict()
+	for name, s := range d.Scores {
+		scores.Stringer(name, s)
+	}
+	e.Dict("scores", scores)
+}
+
+// Detector detects the protocol of the connection by its first bytes.
+type Detector struct {
+	protos []Protocol
+}
+
+// NewDetector creates a new protocol detector.
+// Protocols with equal scores are preferred in given order,
+// so protocols with strong signatures shall go first.
+func NewDetector(protos ...Protocol) *Detector {
+	return &Detector{protos: protos}
+}
+
+// Protocols returns protocols of the detector.
+func (d *Detector) Protocols() []Protocol {
+	return d.protos
+}
+
+// Detect scores the bytes against every protocol and returns the best one.
+func (d *Detector) Detect(b []byte) Detection {
+	det := Detection{Scores: make(map[string]Score, len(d.protos))}
+	for _, p := range d.protos {
+		s := score(p, b)
+		det.Scores[p.Name()] = s
+		if s > det.Score {
+			det.Protocol, det.Score = p, s
+		}
+	}
+	return det
+}
+
+// score splits the first frame from the bytes by the new protocol splitter
+// and decodes the frame within the scratch session.
+// Decoded frame counts only if it identifies the device or it is replied,
+// otherwise one byte pings of some protocols would match almost anything.
+func score(p Protocol, b []byte) (s Score) {
+	defer func() {
+		// protocol is not ready for arbitrary bytes.
+		if r := recover(); r != nil {
+			s = ScoreNone
+		}
+	}()
+
+	_, token, err := p.NewFrameSplitter().Splitter()(b, false)
+	switch {
+	case err != nil:
+		return ScoreNone
+	case len(token) == 0:
+		return ScorePartial
+	}
+	session := internal.NewSession()
+	res, err := p.Respond(session, token)
+	if err != nil || (session.Device() == "" && len(res.Response) == 0) {
+		return ScoreFramed
+	}
+	return ScoreDecoded
+}
@@ -0,0 +1,63 @@
+package tcp_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal/protocol/gt06"
+	"github.com/gotrackery/gotrackery/internal/protocol/wialonips"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAutoServer(t *testing.T) *tcp.Server {
+	t.Helper()
+	srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0", tcp.WithTimeout(time.Second))
+	require.NoError(t, err)
+	srv.SetDetector(tcp.NewDetector(wialonips.NewWialonIPS(), gt06.NewGT06()))
+	require.NoError(t, srv.Listen())
+	go func() {
+		_ = srv.Serve()
+	}()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return srv
+}
+
+func TestServer_AutoProtocol(t *testing.T) {
+	srv := newAutoServer(t)
+
+	t.Run("detected by parts", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("#L#866795037"))
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		_, err = conn.Write([]byte("163746;NA\r\n"))
+		require.NoError(t, err)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "#AL#1\r\n", reply)
+	})
+
+	t.Run("not detected", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Bytes match no protocol, so the connection is closed at once.
+		_, err = conn.Write([]byte{0x00, 0x00, 0x00})
+		require.NoError(t, err)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.Error(t, err, "connection shall be closed")
+	})
+}
@@ -2,15 +2,17 @@ package tcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"io"
-	"strings"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gookit/event"
 	"github.com/gotrackery/gotrackery/internal"
 	ev "github.com/gotrackery/gotrackery/internal/event"
 	gen "github.com/gotrackery/gotrackery/internal/protocol"
@@ -31,81 +33,239 @@ type Result struct {
 	GenericAdapter gen.Adapter
 }
 
+// Stats are the counters of the handled sessions.
+type Stats struct {
+	// Sessions is the number of handled sessions.
+	Sessions int64
+	// Frames is the number of handled frames.
+	Frames int64
+	// Drained is the number of sessions finished by shutdown.
+	Drained int64
+	// Killed is the number of sessions closed by shutdown timeout.
+	Killed int64
+	// Uncommitted is the number of frames not acknowledged since their positions are not committed.
+	Uncommitted int64
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (s Stats) MarshalZerologObject(e *zerolog.Event) {
+	e.Int64("sessions", s.Sessions)
+	e.Int64("frames", s.Frames)
+	e.Int64("drained", s.Drained)
+	e.Int64("killed", s.Killed)
+	e.Int64("uncommitted", s.Uncommitted)
+}
+
 // Handler is the tcp protocol handler.
 type Handler struct {
+	*ev.Dispatcher
 	logger      zerolog.Logger
 	IdleTimeout time.Duration
 	proto       Protocol
-	evManager   *event.Manager
+	detector    *Detector
+
+	mu       sync.Mutex
+	draining bool
+	conns    map[net.Conn]struct{}
+	active   sync.WaitGroup
+	stats    struct{ sessions, frames, drained, killed, uncommitted atomic.Int64 }
 }
 
 const (
-	eventManagerName = "events manager"
+	// detectLimit is the max number of the first bytes used to detect the protocol.
+	detectLimit = 1024
 )
 
+var errNotDetected = errors.New("protocol not detected")
+
 // NewHandler creates a new tcp protocol handler.
-func NewHandler(l zerolog.Logger, p Protocol, idle time.Duration) (h *Handler) {
-	h = &Handler{logger: l, proto: p, IdleTimeout: idle, evManager: event.NewManager(eventManagerName)}
+func NewHandler(l zerolog.Logger, p Protocol, idle time.Duration, opts ...ev.DispatcherOption) (h *Handler) {
+	h = &Handler{Dispatcher: ev.NewDispatcher(l, idle, opts...), logger: l, proto: p, IdleTimeout: idle, conns: make(map[net.Conn]struct{})}
 	return
 }
 
-func (h *Handler) RegisterEventSubscriber(sub event.Subscriber) {
-	h.logger.Debug().Str("consumer-listener", fmt.Sprintf("%s", sub)).Msg("register events subscriber")
-	h.evManager.AddSubscriber(sub)
-}
-
-func (h *Handler) subsribersNames() []string {
-	events := h.evManager.ListenedNames()
-	set := make(map[string]struct{}, len(events))
-	for n := range events {
-		names := strings.Split(n, ".")
-		name := names[len(names)-1]
-		if _, ok := set[name]; !ok {
-			set[name] = struct{}{}
-		}
-	}
-	listeners := make([]string, 0)
-	for n := range set {
-		listeners = append(listeners, n)
-	}
-	return listeners
+// NewAutoHandler creates a new tcp handler, the protocol of every connection is detected by its first bytes.
+func NewAutoHandler(l zerolog.Logger, d *Detector, idle time.Duration, opts ...ev.DispatcherOption) (h *Handler) {
+	h = &Handler{Dispatcher: ev.NewDispatcher(l, idle, opts...), logger: l, detector: d, IdleTimeout: idle, conns: make(map[net.Conn]struct{})}
+	return
 }
 
 // Handle handles the tcp inbound connection.
 // It parses the tcp payload and calls the protocol handler.
 // If some useful Event is extracted from the packet,
 // it will be sent to the listeners what previously was registered by calling RegisterEventSubscriber.
+// Session lifecycle events are fired when the connection is opened, the device is identified and the session is closed.
 func (h *Handler) Handle(conn tcpserver.Connection) {
-	session := gonanoid.Must(8)
+	info := ev.SessionInfo{
+		ID:       gonanoid.Must(8),
+		Remote:   conn.RemoteAddr().String(),
+		Local:    conn.LocalAddr().String(),
+		OpenedAt: conn.GetStartTime(),
+	}
+	if h.proto != nil {
+		info.Protocol = h.proto.Name()
+	}
 
 	logger := h.logger.With().
-		Str("session", session).
-		Str("remote", conn.RemoteAddr().String()).
-		Str("local", conn.LocalAddr().String()).
+		Str("session", info.ID).
+		Str("remote", info.Remote).
+		Str("local", info.Local).
 		Logger()
+	if !h.open(conn) {
+		logger.Debug().Msg("server is shutting down, session rejected")
+		_ = conn.Close()
+		return
+	}
 	logger.Debug().Msg("session opened...")
+	h.DispatchSession(&logger, ev.SessionConnected, info)
+
+	c := &counter{Connection: conn}
+	// the session is waited for by Drain until SessionDisconnected is dispatched.
+	defer h.active.Done()
 	defer func() {
-		logger.Debug().Dur("opened", time.Since(conn.GetStartTime())).Msg("session closed...")
+		h.close(conn)
 		err := conn.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			logger.Err(err).Msg("close session")
 		}
+		info.Duration = time.Since(info.OpenedAt)
+		info.BytesIn, info.BytesOut = c.in, c.out
+		logger.Debug().Dur("opened", info.Duration).Str("reason", string(info.Reason)).Msg("session closed...")
+		h.DispatchSession(&logger, ev.SessionDisconnected, info)
+	}()
+
+	info.Reason = h.handle(&logger, c, &info)
+}
+
+// counter counts bytes read from and written to the connection.
+type counter struct {
+	tcpserver.Connection
+	in, out int64
+}
+
+func (c *counter) Read(b []byte) (int, error) {
+	n, err := c.Connection.Read(b)
+	c.in += int64(n)
+	return n, err
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	n, err := c.Connection.Write(b)
+	c.out += int64(n)
+	return n, err
+}
+
+// open registers the connection and tracks the session goroutine, connections are not registered while draining.
+func (h *Handler) open(conn net.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	h.active.Add(1)
+	h.stats.sessions.Add(1)
+	return true
+}
+
+func (h *Handler) close(conn net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, conn)
+}
+
+// isDraining reports whether sessions shall be finished.
+func (h *Handler) isDraining() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.draining
+}
+
+// extendDeadline sets the idle deadline of the connection unless sessions are drained.
+// It is set under the lock of Drain, so the deadline set by Drain is not overwritten.
+func (h *Handler) extendDeadline(conn net.Conn) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return nil
+	}
+	return conn.SetDeadline(time.Now().Add(h.IdleTimeout))
+}
+
+// Drain finishes active sessions: every session finishes its current frame and returns.
+// Sessions still active when the context is done are closed and not waited for,
+// since they may be blocked by the full events queue until the dispatcher is shut down.
+func (h *Handler) Drain(ctx context.Context) {
+	h.mu.Lock()
+	h.draining = true
+	for conn := range h.conns {
+		// unblock waiting for the next frame, current frame is handled anyway.
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	h.stats.drained.Add(int64(len(h.conns)))
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.mu.Lock()
+		h.logger.Warn().Int("sessions", len(h.conns)).Msg("drain timed out, closing sessions")
+		h.stats.killed.Add(int64(len(h.conns)))
+		for conn := range h.conns {
+			_ = conn.Close()
+		}
+		h.mu.Unlock()
+	}
+}
 
-	h.handle(&logger, conn)
+// Stats returns the counters of the handled sessions.
+func (h *Handler) Stats() Stats {
+	return Stats{
+		Sessions:    h.stats.sessions.Load(),
+		Frames:      h.stats.frames.Load(),
+		Drained:     h.stats.drained.Load(),
+		Killed:      h.stats.killed.Load(),
+		Uncommitted: h.stats.uncommitted.Load(),
+	}
 }
 
-func (h *Handler) handle(l *zerolog.Logger, conn tcpserver.Connection) {
-	err := conn.SetDeadline(time.Now().Add(h.IdleTimeout))
+// handle handles frames of the session until it is closed, it returns the reason of closing.
+// Protocol and device of the session info are updated as soon as they are known.
+func (h *Handler) handle(l *zerolog.Logger, conn tcpserver.Connection, info *ev.SessionInfo) ev.CloseReason {
+	err := h.extendDeadline(conn)
 	if err != nil {
 		l.Error().Err(err).Msg("set deadline")
-		return
+		return ev.ReasonError
+	}
+
+	var r io.Reader = conn
+	proto := h.proto
+	if h.detector != nil {
+		peeked, det, err := h.detect(conn)
+		if det.Protocol == nil {
+			l.Warn().Err(err).Object("detection", det).Str("bytes", hex.EncodeToString(peeked)).Msg("protocol not detected")
+			if len(peeked) > 0 {
+				h.protocolError(l, info, peeked, errNotDetected)
+			}
+			return closeReason(err, ev.ReasonBadData)
+		}
+		l.Info().Object("detection", det).Msg("protocol detected")
+		proto = det.Protocol
+		info.Protocol = proto.Name()
+		logger := l.With().Str("detected", proto.Name()).Logger()
+		l = &logger
+		r = io.MultiReader(bytes.NewReader(peeked), conn)
 	}
 
 	var result Result
 	session := internal.NewSession()
-	scanner := bufio.NewScanner(conn)
-	splitter := h.proto.NewFrameSplitter()
+	scanner := bufio.NewScanner(r)
+	splitter := proto.NewFrameSplitter()
 	scanner.Split(splitter.Splitter())
 	for scanner.Scan() {
 		data := scanner.Bytes()
@@ -113,16 +273,48 @@ func (h *Handler) handle(l *zerolog.Logger, conn tcpserver.Connection) {
 			continue
 		}
 
-		err = conn.SetDeadline(time.Now().Add(h.IdleTimeout))
+		err = h.extendDeadline(conn)
 		if err != nil {
 			l.Error().Err(err).Msg("extending deadline")
-			return
+			return ev.ReasonError
 		}
+		h.stats.frames.Add(1)
 
 		l.Debug().Str("dir", "in").Str("bytes", hex.EncodeToString(data)).Send()
-		result, err = h.proto.Respond(session, data)
+		result, err = proto.Respond(session, data)
+		if info.Device == "" && session.Device() != "" {
+			info.Device = session.Device()
+			h.DispatchSession(l, ev.SessionAuthenticated, *info)
+		}
 		if err != nil {
 			l.Warn().Err(err).Msg("got protocol error")
+			h.protocolError(l, info, data, err)
+		}
+
+		var poss []common.Position
+		if result.GenericAdapter != nil {
+			poss = result.GenericAdapter.GenericPositions()
+		}
+		if h.Committing() && len(poss) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), h.IdleTimeout)
+			err = h.Commit(ctx, l, poss)
+			cancel()
+			// committing may take the whole idle timeout, so the reply is written within the new deadline.
+			if derr := h.extendDeadline(conn); derr != nil {
+				l.Error().Err(derr).Msg("extending deadline")
+				return ev.ReasonError
+			}
+			if err != nil {
+				h.stats.uncommitted.Add(1)
+				nack := NackFrame(proto, session, data)
+				l.Warn().Err(err).Str("device", session.Device()).Int("positions", len(poss)).Bool("nack", len(nack) > 0).
+					Msg("positions are not committed, frame is not acknowledged")
+				if len(nack) == 0 {
+					// device retransmits unacknowledged data after reconnect.
+					return ev.ReasonNotCommitted
+				}
+				result.Response = nack
+			}
 		}
 		l.Debug().Str("dir", "out").Str("device", session.Device()).Str("bytes", hex.EncodeToString(result.Response)).Send()
 
@@ -130,111 +322,81 @@ func (h *Handler) handle(l *zerolog.Logger, conn tcpserver.Connection) {
 			_, err = conn.Write(result.Response) // send result even got error
 			if err != nil {
 				l.Error().Err(err).Msg("write result")
-				return
+				return ev.ReasonError
 			}
 		}
 
 		if result.CloseSession {
-			return
+			return ev.ReasonCloseSession
 		}
 
-		if result.GenericAdapter != nil {
-			poss := result.GenericAdapter.GenericPositions()
-			for _, pos := range poss {
-				for _, name := range h.subsribersNames() {
-					e := new(ev.GenericEvent)
-					e.SetPosition(pos)
-					e.SetName(fmt.Sprintf("%s.%s", ev.PositionReceived, name))
-
-					ctx, cancel := context.WithTimeout(context.Background(), h.IdleTimeout)
-					defer cancel()
-					go h.fireEvent(ctx, l, e)
-				}
+		if !h.Committing() && len(poss) > 0 {
+			h.DispatchPositions(l, poss)
+		}
 
-			}
+		if h.isDraining() {
+			l.Debug().Str("device", session.Device()).Msg("session drained")
+			return ev.ReasonShutdown
 		}
 	}
 
+	if h.isDraining() {
+		return ev.ReasonShutdown
+	}
+
 	if splitter.Error() != nil && errors.Is(splitter.Error(), common.ErrBadData) {
 		l.Error().Err(splitter.Error()).Str("bytes", hex.EncodeToString(splitter.BadData())).Msg("bad data")
-		return
+		h.protocolError(l, info, splitter.BadData(), splitter.Error())
+		return ev.ReasonBadData
 	}
 
 	if scanner.Err() != nil && scanner.Err() != io.EOF {
 		l.Error().Err(scanner.Err()).Msg("scanner error")
-		return
+		return closeReason(scanner.Err(), ev.ReasonError)
 	}
+	return ev.ReasonEOF
 }
 
-func (h *Handler) fireEvent(ctx context.Context, l *zerolog.Logger, event event.Event) {
-	reply := make(chan ev.Reply)
-	defer close(reply)
-	retrying := h.retryFire(ctx, h.evManager.FireEvent, reply)
-
-	go func() {
-		err := retrying(event)
-		if err != nil {
-			l.Err(err).Msg("retrying to fire event")
-		}
-	}()
+// protocolError fires ProtocolError event for the data of the session failed with err.
+func (h *Handler) protocolError(l *zerolog.Logger, info *ev.SessionInfo, data []byte, err error) {
+	fe := ev.NewFrameError(data, err)
+	fe.Session, fe.Remote, fe.Protocol, fe.Device = info.ID, info.Remote, info.Protocol, info.Device
+	h.DispatchProtocolError(l, fe)
+}
 
-	for r := range reply {
-		if r.Error == nil {
-			l.Info().Msg(r.Message)
-			return
-		}
-		l.Err(r.Error).Msg(r.Message)
-		if r.Error != nil && r.Error == context.Canceled {
-			return
-		}
-		continue
+// closeReason returns the reason of the session closed by the read error, def is returned for other errors.
+func closeReason(err error, def ev.CloseReason) ev.CloseReason {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return ev.ReasonIdleTimeout
+	case errors.Is(err, io.EOF):
+		return ev.ReasonEOF
 	}
+	return def
 }
 
-type fireraiser func(event event.Event) error
-
-func (h *Handler) retryFire(ctx context.Context, fireraiser fireraiser, reply chan ev.Reply) fireraiser {
-	return func(evnt event.Event) error {
-		for try := 1; ; try++ {
-			err := fireraiser(evnt)
-			if err == nil {
-				reply <- ev.Reply{
-					Message: fmt.Sprintf(`successful handle "%s" event`, evnt.Name()),
-				}
-				return nil
-			}
-
-			/*
-				info: in this place, by creating a new event through the fireraiser, you can call the event of some notifier to notify about an error
-
-				go func(){
-					for _, name := range h.subsribersNames() {
-						e := new(ev.GenericEvent)
-						e.SetName(fmt.Sprintf("%s.%s", ev.NotifyError, name))
-						e.SetData(event.M{"message": fmt.Sprintf(`event "%s" failed attempt #[%d]`, evnt.Name(), try)})
-						if err := fireraiser(e); err != nil {
-							l.Err(err).Msg("notify error")
-						}
-					}
-
-				}() */
-
-			delay := time.Second << uint(try)
-			timer := time.NewTimer(delay)
-			defer timer.Stop()
-			reply <- ev.Reply{
-				Error:   err,
-				Message: fmt.Sprintf(`event "%s" failed attempt #[%d] | retrying after: [%s]`, evnt.Name(), try, delay),
-			}
-			select {
-			case <-timer.C:
-			case <-ctx.Done():
-				reply <- ev.Reply{
-					Error:   ctx.Err(),
-					Message: fmt.Sprintf(`retrying event "%s" stopped via context`, evnt.Name()),
-				}
-				return ctx.Err()
+// detect reads the first bytes of the connection until the detection is final or detectLimit is reached.
+// The protocol is detected if its splitter got the frame at least.
+// Read bytes are returned to be handled by the detected protocol.
+func (h *Handler) detect(conn io.Reader) (peeked []byte, det Detection, err error) {
+	buf := make([]byte, detectLimit)
+	n := 0
+	for n < len(buf) {
+		var m int
+		m, err = conn.Read(buf[n:])
+		n += m
+		if m > 0 {
+			det = h.detector.Detect(buf[:n])
+			if det.Final() {
+				break
 			}
 		}
+		if err != nil {
+			break
+		}
+	}
+	if det.Score < ScoreFramed {
+		det.Protocol = nil
 	}
+	return buf[:n], det, err
 }
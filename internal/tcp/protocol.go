@@ -14,3 +14,33 @@ type Protocol interface {
 	// Respond returns the Result as passed was processed.
 	Respond(*internal.Session, []byte) (Result, error)
 }
+
+// ResponseSplitter is an optional contract for protocols those replies are framed differently from requests.
+// Replayer uses it to read server replies.
+type ResponseSplitter interface {
+	// NewResponseSplitter returns instance of the split function for the protocol replies.
+	NewResponseSplitter() common.FrameSplitter
+}
+
+// Nacker is an optional contract for protocols with the negative reply making the device retransmit the frame.
+// Handler uses it when positions of the frame are not committed in ack-after-commit mode,
+// otherwise the session is closed without reply.
+type Nacker interface {
+	// Nack returns the negative reply to the frame.
+	Nack(*internal.Session, []byte) []byte
+}
+
+// NackFrame returns the negative reply to the frame if the protocol has one.
+func NackFrame(p Protocol, s *internal.Session, frame []byte) []byte {
+	if n, ok := p.(Nacker); ok {
+		return n.Nack(s, frame)
+	}
+	return nil
+}
+
+// ReplyChecker is an optional contract for protocols where server doesn't reply to some frames.
+// Replayer uses it to skip waiting for reply.
+type ReplyChecker interface {
+	// ExpectReply reports whether server replies to the frame.
+	ExpectReply(frame []byte) bool
+}
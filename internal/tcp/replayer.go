@@ -117,6 +117,12 @@ func (p *Replayer) Play(filename string) error {
 			return nil
 		}
 
+		if rc, ok := p.proto.(ReplyChecker); ok && !rc.ExpectReply(b) {
+			log.Debug().Str("filename", filename).Msg("no reply expected")
+			time.Sleep(time.Duration(rand.Intn(p.packetDelay)) * time.Millisecond)
+			continue
+		}
+
 		if err = conn.SetReadDeadline(time.Now().Add(p.readTimeout)); err != nil {
 			return err
 		}
@@ -139,6 +145,9 @@ func (p *Replayer) readResponse(r io.Reader) ([]byte, error) {
 	var resp []byte
 	scanner := bufio.NewScanner(r)
 	splitter := p.proto.NewFrameSplitter()
+	if rs, ok := p.proto.(ResponseSplitter); ok {
+		splitter = rs.NewResponseSplitter()
+	}
 	scanner.Split(splitter.Splitter())
 	for scanner.Scan() {
 		if errors.Is(splitter.Error(), common.ErrBadData) {
@@ -3,6 +3,7 @@ package tcp
 import (
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/gotrackery/gotrackery/internal/event"
@@ -14,15 +15,20 @@ type ServerOption func(*Server)
 
 // Server is a TCP server for handling incoming device or retranslator connections.
 type Server struct {
-	Handler *Handler
-	srv     *tcpserver.Server
-	logger  zerolog.Logger
-	timeout time.Duration
+	Handler         *Handler
+	srv             *tcpserver.Server
+	logger          zerolog.Logger
+	timeout         time.Duration
+	shutdownTimeout time.Duration
+	dispatcher      *event.Dispatcher
+	dispatcherOpts  []event.DispatcherOption
 }
 
+const defaultShutdownTimeout = 30 * time.Second
+
 // NewServer creates a new TCP server.
 func NewServer(l zerolog.Logger, address string, opts ...ServerOption) (server *Server, err error) {
-	server = &Server{logger: l}
+	server = &Server{logger: l, shutdownTimeout: defaultShutdownTimeout}
 	server.srv, err = tcpserver.NewServer(address)
 	server.srv.SetListenConfig(&tcpserver.ListenConfig{
 		SocketReusePort: true,
@@ -51,6 +57,33 @@ func WithTimeout(to time.Duration) ServerOption {
 	}
 }
 
+// WithShutdownTimeout sets the time to drain active sessions and to wait for pending deliveries
+// of events on shutdown. Default is 30 seconds.
+func WithShutdownTimeout(to time.Duration) ServerOption {
+	return func(s *Server) {
+		if to == 0 {
+			to = defaultShutdownTimeout
+		}
+		s.shutdownTimeout = to
+	}
+}
+
+// WithDispatcherOptions sets options of the events dispatcher owned by the server,
+// they are ignored if the dispatcher is shared.
+func WithDispatcherOptions(opts ...event.DispatcherOption) ServerOption {
+	return func(s *Server) {
+		s.dispatcherOpts = opts
+	}
+}
+
+// WithDispatcher sets events dispatcher shared with other servers.
+// Shared dispatcher is not closed by the server.
+func WithDispatcher(d *event.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.dispatcher = d
+	}
+}
+
 func WithSocketReusePort(reuse bool) ServerOption {
 	return func(s *Server) {
 		c := s.srv.GetListenConfig()
@@ -101,36 +134,80 @@ func (s *Server) RegisterHandler(f tcpserver.RequestHandlerFunc) {
 // SetProtocol sets the protocol for incoming device or retranslator connections.
 func (s *Server) SetProtocol(p Protocol) {
 	s.logger = s.logger.With().Str("proto", p.Name()).Logger()
-	s.Handler = NewHandler(s.logger, p, s.timeout)
+	s.Handler = NewHandler(s.logger, p, s.timeout, s.dispatcherOpts...)
+	if s.dispatcher != nil {
+		s.Handler.Dispatcher = s.dispatcher
+	}
+	s.RegisterHandler(s.Handler.Handle)
+}
+
+// SetDetector sets the detector of the protocol for every incoming connection.
+func (s *Server) SetDetector(d *Detector) {
+	s.logger = s.logger.With().Str("proto", AutoProto).Logger()
+	s.Handler = NewAutoHandler(s.logger, d, s.timeout, s.dispatcherOpts...)
+	if s.dispatcher != nil {
+		s.Handler.Dispatcher = s.dispatcher
+	}
 	s.RegisterHandler(s.Handler.Handle)
 }
 
 // ListenAndServe starts the TCP server.
 func (s *Server) ListenAndServe() error {
-	defer func() {
-		for _, name := range s.Handler.subsribersNames() {
-			e := new(event.GenericEvent)
-			e.SetName(fmt.Sprintf("%s.%s", event.CloseConnection, name))
-			go s.Handler.fireEvent(context.Background(), &s.logger, e)
-		}
-		err := s.srv.Shutdown(s.timeout)
-		if err != nil {
-			return
-		}
-	}()
+	err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve()
+}
 
+// Listen binds the server to the address.
+func (s *Server) Listen() error {
 	err := s.srv.Listen()
-
 	if err != nil {
 		return fmt.Errorf("error listening on interface: %w", err)
 	}
+	return nil
+}
+
+// Serve accepts connections until the server is shut down.
+// Then active sessions are drained, pending events are delivered and CloseConnection event is fired
+// within the shutdown timeout, the summary of the server is logged finally.
+func (s *Server) Serve() error {
+	defer func() {
+		err := s.srv.Halt()
+		if err != nil {
+			s.logger.Debug().Err(err).Msg("stop listening")
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		s.Handler.Drain(ctx)
+		summary := s.logger.Info().Object("sessions", s.Handler.Stats())
+		if s.dispatcher == nil {
+			summary = summary.Object("deliveries", s.Handler.Dispatcher.Shutdown(ctx))
+		}
+		summary.Dur("shutdown", time.Since(start)).Msg("server stopped")
+	}()
 
 	s.logger.Info().
 		Str("local", s.srv.GetListenAddr().String()).
 		Msg("server starts serving")
-	err = s.srv.Serve()
+	err := s.srv.Serve()
 	if err != nil {
 		return fmt.Errorf("error serving: %w", err)
 	}
 	return nil
 }
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.srv.GetListenAddr()
+}
+
+// Shutdown stops accepting new connections, Serve returns after active sessions are drained.
+// Listener is halted without waiting for connections, sessions are drained by the handler
+// within the shutdown timeout, since idle ones are not finished until their read deadline.
+func (s *Server) Shutdown() error {
+	return s.srv.Halt()
+}
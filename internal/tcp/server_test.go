@@ -0,0 +1,319 @@
+package tcp_test
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gookit/event"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/gotrackery/internal/protocol/arnavi"
+	"github.com/gotrackery/gotrackery/internal/protocol/teltonika"
+	"github.com/gotrackery/gotrackery/internal/protocol/tk103"
+	"github.com/gotrackery/gotrackery/internal/protocol/wialonips"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0",
+		tcp.WithTimeout(time.Minute), tcp.WithShutdownTimeout(time.Second))
+	require.NoError(t, err)
+	srv.SetProtocol(wialonips.NewWialonIPS())
+	require.NoError(t, srv.Listen())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve()
+	}()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	r := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("#L#866795037163746;NA\r\n"))
+	require.NoError(t, err)
+	reply, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "#AL#1\r\n", reply)
+
+	start := time.Now()
+	require.NoError(t, srv.Shutdown())
+	select {
+	case err = <-served:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server is not stopped")
+	}
+	assert.Less(t, time.Since(start), time.Second, "idle session shall be drained at once")
+
+	_, err = r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF, "connection shall be closed")
+	assert.Equal(t, tcp.Stats{Sessions: 1, Frames: 1, Drained: 1}, srv.Handler.Stats())
+}
+
+// subscriber handles positions failing them with err.
+type subscriber struct {
+	err error
+}
+
+func (s subscriber) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", ev.PositionReceived, "test"): s}
+}
+
+func (s subscriber) Handle(event.Event) error {
+	return s.err
+}
+
+func TestServer_AckAfterCommit(t *testing.T) {
+	const login = "(027043288150BP05000027043288150160522A5539.6549N03731.0124E000.0104531000.0000000000L00000000)"
+
+	tests := []struct {
+		name      string
+		sub       subscriber
+		wantReply string
+	}{
+		{name: "committed", sub: subscriber{}, wantReply: "(027043288150AP05)"},
+		{name: "not committed", sub: subscriber{err: errors.New("fake")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0", tcp.WithTimeout(500*time.Millisecond),
+				tcp.WithDispatcherOptions(ev.WithAck(ev.AckAll, 0)))
+			require.NoError(t, err)
+			srv.SetProtocol(tk103.NewTK103())
+			srv.Handler.RegisterEventSubscriber(tt.sub)
+			require.NoError(t, srv.Listen())
+			go func() {
+				_ = srv.Serve()
+			}()
+			defer srv.Shutdown()
+
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+			_, err = conn.Write([]byte(login))
+			require.NoError(t, err)
+
+			reply, err := bufio.NewReader(conn).ReadString(')')
+			if tt.wantReply == "" {
+				assert.ErrorIs(t, err, io.EOF, "frame shall not be acknowledged")
+				assert.Equal(t, int64(1), srv.Handler.Stats().Uncommitted)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReply, reply)
+		})
+	}
+}
+
+func TestServer_NackNotCommitted(t *testing.T) {
+	const (
+		imei  = "000f333536333037303432343431303133"
+		codec = "000000000000003608010000016b40d8ea30010000000000000000000000000000000105021503010101425e0f01f10000601a014e0000000000000000010000c7cf"
+	)
+
+	srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0", tcp.WithTimeout(500*time.Millisecond),
+		tcp.WithDispatcherOptions(ev.WithAck(ev.AckAll, 0)))
+	require.NoError(t, err)
+	srv.SetProtocol(teltonika.NewTeltonika())
+	srv.Handler.RegisterEventSubscriber(subscriber{err: errors.New("fake")})
+	require.NoError(t, srv.Listen())
+	go func() {
+		_ = srv.Serve()
+	}()
+	defer srv.Shutdown()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	r := bufio.NewReader(conn)
+
+	_, err = conn.Write(mustHex(t, imei))
+	require.NoError(t, err)
+	b, err := r.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), b)
+
+	// positions are retried for the whole idle timeout, the nack is written anyway.
+	_, err = conn.Write(mustHex(t, codec))
+	require.NoError(t, err)
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(r, reply)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, 4), reply, "frame shall be rejected by zero number of records")
+	assert.Equal(t, int64(1), srv.Handler.Stats().Uncommitted)
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// sessions records session lifecycle events.
+type sessions struct {
+	mu     sync.Mutex
+	events []ev.Name
+	infos  []ev.SessionInfo
+}
+
+func (s *sessions) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.SessionConnected, "test"):     s,
+		fmt.Sprintf("%s.%s", ev.SessionAuthenticated, "test"): s,
+		fmt.Sprintf("%s.%s", ev.SessionDisconnected, "test"):  s,
+	}
+}
+
+func (s *sessions) Handle(e event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, _ := strings.CutSuffix(e.Name(), ".test")
+	s.events = append(s.events, ev.Name(name))
+	s.infos = append(s.infos, *e.(*ev.GenericEvent).Session())
+	return nil
+}
+
+func (s *sessions) received() ([]ev.Name, []ev.SessionInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ev.Name(nil), s.events...), append([]ev.SessionInfo(nil), s.infos...)
+}
+
+func TestServer_SessionEvents(t *testing.T) {
+	const (
+		login = "#L#866795037163746;NA\r\n"
+		reply = "#AL#1\r\n"
+	)
+
+	tests := []struct {
+		name       string
+		disconnect bool
+		wantReason ev.CloseReason
+	}{
+		{name: "eof", disconnect: true, wantReason: ev.ReasonEOF},
+		{name: "idle timeout", wantReason: ev.ReasonIdleTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := new(sessions)
+			srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0", tcp.WithTimeout(100*time.Millisecond))
+			require.NoError(t, err)
+			srv.SetProtocol(wialonips.NewWialonIPS())
+			srv.Handler.RegisterEventSubscriber(sub)
+			require.NoError(t, srv.Listen())
+			go func() {
+				_ = srv.Serve()
+			}()
+			defer srv.Shutdown()
+
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+			_, err = conn.Write([]byte(login))
+			require.NoError(t, err)
+			_, err = bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			if tt.disconnect {
+				require.NoError(t, conn.Close())
+			}
+
+			require.Eventually(t, func() bool {
+				events, _ := sub.received()
+				return len(events) == 3
+			}, time.Second, time.Millisecond)
+			events, infos := sub.received()
+			assert.Equal(t, []ev.Name{ev.SessionConnected, ev.SessionAuthenticated, ev.SessionDisconnected}, events)
+			assert.Empty(t, infos[0].Device)
+			assert.Equal(t, "866795037163746", infos[1].Device)
+
+			closed := infos[2]
+			assert.Equal(t, infos[0].ID, closed.ID)
+			assert.Equal(t, "866795037163746", closed.Device)
+			assert.Equal(t, tt.wantReason, closed.Reason)
+			assert.Equal(t, int64(len(login)), closed.BytesIn)
+			assert.Equal(t, int64(len(reply)), closed.BytesOut)
+			assert.Positive(t, closed.Duration)
+		})
+	}
+}
+
+// frameErrors records protocol errors.
+type frameErrors struct {
+	mu     sync.Mutex
+	errors []ev.FrameError
+}
+
+func (s *frameErrors) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", ev.ProtocolError, "test"): s}
+}
+
+func (s *frameErrors) Handle(e event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, *e.(*ev.GenericEvent).FrameError())
+	return nil
+}
+
+func (s *frameErrors) received() []ev.FrameError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ev.FrameError(nil), s.errors...)
+}
+
+func TestServer_ProtocolError(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantBytes string
+		wantErr   string
+	}{
+		{name: "bad data", data: []byte{0x01, 0x02}, wantBytes: "0102", wantErr: common.ErrBadData.Error()},
+		{name: "respond", data: []byte{0x5B, 0x01, 0x5D}, wantBytes: "5b015d", wantErr: arnavi.ErrNotLoggedIn.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := new(frameErrors)
+			srv, err := tcp.NewServer(zerolog.Nop(), "127.0.0.1:0", tcp.WithTimeout(time.Second))
+			require.NoError(t, err)
+			srv.SetProtocol(arnavi.NewArnavi())
+			srv.Handler.RegisterEventSubscriber(sub)
+			require.NoError(t, srv.Listen())
+			go func() {
+				_ = srv.Serve()
+			}()
+			defer srv.Shutdown()
+
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write(tt.data)
+			require.NoError(t, err)
+			require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+			require.Eventually(t, func() bool { return len(sub.received()) == 1 }, time.Second, time.Millisecond)
+			fe := sub.received()[0]
+			assert.NotEmpty(t, fe.Session)
+			assert.Equal(t, conn.LocalAddr().String(), fe.Remote)
+			assert.Equal(t, arnavi.NewArnavi().Name(), fe.Protocol)
+			assert.Equal(t, tt.wantBytes, fe.Bytes)
+			assert.Equal(t, tt.wantErr, fe.Error)
+		})
+	}
+}
@@ -0,0 +1,352 @@
+// Package udp implements UDP server for protocols those devices send data as datagrams.
+package udp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gotrackery/gotrackery/internal"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/gotrackery/protocol/common"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultTimeout         = 10 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+	// commitTimeout limits waiting for positions to be committed, datagrams of addresses handled
+	// by the same worker wait for it.
+	commitTimeout = 10 * time.Second
+	maxDatagram   = 64 * 1024
+	// workers is the number of datagram handlers, datagrams of the address are handled by one of them in order.
+	workers = 16
+	// workerQueue is the number of datagrams waiting for the worker, datagrams beyond it are dropped.
+	workerQueue = 256
+)
+
+type ServerOption func(*Server)
+
+// WithTimeout sets the expiry of idle sessions. Default is 10 minutes.
+func WithTimeout(to time.Duration) ServerOption {
+	return func(s *Server) {
+		if to == 0 {
+			to = defaultTimeout
+		}
+		s.timeout = to
+	}
+}
+
+// WithShutdownTimeout sets the time to wait for pending deliveries of events on shutdown. Default is 30 seconds.
+func WithShutdownTimeout(to time.Duration) ServerOption {
+	return func(s *Server) {
+		if to == 0 {
+			to = defaultShutdownTimeout
+		}
+		s.shutdownTimeout = to
+	}
+}
+
+// WithDispatcherOptions sets options of the events dispatcher owned by the server,
+// they are ignored if the dispatcher is shared.
+func WithDispatcherOptions(opts ...ev.DispatcherOption) ServerOption {
+	return func(s *Server) {
+		s.dispatcherOpts = opts
+	}
+}
+
+// WithDispatcher sets events dispatcher shared with other servers.
+// Shared dispatcher is not closed by the server.
+func WithDispatcher(d *ev.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.dispatcher = d
+	}
+}
+
+// session is the state of the remote address.
+type session struct {
+	*internal.Session
+	id       string
+	lastSeen time.Time
+}
+
+// datagram is the data received from the address.
+type datagram struct {
+	addr net.Addr
+	data []byte
+}
+
+// Server is a UDP server for handling incoming device datagrams.
+// Every remote address has its own session, the session expires after timeout of inactivity.
+// Datagrams are handled by workers off the read loop, the address is bound to one worker to keep the order of its datagrams.
+type Server struct {
+	*ev.Dispatcher
+	logger          zerolog.Logger
+	address         string
+	timeout         time.Duration
+	shutdownTimeout time.Duration
+	dispatcher      *ev.Dispatcher
+	dispatcherOpts  []ev.DispatcherOption
+	proto           tcp.Protocol
+	conn            net.PacketConn
+	mu              sync.Mutex
+	sessions        map[string]*session
+	queues          []chan datagram
+	done            chan struct{}
+	closeOnce       sync.Once
+}
+
+// NewServer creates a new UDP server.
+func NewServer(l zerolog.Logger, address string, opts ...ServerOption) (*Server, error) {
+	if _, err := net.ResolveUDPAddr("udp", address); err != nil {
+		return nil, fmt.Errorf("resolve address: %w", err)
+	}
+	s := &Server{
+		logger:          l,
+		address:         address,
+		timeout:         defaultTimeout,
+		shutdownTimeout: defaultShutdownTimeout,
+		sessions:        make(map[string]*session),
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// SetProtocol sets the protocol for incoming datagrams.
+func (s *Server) SetProtocol(p tcp.Protocol) {
+	s.logger = s.logger.With().Str("proto", p.Name()).Logger()
+	s.proto = p
+	s.Dispatcher = s.dispatcher
+	if s.Dispatcher == nil {
+		s.Dispatcher = ev.NewDispatcher(s.logger, s.timeout, s.dispatcherOpts...)
+	}
+}
+
+// Listen binds the server to the address.
+func (s *Server) Listen() (err error) {
+	s.conn, err = net.ListenPacket("udp", s.address)
+	if err != nil {
+		return fmt.Errorf("error listening on interface: %w", err)
+	}
+	return nil
+}
+
+// LocalAddr returns the address the server is listening on.
+func (s *Server) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// ListenAndServe starts the UDP server.
+func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Serve reads datagrams until the server is closed.
+func (s *Server) Serve() error {
+	defer func() {
+		if s.dispatcher == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+			defer cancel()
+			s.logger.Info().Object("deliveries", s.Dispatcher.Shutdown(ctx)).Msg("server stopped")
+		}
+	}()
+
+	go s.expire()
+
+	var wg sync.WaitGroup
+	s.queues = make([]chan datagram, workers)
+	for i := range s.queues {
+		s.queues[i] = make(chan datagram, workerQueue)
+		wg.Add(1)
+		go func(q <-chan datagram) {
+			defer wg.Done()
+			for dg := range q {
+				s.handle(dg.addr, dg.data)
+			}
+		}(s.queues[i])
+	}
+	// workers handle datagrams received before they stop, so the dispatcher is shut down after them.
+	defer func() {
+		for _, q := range s.queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	s.logger.Info().
+		Str("local", s.conn.LocalAddr().String()).
+		Msg("server starts serving")
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			return fmt.Errorf("error serving: %w", err)
+		}
+		if n == 0 {
+			continue
+		}
+		s.enqueue(addr, bytes.Clone(buf[:n]))
+	}
+}
+
+// enqueue passes the datagram to the worker of the address, it is dropped if the worker is overloaded,
+// so a slow address does not stop reading datagrams of the others.
+func (s *Server) enqueue(addr net.Addr, data []byte) {
+	select {
+	case s.queues[worker(addr)] <- datagram{addr: addr, data: data}:
+	default:
+		s.logger.Warn().Str("remote", addr.String()).Int("bytes", len(data)).Msg("worker is overloaded, datagram is dropped")
+	}
+}
+
+// Shutdown stops the server.
+func (s *Server) Shutdown() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+// handle splits the datagram into frames and passes them to the protocol within the session of the address.
+func (s *Server) handle(addr net.Addr, data []byte) {
+	ss := s.session(addr)
+	l := s.logger.With().
+		Str("session", ss.id).
+		Str("remote", addr.String()).
+		Logger()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, len(data)), maxDatagram)
+	splitter := s.proto.NewFrameSplitter()
+	scanner.Split(splitter.Splitter())
+	for scanner.Scan() {
+		frame := scanner.Bytes()
+		if len(frame) == 0 {
+			continue
+		}
+
+		l.Debug().Str("dir", "in").Str("bytes", hex.EncodeToString(frame)).Send()
+		result, err := s.proto.Respond(ss.Session, frame)
+		if err != nil {
+			l.Warn().Err(err).Msg("got protocol error")
+			s.protocolError(&l, ss, addr, frame, err)
+		}
+
+		var poss []common.Position
+		if result.GenericAdapter != nil {
+			poss = result.GenericAdapter.GenericPositions()
+		}
+		if s.Committing() && len(poss) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+			err = s.Commit(ctx, &l, poss)
+			cancel()
+			if err != nil {
+				l.Warn().Err(err).Str("device", ss.Device()).Int("positions", len(poss)).
+					Msg("positions are not committed, frame is not acknowledged")
+				if result.Response = tcp.NackFrame(s.proto, ss.Session, frame); len(result.Response) == 0 {
+					// device retransmits unacknowledged datagram.
+					return
+				}
+			}
+		}
+		l.Debug().Str("dir", "out").Str("device", ss.Device()).Str("bytes", hex.EncodeToString(result.Response)).Send()
+
+		if len(result.Response) > 0 {
+			_, err = s.conn.WriteTo(result.Response, addr) // send result even got error
+			if err != nil {
+				l.Error().Err(err).Msg("write result")
+				return
+			}
+		}
+
+		if !s.Committing() && len(poss) > 0 {
+			s.DispatchPositions(&l, poss)
+		}
+
+		if result.CloseSession {
+			s.drop(addr)
+			return
+		}
+	}
+
+	if splitter.Error() != nil && errors.Is(splitter.Error(), common.ErrBadData) {
+		l.Error().Err(splitter.Error()).Str("bytes", hex.EncodeToString(splitter.BadData())).Msg("bad data")
+		s.protocolError(&l, ss, addr, splitter.BadData(), splitter.Error())
+	}
+}
+
+// worker returns the index of the worker of the address.
+func worker(addr net.Addr) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(addr.String()))
+	return int(h.Sum32() % workers)
+}
+
+// protocolError fires ProtocolError event for the data of the session failed with err.
+func (s *Server) protocolError(l *zerolog.Logger, ss *session, addr net.Addr, data []byte, err error) {
+	fe := ev.NewFrameError(data, err)
+	fe.Session, fe.Remote, fe.Protocol, fe.Device = ss.id, addr.String(), s.proto.Name(), ss.Device()
+	s.DispatchProtocolError(l, fe)
+}
+
+// session returns the session of the address, new session is created if there is no one.
+func (s *Server) session(addr net.Addr) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[addr.String()]
+	if !ok {
+		ss = &session{Session: internal.NewSession(), id: gonanoid.Must(8)}
+		s.sessions[addr.String()] = ss
+		s.logger.Debug().Str("session", ss.id).Str("remote", addr.String()).Msg("session opened...")
+	}
+	ss.lastSeen = time.Now()
+	return ss
+}
+
+func (s *Server) drop(addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, addr.String())
+}
+
+// expire removes sessions those are idle longer than timeout.
+func (s *Server) expire() {
+	ticker := time.NewTicker(s.timeout / 2) //nolint:gomnd
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for remote, ss := range s.sessions {
+				if now.Sub(ss.lastSeen) > s.timeout {
+					delete(s.sessions, remote)
+					s.logger.Debug().Str("session", ss.id).Str("remote", remote).Msg("session expired...")
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package udp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gookit/event"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/gotrackery/internal/protocol/teltonika"
+	"github.com/gotrackery/gotrackery/internal/protocol/tk103"
+	"github.com/gotrackery/gotrackery/internal/tcp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	loginMsg    = "(027043288150BP05000027043288150160522A5539.6549N03731.0124E000.0104531000.0000000000L00000000)"
+	locationMsg = "(080525135000BR00080612A2232.9828N11404.9297E012.5022828180.5000000001L000450AA)"
+)
+
+// subscriber collects devices of received positions.
+type subscriber struct {
+	mu      sync.Mutex
+	devices []string
+}
+
+func (s *subscriber) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", ev.PositionReceived, "test"): s}
+}
+
+func (s *subscriber) Handle(e event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = append(s.devices, e.(*ev.GenericEvent).Position().DeviceID)
+	return nil
+}
+
+func (s *subscriber) count(device string) (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d == device {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestServer(t *testing.T, timeout time.Duration) (*Server, *subscriber) {
+	t.Helper()
+	return newProtoServer(t, timeout, tk103.NewTK103())
+}
+
+func newProtoServer(t *testing.T, timeout time.Duration, proto tcp.Protocol) (*Server, *subscriber) {
+	t.Helper()
+	srv, err := NewServer(zerolog.Nop(), "127.0.0.1:0", WithTimeout(timeout))
+	require.NoError(t, err)
+	srv.SetProtocol(proto)
+	sub := new(subscriber)
+	srv.RegisterEventSubscriber(sub)
+	require.NoError(t, srv.Listen())
+	go func() {
+		assert.NoError(t, srv.Serve())
+	}()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return srv, sub
+}
+
+func dial(t *testing.T, srv *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("udp", srv.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func (s *Server) sessionsCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func TestServer_Serve(t *testing.T) {
+	srv, sub := newTestServer(t, time.Minute)
+
+	// The first client logs in, its session keeps the device of the login.
+	c1 := dial(t, srv)
+	_, err := c1.Write([]byte(loginMsg))
+	require.NoError(t, err)
+	require.NoError(t, c1.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64)
+	n, err := c1.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "(027043288150AP05)", string(buf[:n]))
+
+	// Several frames in one datagram.
+	_, err = c1.Write([]byte(locationMsg + locationMsg))
+	require.NoError(t, err)
+
+	// The second client has its own session.
+	c2 := dial(t, srv)
+	_, err = c2.Write([]byte(locationMsg))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return sub.count("000027043288150") == 3 && sub.count("080525135000") == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, srv.sessionsCount())
+}
+
+func TestServer_Teltonika(t *testing.T) {
+	srv, sub := newProtoServer(t, time.Minute, teltonika.NewUDP())
+
+	datagram, err := hex.DecodeString("003dcafe0105000f33353230393330383634303336353508010000016b4f815b30" +
+		"010000000000000000000000000000000103021503010101425dbc000001")
+	require.NoError(t, err)
+	c := dial(t, srv)
+	_, err = c.Write(datagram)
+	require.NoError(t, err)
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64)
+	n, err := c.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "0005cafe010501", hex.EncodeToString(buf[:n]))
+	require.Eventually(t, func() bool { return sub.count("352093086403655") == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Expire(t *testing.T) {
+	srv, sub := newTestServer(t, 100*time.Millisecond)
+
+	c := dial(t, srv)
+	_, err := c.Write([]byte(loginMsg))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return srv.sessionsCount() == 1 }, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return srv.sessionsCount() == 0 }, time.Second, 10*time.Millisecond)
+
+	// The new session is bound to the device of the message.
+	_, err = c.Write([]byte(locationMsg))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sub.count("080525135000") == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_BadData(t *testing.T) {
+	// Bad datagram doesn't break serving of the next ones.
+	srv, sub := newTestServer(t, time.Minute)
+
+	c := dial(t, srv)
+	_, err := c.Write([]byte("$garbage"))
+	require.NoError(t, err)
+	_, err = c.Write([]byte(locationMsg))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sub.count("080525135000") == 1 }, time.Second, 10*time.Millisecond)
+}
+
+// blockingSubscriber holds positions of the device until it is released.
+type blockingSubscriber struct {
+	device  string
+	release chan struct{}
+}
+
+func (s *blockingSubscriber) SubscribedEvents() map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%s", ev.PositionReceived, "blocking"): s}
+}
+
+func (s *blockingSubscriber) Handle(e event.Event) error {
+	if e.(*ev.GenericEvent).Position().DeviceID == s.device {
+		<-s.release
+	}
+	return nil
+}
+
+func TestServer_SlowAddress(t *testing.T) {
+	// The address waiting for its positions to be committed doesn't hold datagrams of others.
+	srv, err := NewServer(zerolog.Nop(), "127.0.0.1:0", WithTimeout(time.Minute),
+		WithDispatcherOptions(ev.WithAck(ev.AckAll, 0)))
+	require.NoError(t, err)
+	srv.SetProtocol(tk103.NewTK103())
+	sub := new(subscriber)
+	srv.RegisterEventSubscriber(sub)
+	blocking := &blockingSubscriber{device: "000027043288150", release: make(chan struct{})}
+	srv.RegisterEventSubscriber(blocking)
+	require.NoError(t, srv.Listen())
+	go func() {
+		assert.NoError(t, srv.Serve())
+	}()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	c1 := dial(t, srv)
+	c2 := dial(t, srv)
+	for worker(c2.LocalAddr()) == worker(c1.LocalAddr()) {
+		c2 = dial(t, srv)
+	}
+
+	_, err = c1.Write([]byte(loginMsg))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sub.count("000027043288150") == 1 }, time.Second, 10*time.Millisecond)
+
+	_, err = c2.Write([]byte(locationMsg))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sub.count("080525135000") == 1 }, time.Second, 10*time.Millisecond)
+
+	// The blocked address gets the acknowledgement once positions are committed.
+	close(blocking.release)
+	require.NoError(t, c1.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64)
+	n, err := c1.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "(027043288150AP05)", string(buf[:n]))
+}
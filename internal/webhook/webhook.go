@@ -0,0 +1,301 @@
+// Package webhook provides the events subscriber pushing batches of positions to HTTP endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/event"
+	"github.com/gotrackery/gotrackery/internal/encoding"
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+)
+
+var (
+	_ event.Listener   = (*Webhook)(nil)
+	_ event.Subscriber = (*Webhook)(nil)
+	_ ev.Batcher       = (*Webhook)(nil)
+)
+
+// Name is the name of the subscriber.
+const Name = "webhook"
+
+// SignatureHeader is the header of the body signature: sha256=<hex of HMAC-SHA256 of the body>.
+const SignatureHeader = "X-Gotrackery-Signature"
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 100 * time.Millisecond
+	defaultTimeout       = 10 * time.Second
+	defaultBackoff       = 500 * time.Millisecond
+	defaultMaxBackoff    = 10 * time.Second
+	defaultAttempts      = 3
+)
+
+// ErrClosed is returned when the position is handled by the closed webhook.
+var ErrClosed = errors.New("webhook closed")
+
+// StatusError is returned when the endpoint responds with not 2xx status.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// Unwrap returns ev.ErrPermanent for statuses which are not temporary, the position is rejected by the endpoint.
+func (e *StatusError) Unwrap() error {
+	if e.Temporary() {
+		return nil
+	}
+	return ev.ErrPermanent
+}
+
+// Temporary reports whether the request may succeed later: timeout, too many requests or server error.
+func (e *StatusError) Temporary() bool {
+	return e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// Batch is the body of the request.
+type Batch struct {
+	Positions []encoding.Message `json:"positions"`
+}
+
+// Sign returns the signature of the body with the secret, it is the value of SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Option is a functional option for the webhook.
+type Option func(*Webhook)
+
+// WithHeaders sets the headers added to every request, e.g. Authorization.
+func WithHeaders(h map[string]string) Option {
+	return func(w *Webhook) {
+		for k, v := range h {
+			w.headers.Set(k, v)
+		}
+	}
+}
+
+// WithBatch sets max number of positions in the request and the time the dispatcher waits for more positions
+// after the first one. Default is 100 positions and 100ms.
+func WithBatch(size int, interval time.Duration) Option {
+	return func(w *Webhook) {
+		if size > 0 {
+			w.batchSize = size
+		}
+		if interval > 0 {
+			w.flushInterval = interval
+		}
+	}
+}
+
+// WithSecret sets the secret of HMAC-SHA256 body signature, requests are not signed by default.
+func WithSecret(secret string) Option {
+	return func(w *Webhook) {
+		w.secret = []byte(secret)
+	}
+}
+
+// WithTimeout sets the timeout of the request. Default is 10s.
+func WithTimeout(to time.Duration) Option {
+	return func(w *Webhook) {
+		if to > 0 {
+			w.timeout = to
+		}
+	}
+}
+
+// WithBackoff sets the number of request attempts and the delay before the second attempt,
+// the delay is doubled for the next attempts up to max. Default is 3 attempts, 500ms and 10s.
+func WithBackoff(attempts int, initial, max time.Duration) Option {
+	return func(w *Webhook) {
+		if attempts > 0 {
+			w.attempts = attempts
+		}
+		if initial > 0 {
+			w.backoff = initial
+		}
+		if max > 0 {
+			w.maxBackoff = max
+		}
+	}
+}
+
+// WithClient sets HTTP client of requests. Default is http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(w *Webhook) {
+		if c != nil {
+			w.client = c
+		}
+	}
+}
+
+// Webhook pushes positions to the endpoint by POST requests with JSON Batch body.
+// Positions are batched by the dispatcher, the batch is reported as delivered when the endpoint
+// responds with 2xx status. Temporary failures are retried with exponential backoff, the error
+// of the last attempt is returned to the dispatcher to retry the batch.
+type Webhook struct {
+	url    string
+	client *http.Client
+
+	headers       http.Header
+	batchSize     int
+	flushInterval time.Duration
+	secret        []byte
+	timeout       time.Duration
+	attempts      int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+
+	closing chan struct{}
+	once    sync.Once
+}
+
+// NewWebhook creates a new webhook of the endpoint url.
+func NewWebhook(url string, opts ...Option) (*Webhook, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid url %q", url)
+	}
+	w := &Webhook{
+		url:           url,
+		client:        http.DefaultClient,
+		headers:       make(http.Header),
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		timeout:       defaultTimeout,
+		attempts:      defaultAttempts,
+		backoff:       defaultBackoff,
+		maxBackoff:    defaultMaxBackoff,
+		closing:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
+}
+
+func (w *Webhook) String() string {
+	return Name
+}
+
+func (w *Webhook) SubscribedEvents() map[string]any {
+	return map[string]any{
+		fmt.Sprintf("%s.%s", ev.PositionsReceived, Name): w,
+	}
+}
+
+// Batch implements ev.Batcher.
+func (w *Webhook) Batch() (int, time.Duration) {
+	return w.batchSize, w.flushInterval
+}
+
+// Handle posts the batch of positions.
+func (w *Webhook) Handle(e event.Event) error {
+	eve, ok := e.(*ev.GenericEvent)
+	if !ok || eve == nil {
+		return fmt.Errorf("GenericEvent not transferred")
+	}
+	name, ok := strings.CutSuffix(eve.Name(), "."+Name)
+	if !ok || name != string(ev.PositionsReceived) {
+		return fmt.Errorf("event not found for listner: %s", Name)
+	}
+	poss := eve.Positions()
+	if len(poss) == 0 {
+		return fmt.Errorf("%w: positions not specified", ev.ErrPermanent)
+	}
+	select {
+	case <-w.closing:
+		return ErrClosed
+	default:
+	}
+	return w.send(poss)
+}
+
+// send posts the batch, temporary failures are retried with exponential backoff.
+// Retrying is stopped on close, the batch is retried by the dispatcher.
+func (w *Webhook) send(poss []common.Position) error {
+	b := Batch{Positions: make([]encoding.Message, len(poss))}
+	for i, pos := range poss {
+		b.Positions[i] = encoding.NewMessage(pos)
+	}
+	body, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+
+	delay := w.backoff
+	for try := 1; ; try++ {
+		err = w.post(body)
+		if err == nil || try >= w.attempts || !temporary(err) {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-w.closing:
+			timer.Stop()
+			return err
+		}
+		delay = min(delay*2, w.maxBackoff)
+	}
+}
+
+func (w *Webhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range w.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gotrackery")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post to %s: %w", w.url, err)
+	}
+	defer resp.Body.Close()
+	// the body is drained to reuse the connection.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post to %s: %w", w.url, &StatusError{Code: resp.StatusCode})
+	}
+	return nil
+}
+
+// temporary reports whether the failed request shall be retried: network errors and temporary statuses.
+func temporary(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	return true
+}
+
+// Close stops retrying of requests, batches are not handled after it.
+func (w *Webhook) Close() error {
+	w.once.Do(func() { close(w.closing) })
+	return nil
+}
@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ev "github.com/gotrackery/gotrackery/internal/event"
+	"github.com/gotrackery/protocol/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batchEvent(devices ...string) *ev.GenericEvent {
+	poss := make([]common.Position, 0, len(devices))
+	for _, dev := range devices {
+		poss = append(poss, common.Position{Protocol: "egts", DeviceID: dev})
+	}
+	e := new(ev.GenericEvent)
+	e.SetPositions(poss)
+	e.SetName(fmt.Sprintf("%s.%s", ev.PositionsReceived, Name))
+	return e
+}
+
+// endpoint records batches and responds with statuses in turn, 200 after them.
+type endpoint struct {
+	mu       sync.Mutex
+	batches  []Batch
+	headers  []http.Header
+	statuses []int
+	secret   []byte
+}
+
+func (s *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.secret) > 0 && r.Header.Get(SignatureHeader) != Sign(s.secret, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var b Batch
+	_ = json.Unmarshal(body, &b)
+	s.batches = append(s.batches, b)
+	s.headers = append(s.headers, r.Header)
+	if len(s.statuses) > 0 {
+		w.WriteHeader(s.statuses[0])
+		s.statuses = s.statuses[1:]
+	}
+}
+
+func (s *endpoint) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches)
+}
+
+func TestWebhook_Batch(t *testing.T) {
+	ep := &endpoint{secret: []byte("secret")}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	w, err := NewWebhook(srv.URL, WithBatch(3, time.Minute), WithSecret("secret"),
+		WithHeaders(map[string]string{"Authorization": "Bearer token"}))
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, w.Handle(batchEvent("1", "2", "3")))
+
+	require.Equal(t, 1, ep.requests())
+	devices := make([]string, 0, 3)
+	for _, m := range ep.batches[0].Positions {
+		devices = append(devices, m.Device)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, devices)
+	assert.Equal(t, "Bearer token", ep.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", ep.headers[0].Get("Content-Type"))
+}
+
+func TestWebhook_Dispatcher(t *testing.T) {
+	ep := new(endpoint)
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	w, err := NewWebhook(srv.URL, WithBatch(100, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer w.Close()
+
+	l := zerolog.Nop()
+	d := ev.NewDispatcher(l, time.Minute)
+	d.RegisterEventSubscriber(w)
+	poss := make([]common.Position, 0, 300)
+	for i := 0; i < 300; i++ {
+		poss = append(poss, common.Position{Protocol: "egts", DeviceID: strconv.Itoa(i % 30)})
+	}
+	d.DispatchPositions(&l, poss)
+	assert.Equal(t, ev.Stats{Delivered: 300}, d.Shutdown(context.Background()))
+
+	// batches are not limited by the number of dispatcher workers.
+	assert.LessOrEqual(t, ep.requests(), 6)
+	n := 0
+	for _, b := range ep.batches {
+		n += len(b.Positions)
+	}
+	assert.Equal(t, 300, n)
+}
+
+func TestWebhook_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{name: "temporary", statuses: []int{503, 429}, requests: 3},
+		{name: "exhausted", statuses: []int{500, 502, 503}, requests: 3, wantErr: true},
+		{name: "permanent", statuses: []int{400}, requests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &endpoint{statuses: tt.statuses}
+			srv := httptest.NewServer(ep)
+			defer srv.Close()
+
+			w, err := NewWebhook(srv.URL, WithBackoff(3, 5*time.Millisecond, 10*time.Millisecond))
+			require.NoError(t, err)
+			defer w.Close()
+
+			err = w.Handle(batchEvent("1"))
+			assert.Equal(t, tt.requests, ep.requests())
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			var se *StatusError
+			require.ErrorAs(t, err, &se)
+			assert.Equal(t, tt.statuses[len(tt.statuses)-1], se.Code)
+			assert.Equal(t, tt.name == "permanent", errors.Is(err, ev.ErrPermanent))
+		})
+	}
+}
+
+func TestWebhook_Timeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w, err := NewWebhook(srv.URL, WithTimeout(20*time.Millisecond), WithBackoff(2, time.Millisecond, time.Millisecond))
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Error(t, w.Handle(batchEvent("1")))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestWebhook_DispatcherTimeout(t *testing.T) {
+	// the request timed out is retried by the dispatcher.
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(srv.URL, WithTimeout(20*time.Millisecond), WithBackoff(1, time.Millisecond, time.Millisecond))
+	require.NoError(t, err)
+	defer w.Close()
+
+	l := zerolog.Nop()
+	d := ev.NewDispatcher(l, time.Minute)
+	d.RegisterEventSubscriber(w)
+	d.DispatchPositions(&l, []common.Position{{Protocol: "egts", DeviceID: "1"}})
+	assert.Equal(t, ev.Stats{Delivered: 1}, d.Shutdown(context.Background()))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestWebhook_Close(t *testing.T) {
+	ep := &endpoint{statuses: []int{503}}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	// retrying is stopped on close.
+	w, err := NewWebhook(srv.URL, WithBackoff(3, time.Minute, time.Minute))
+	require.NoError(t, err)
+	go func() {
+		for ep.requests() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_ = w.Close()
+	}()
+	var se *StatusError
+	assert.ErrorAs(t, w.Handle(batchEvent("1")), &se)
+	assert.Equal(t, 1, ep.requests())
+
+	assert.ErrorIs(t, w.Handle(batchEvent("2")), ErrClosed)
+}
+
+func TestNewWebhook(t *testing.T) {
+	_, err := NewWebhook("ftp://example.com")
+	assert.Error(t, err)
+}